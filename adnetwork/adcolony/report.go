@@ -0,0 +1,152 @@
+package adcolony
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/econnelly/myrevenue"
+	"github.com/econnelly/myrevenue/adnetwork"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const DEFAULT_BASE_URL = "https://clients-api.adcolony.com"
+
+type ReportRequester struct {
+	APIKey    string `json:"api_key"`
+	BaseURL   string `json:"base_url"` // Defaults to DEFAULT_BASE_URL
+	StartDate time.Time
+	EndDate   time.Time
+	adnetwork.Request
+
+	reportURL string
+	rawData   ReportResponse
+}
+
+type ReportResponse struct {
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+	Results []struct {
+		Date        string  `json:"date"`
+		AppID       string  `json:"app_id"`
+		AppName     string  `json:"app_name"`
+		Platform    string  `json:"platform"`
+		Country     string  `json:"country"`
+		Requests    uint64  `json:"requests"`
+		Impressions uint64  `json:"impressions"`
+		Clicks      uint64  `json:"clicks"`
+		Earnings    float64 `json:"earnings"`
+		ECPM        float64 `json:"ecpm"`
+	} `json:"results"`
+}
+
+func (rr *ReportRequester) Initialize() error {
+	if rr.APIKey == "" {
+		return errors.New("AdColony: API key is required")
+	}
+
+	if rr.BaseURL == "" {
+		rr.BaseURL = DEFAULT_BASE_URL
+	}
+
+	query := url.Values{}
+	query.Set("user_credentials", rr.APIKey)
+	query.Add("date", rr.StartDate.Format("01022006"))
+	query.Add("end_date", rr.EndDate.Format("01022006"))
+	query.Add("date_group", "day")
+	query.Add("group_by", "app")
+	query.Add("group_by", "country")
+	query.Add("format", "json")
+
+	rr.reportURL = fmt.Sprintf("%v/api/v2/publisher_summary?%v", rr.BaseURL, query.Encode())
+
+	return nil
+}
+
+func (rr *ReportRequester) Fetch() ([]myrevenue.Model, error) {
+	resp, err := myrevenue.GetRequest(rr.reportURL, nil, false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, errors.Errorf("%v: request failed (%v): %v", rr.GetName(), resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	return rr.parse(resp.Body)
+}
+
+func (rr *ReportRequester) parse(reader io.Reader) ([]myrevenue.Model, error) {
+	result := ReportResponse{}
+
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+
+	if result.Status != "success" {
+		return nil, errors.Errorf("%v: %v", rr.GetName(), result.Error)
+	}
+
+	rr.rawData = result
+	return rr.convertToReportModel(result)
+}
+
+func (rr ReportRequester) convertToReportModel(response ReportResponse) ([]myrevenue.Model, error) {
+	loc, e := time.LoadLocation("Etc/UTC")
+	if e != nil {
+		return nil, e
+	}
+
+	reportModels := make([]myrevenue.Model, len(response.Results))
+	for i, row := range response.Results {
+		day, err := time.ParseInLocation("2006-01-02", row.Date, loc)
+		if err != nil {
+			return nil, &myrevenue.ParseError{Network: rr.GetName(), Row: i + 1, Column: "date", Err: err}
+		}
+
+		reportModels[i].NetworkName = rr.GetName()
+		reportModels[i].DateTime = day
+		reportModels[i].Country = row.Country
+		reportModels[i].App = row.AppID
+		reportModels[i].Name = row.AppName
+		reportModels[i].Platform = row.Platform
+		reportModels[i].Requests = row.Requests
+		reportModels[i].Impressions = row.Impressions
+		reportModels[i].Clicks = row.Clicks
+		reportModels[i].Revenue = row.Earnings
+		reportModels[i].ECPM = row.ECPM
+		if row.Impressions > 0 {
+			reportModels[i].CTR = float64(row.Clicks) / float64(row.Impressions)
+		}
+	}
+
+	return reportModels, nil
+}
+
+func (ReportRequester) GetName() string {
+	return "AdColony"
+}
+
+func (rr ReportRequester) GetReport() interface{} {
+	return rr.rawData
+}
+
+func (rr ReportRequester) GetStartDate() time.Time {
+	return rr.StartDate
+}
+
+func (rr ReportRequester) GetEndDate() time.Time {
+	return rr.EndDate
+}
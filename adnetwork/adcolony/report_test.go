@@ -0,0 +1,77 @@
+package adcolony
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDefaultBaseURLUsesHTTPS(t *testing.T) {
+	// The API key travels in the query string
+	if !strings.HasPrefix(DEFAULT_BASE_URL, "https://") {
+		t.Errorf("DEFAULT_BASE_URL = %v, want https", DEFAULT_BASE_URL)
+	}
+}
+
+func TestFetch(t *testing.T) {
+	var query map[string][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		if r.URL.Path != "/api/v2/publisher_summary" {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeFile(w, r, "testdata/publisher_summary.json")
+	}))
+	defer server.Close()
+
+	rr := &ReportRequester{
+		APIKey:    "key",
+		BaseURL:   server.URL,
+		StartDate: time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2018, time.October, 2, 0, 0, 0, 0, time.UTC),
+	}
+	if err := rr.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	models, err := rr.Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if query["user_credentials"][0] != "key" || query["date"][0] != "10012018" || query["end_date"][0] != "10022018" {
+		t.Errorf("query = %v", query)
+	}
+
+	if len(models) != 2 {
+		t.Fatalf("got %v models, want 2", len(models))
+	}
+
+	m := models[0]
+	if m.App != "app123" || m.Name != "Example App" || m.Country != "US" || m.Requests != 2000 || m.Impressions != 1500 || m.Revenue != 15.75 {
+		t.Errorf("model = %+v", m)
+	}
+	if m.CTR != 0.02 || m.DateTime.Format("2006-01-02") != "2018-10-01" {
+		t.Errorf("CTR, DateTime = %v, %v", m.CTR, m.DateTime)
+	}
+	if models[1].CTR != 0 {
+		t.Errorf("CTR without impressions = %v", models[1].CTR)
+	}
+}
+
+func TestFetchFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "testdata/error.json")
+	}))
+	defer server.Close()
+
+	rr := &ReportRequester{APIKey: "bad", BaseURL: server.URL}
+	rr.Initialize()
+
+	if _, err := rr.Fetch(); err == nil || err.Error() != "AdColony: Invalid user credentials" {
+		t.Errorf("Fetch() error = %v", err)
+	}
+}
@@ -0,0 +1,48 @@
+package admob
+
+import (
+	"context"
+	"errors"
+	"github.com/econnelly/myrevenue/adnetwork/oauth"
+)
+
+const (
+	AUTH_URL  = "https://accounts.google.com/o/oauth2/v2/auth"
+	TOKEN_URL = "https://oauth2.googleapis.com/token"
+	SCOPE     = "https://www.googleapis.com/auth/admob.readonly"
+)
+
+// Authorize runs the consent flow for the requester's client and saves the
+// resulting tokens to store, where Initialize will find them. openURL is
+// given the consent page to show the user.
+func Authorize(ctx context.Context, rr ReportRequester, store oauth.TokenStore, openURL func(string) error) (oauth.Token, error) {
+	if store == nil {
+		return oauth.Token{}, errors.New("token store is required")
+	}
+
+	flow := oauth.InstalledAppFlow{
+		ClientID:     rr.ClientID,
+		ClientSecret: rr.ClientSecret,
+		AuthURL:      AUTH_URL,
+		TokenURL:     TOKEN_URL,
+		Scopes:       []string{SCOPE},
+		OpenURL:      openURL,
+	}
+
+	return AuthorizeWith(ctx, flow, rr.tokenKey(), store)
+}
+
+// AuthorizeWith runs an arbitrary flow, e.g. one pointed at a fake
+// authorization server, and saves the tokens under key
+func AuthorizeWith(ctx context.Context, flow oauth.InstalledAppFlow, key string, store oauth.TokenStore) (oauth.Token, error) {
+	token, err := flow.Run(ctx)
+	if err != nil {
+		return oauth.Token{}, err
+	}
+
+	return token, store.Save(key, token)
+}
+
+func (rr ReportRequester) tokenKey() string {
+	return "admob:" + rr.ClientID + ":" + rr.PublisherID
+}
@@ -0,0 +1,79 @@
+package admob
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/econnelly/myrevenue/adnetwork/oauth"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestAuthorizeThenInitialize saves tokens the way admob-auth does and
+// builds a requester from fetch settings naming the same file
+func TestAuthorizeThenInitialize(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.PostForm.Get("code") != "code" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "consented",
+			"refresh_token": "refresh",
+			"expires_in":    3600,
+		})
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	settings, _ := json.Marshal(map[string]string{
+		"client_id":     "auth-test",
+		"client_secret": "secret",
+		"publisher_id":  "pub-1234567890",
+		"token_file":    path,
+	})
+
+	rr := ReportRequester{}
+	if err := json.Unmarshal(settings, &rr); err != nil {
+		t.Fatal(err)
+	}
+
+	flow := oauth.InstalledAppFlow{
+		ClientID:     rr.ClientID,
+		ClientSecret: rr.ClientSecret,
+		AuthURL:      server.URL + "/auth",
+		TokenURL:     server.URL + "/token",
+		OpenURL: func(authURL string) error {
+			u, err := url.Parse(authURL)
+			if err != nil {
+				return err
+			}
+			go func() {
+				values := url.Values{"code": {"code"}, "state": {u.Query().Get("state")}}
+				if resp, err := http.Get(u.Query().Get("redirect_uri") + "?" + values.Encode()); err == nil {
+					resp.Body.Close()
+				}
+			}()
+			return nil
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := AuthorizeWith(ctx, flow, rr.tokenKey(), oauth.NewFileStore(path)); err != nil {
+		t.Fatal(err)
+	}
+
+	// No refresh token in the settings, the file provides both tokens
+	if err := rr.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	if rr.authToken != "consented" || rr.RefreshToken != "refresh" {
+		t.Errorf("authToken, RefreshToken = %v, %v", rr.authToken, rr.RefreshToken)
+	}
+}
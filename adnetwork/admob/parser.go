@@ -0,0 +1,191 @@
+package admob
+
+import (
+	"encoding/csv"
+	"errors"
+	"github.com/econnelly/myrevenue"
+	"github.com/econnelly/myrevenue/adnetwork"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReportParser reads network and mediation reports exported from the AdMob
+// dashboard as CSV. Columns are mapped onto the API's dimensions and metrics
+// so rows convert exactly like API responses.
+type ReportParser struct {
+	adnetwork.DirectlyParsable
+}
+
+var exportDimensions = map[string]string{
+	"date":               DATE,
+	"app":                APP,
+	"ad unit":            AD_UNIT,
+	"country":            COUNTRY,
+	"format":             FORMAT,
+	"ad format":          FORMAT,
+	"platform":           PLATFORM,
+	"ad source":          AD_SOURCE,
+	"ad source instance": AD_SOURCE_INSTANCE,
+}
+
+var exportMetrics = map[string]string{
+	"estimated earnings": ESTIMATED_EARNINGS,
+	"ad requests":        AD_REQUESTS,
+	"matched requests":   MATCHED_REQUESTS,
+	"impressions":        IMPRESSIONS,
+	"clicks":             CLICKS,
+	"observed ecpm":      OBSERVED_ECPM,
+}
+
+var exportDateFormats = []string{"2006-01-02", "20060102", "1/2/2006", "Jan 2, 2006"}
+
+func (r ReportParser) ParseRevenue(reader io.Reader) ([]myrevenue.Model, error) {
+	if reader == nil {
+		return nil, errors.New("reader is nil")
+	}
+
+	csvReader := csv.NewReader(reader)
+	csvReader.FieldsPerRecord = -1
+
+	headers, err := csvReader.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	// Strip the currency from "Estimated earnings (USD)" and friends
+	columns := make([]string, len(headers))
+	currency := ""
+	for i, h := range headers {
+		name := strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+		if open := strings.Index(name, " ("); open >= 0 {
+			if name[:open] == "estimated earnings" {
+				currency = strings.ToUpper(strings.Trim(name[open+2:], ") "))
+			}
+			name = name[:open]
+		}
+		columns[i] = name
+	}
+
+	rr := ReportRequester{}
+	loc, err := time.LoadLocation("Etc/UTC")
+	if err != nil {
+		return nil, err
+	}
+
+	dateColumn := -1
+	for i, column := range columns {
+		if exportDimensions[column] == DATE {
+			dateColumn = i
+		}
+	}
+
+	models := make([]myrevenue.Model, 0)
+	for line := 2; ; line++ {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return models, &myrevenue.ParseError{Network: rr.GetName(), Row: line, Err: err}
+		}
+
+		// Totals rows have an empty date or say "Total" in the first column
+		if isTotal(record, dateColumn) {
+			continue
+		}
+
+		row, err := exportRow(columns, record)
+		if err != nil {
+			if parseError, ok := err.(*myrevenue.ParseError); ok {
+				parseError.Row = line
+			}
+			return models, err
+		}
+
+		model, err := rr.convertRow(row, loc)
+		if err != nil {
+			return models, &myrevenue.ParseError{Network: rr.GetName(), Row: line, Err: err}
+		}
+		model.Currency = currency
+
+		models = append(models, model)
+	}
+
+	return models, nil
+}
+
+func isTotal(record []string, dateColumn int) bool {
+	if len(record) > 0 && strings.HasPrefix(strings.ToLower(strings.TrimSpace(record[0])), "total") {
+		return true
+	}
+
+	if dateColumn >= 0 {
+		if dateColumn >= len(record) {
+			return true
+		}
+		date := strings.ToLower(strings.TrimSpace(record[dateColumn]))
+		return date == "" || strings.HasPrefix(date, "total")
+	}
+
+	return false
+}
+
+func exportRow(columns []string, record []string) (ReportRow, error) {
+	row := ReportRow{
+		DimensionValues: make(map[string]DimensionValue),
+		MetricValues:    make(map[string]MetricValue),
+	}
+
+	for i, column := range columns {
+		if i >= len(record) {
+			break
+		}
+		value := strings.TrimSpace(record[i])
+		if value == "" {
+			continue
+		}
+
+		if dimension, found := exportDimensions[column]; found {
+			if dimension == DATE {
+				day, err := parseExportDate(value)
+				if err != nil {
+					return row, &myrevenue.ParseError{Network: ReportRequester{}.GetName(), Column: column, Err: err}
+				}
+				value = day.Format("20060102")
+			}
+			row.DimensionValues[dimension] = DimensionValue{Value: value}
+			continue
+		}
+
+		metric, found := exportMetrics[column]
+		if !found {
+			continue
+		}
+
+		value = strings.Replace(value, ",", "", -1)
+		if metric == ESTIMATED_EARNINGS || metric == OBSERVED_ECPM {
+			amount, err := strconv.ParseFloat(strings.TrimLeft(value, "$€£¥"), 64)
+			if err != nil {
+				return row, &myrevenue.ParseError{Network: ReportRequester{}.GetName(), Column: column, Err: err}
+			}
+			row.MetricValues[metric] = MetricValue{MicrosValue: strconv.FormatInt(int64(math.Round(amount*1e6)), 10)}
+		} else {
+			row.MetricValues[metric] = MetricValue{IntegerValue: value}
+		}
+	}
+
+	return row, nil
+}
+
+func parseExportDate(value string) (time.Time, error) {
+	var err error
+	for _, format := range exportDateFormats {
+		var day time.Time
+		if day, err = time.Parse(format, value); err == nil {
+			return day, nil
+		}
+	}
+	return time.Time{}, err
+}
@@ -0,0 +1,66 @@
+package admob
+
+import (
+	"errors"
+	"github.com/econnelly/myrevenue"
+	"strings"
+	"testing"
+)
+
+const exportHeader = "Date,Country,Ad requests,Matched requests,Impressions,Clicks,Estimated earnings (EUR)\n"
+
+func TestParseRevenueExport(t *testing.T) {
+	export := exportHeader +
+		"2018-10-01,DE,\"1,000\",900,800,8,\"1,234.56\"\n" +
+		"Total,,1000,900,800,8,1234.56\n" +
+		",,1000,900,800,8,1234.56\n"
+
+	models, err := ReportParser{}.ParseRevenue(strings.NewReader(export))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(models) != 1 {
+		t.Fatalf("got %v models, want 1 without the totals rows", len(models))
+	}
+
+	m := models[0]
+	if m.Country != "DE" || m.Requests != 1000 || m.Impressions != 800 || m.Revenue != 1234.56 || m.Currency != "EUR" {
+		t.Errorf("model = %+v", m)
+	}
+	if m.DateTime.Format("2006-01-02") != "2018-10-01" {
+		t.Errorf("DateTime = %v", m.DateTime)
+	}
+}
+
+func TestParseRevenueBadDate(t *testing.T) {
+	export := exportHeader +
+		"2018-10-01,DE,1000,900,800,8,1.00\n" +
+		"2024-13-45,US,1000,900,800,8,2.00\n"
+
+	models, err := ReportParser{}.ParseRevenue(strings.NewReader(export))
+
+	var parseError *myrevenue.ParseError
+	if !errors.As(err, &parseError) {
+		t.Fatalf("ParseRevenue() error = %v, want a ParseError", err)
+	}
+
+	if parseError.Row != 3 || parseError.Column != "date" {
+		t.Errorf("error at row %v, column %q, want row 3, column \"date\"", parseError.Row, parseError.Column)
+	}
+
+	if len(models) != 1 {
+		t.Errorf("got %v models before the error, want 1", len(models))
+	}
+}
+
+func TestParseRevenueBadEarnings(t *testing.T) {
+	export := exportHeader + "2018-10-01,DE,1000,900,800,8,n/a\n"
+
+	_, err := ReportParser{}.ParseRevenue(strings.NewReader(export))
+
+	var parseError *myrevenue.ParseError
+	if !errors.As(err, &parseError) || parseError.Row != 2 || parseError.Column != "estimated earnings" {
+		t.Errorf("ParseRevenue() error = %v, want a ParseError for row 2's earnings", err)
+	}
+}
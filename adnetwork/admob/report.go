@@ -2,31 +2,36 @@ package admob
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
 	"github.com/econnelly/myrevenue"
 	"github.com/econnelly/myrevenue/adnetwork"
+	"github.com/econnelly/myrevenue/adnetwork/oauth"
 	"io"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"net/url"
 	"strconv"
-	"strings"
 	"time"
 )
 
 type ReportRequester struct {
-	PublisherID  string `json:"publisher_id"`
-	ClientID     string `json:"client_id"`
-	ClientSecret string `json:"client_secret"`
-	RefreshToken string `json:"refresh_token"`
+	PublisherID  string   `json:"publisher_id"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	RefreshToken string   `json:"refresh_token"`
+	Dimensions   []string `json:"dimensions"` // Defaults to DATE and COUNTRY
+	Metrics      []string `json:"metrics"`    // Defaults to every supported metric
+	Mediation    bool     `json:"mediation"`  // Fetch the mediation report instead of the network report
 	StartDate    time.Time
 	EndDate      time.Time
+	TokenFile    string           `json:"token_file"` // Optional, the file admob-auth saved tokens to
+	TokenStore   oauth.TokenStore `json:"-"`          // Optional, persists access and rotated refresh tokens; overrides TokenFile
 	adnetwork.Request
 
-	authToken string
-	reportURL string
+	tokens      *oauth.Manager
+	authToken   string
+	reportURL   string
+	reportQuery string
 
 	rawData ReportResponse
 }
@@ -39,19 +44,67 @@ type TokenResponse struct {
 	TokenType    string `json:"token_type"`
 }
 
-type ReportResponse struct {
-	Kind             string `json:"kind"`
-	TotalMatchedRows string `json:"totalMatchedRows"`
-	Headers          []struct {
-		Name     string `json:"name"`
-		Type     string `json:"type"`
-		Currency string `json:"currency,omitempty"`
-	} `json:"headers"`
-	Rows      [][]string    `json:"rows"`
-	Totals    []string      `json:"totals"`
-	Averages  []interface{} `json:"averages"`
-	StartDate string        `json:"startDate"`
-	EndDate   string        `json:"endDate"`
+type Date struct {
+	Year  int `json:"year"`
+	Month int `json:"month"`
+	Day   int `json:"day"`
+}
+
+type DateRange struct {
+	StartDate Date `json:"startDate"`
+	EndDate   Date `json:"endDate"`
+}
+
+type LocalizationSettings struct {
+	CurrencyCode string `json:"currencyCode,omitempty"`
+	LanguageCode string `json:"languageCode,omitempty"`
+}
+
+type ReportSpec struct {
+	DateRange            DateRange             `json:"dateRange"`
+	Dimensions           []string              `json:"dimensions"`
+	Metrics              []string              `json:"metrics"`
+	LocalizationSettings *LocalizationSettings `json:"localizationSettings,omitempty"`
+}
+
+type RequestData struct {
+	ReportSpec ReportSpec `json:"reportSpec"`
+}
+
+type DimensionValue struct {
+	Value        string `json:"value"`
+	DisplayLabel string `json:"displayLabel,omitempty"`
+}
+
+// MetricValue holds exactly one of its fields. Integer and micros values are
+// int64s, which the API encodes as JSON strings.
+type MetricValue struct {
+	IntegerValue string  `json:"integerValue,omitempty"`
+	DoubleValue  float64 `json:"doubleValue,omitempty"`
+	MicrosValue  string  `json:"microsValue,omitempty"`
+}
+
+type ReportHeader struct {
+	DateRange            DateRange            `json:"dateRange"`
+	LocalizationSettings LocalizationSettings `json:"localizationSettings"`
+	ReportingTimeZone    string               `json:"reportingTimeZone"`
+}
+
+type ReportRow struct {
+	DimensionValues map[string]DimensionValue `json:"dimensionValues"`
+	MetricValues    map[string]MetricValue    `json:"metricValues"`
+}
+
+type ReportFooter struct {
+	MatchingRowCount string `json:"matchingRowCount"`
+}
+
+// ReportResponse is the streamed JSON array returned by the generate
+// endpoints: a header, zero or more rows, then a footer
+type ReportResponse []struct {
+	Header *ReportHeader `json:"header,omitempty"`
+	Row    *ReportRow    `json:"row,omitempty"`
+	Footer *ReportFooter `json:"footer,omitempty"`
 }
 
 type TokenErrorResponse struct {
@@ -70,64 +123,129 @@ type GenericErrorResponse struct {
 		} `json:"errors"`
 		Code    int    `json:"code"`
 		Message string `json:"message"`
+		Status  string `json:"status"`
 	} `json:"error"`
 }
 
+// Dimensions
 const (
-	EARNINGS     = "EARNINGS"
-	IMPRESSIONS  = "IMPRESSIONS"
-	AD_REQUESTS  = "AD_REQUESTS"
-	CLICKS       = "CLICKS"
-	COUNTRY_CODE = "COUNTRY_CODE"
+	DATE     = "DATE"
+	APP      = "APP"
+	AD_UNIT  = "AD_UNIT"
+	COUNTRY  = "COUNTRY"
+	FORMAT   = "FORMAT"
+	PLATFORM = "PLATFORM"
+
+	// Mediation report only
+	AD_SOURCE          = "AD_SOURCE"
+	AD_SOURCE_INSTANCE = "AD_SOURCE_INSTANCE"
+	MEDIATION_GROUP    = "MEDIATION_GROUP"
+)
+
+// Metrics
+const (
+	ESTIMATED_EARNINGS = "ESTIMATED_EARNINGS"
+	AD_REQUESTS        = "AD_REQUESTS"
+	MATCHED_REQUESTS   = "MATCHED_REQUESTS"
+	IMPRESSIONS        = "IMPRESSIONS"
+	CLICKS             = "CLICKS"
+
+	// Mediation report only
+	OBSERVED_ECPM = "OBSERVED_ECPM"
 )
 
 func (rr *ReportRequester) Initialize() error {
-	rr.authToken = rr.fetchAuthToken()
-	if rr.authToken == "" {
-		log.Fatal("Empty auth token")
-		return errors.New("empty auth token")
+	if rr.TokenStore == nil && rr.TokenFile != "" {
+		rr.TokenStore = oauth.NewFileStore(rr.TokenFile)
+	}
+
+	rr.tokens = oauth.Shared(rr.tokenKey(), rr.RefreshToken, rr.TokenStore, rr.fetchAuthToken)
+
+	var err error
+	rr.authToken, err = rr.tokens.AccessToken()
+	if err != nil {
+		return err
+	}
+	rr.RefreshToken = rr.tokens.RefreshToken()
+
+	report := "networkReport"
+	if rr.Mediation {
+		report = "mediationReport"
 	}
 
 	requestUrl := url.URL{
 		Scheme: "https",
-		Host:   "www.googleapis.com",
-		Path:   fmt.Sprintf("adsense/v1.4/accounts/%v/reports", rr.PublisherID),
+		Host:   "admob.googleapis.com",
+		Path:   fmt.Sprintf("v1/accounts/%v/%v:generate", rr.PublisherID, report),
 	}
+	rr.reportURL = requestUrl.String()
 
-	startDate := fmt.Sprintf("%04d-%02d-%02d", rr.StartDate.Year(), int(rr.EndDate.Month()), rr.StartDate.Day())
-	endDate := fmt.Sprintf("%04d-%02d-%02d", rr.EndDate.Year(), int(rr.EndDate.Month()), rr.EndDate.Day())
+	query, err := json.Marshal(RequestData{ReportSpec: rr.reportSpec()})
+	if err != nil {
+		return err
+	}
+	rr.reportQuery = string(query)
+
+	return nil
+}
 
-	query := url.Values{}
-	query.Set("startDate", startDate)
-	query.Add("endDate", endDate)
-	query.Add("dimension", COUNTRY_CODE)
-	query.Add("metric", EARNINGS)
-	query.Add("metric", IMPRESSIONS)
-	query.Add("metric", AD_REQUESTS)
-	query.Add("metric", CLICKS)
+func (rr ReportRequester) reportSpec() ReportSpec {
+	dimensions := rr.Dimensions
+	if len(dimensions) == 0 {
+		if rr.Mediation {
+			dimensions = []string{DATE, AD_SOURCE, AD_SOURCE_INSTANCE}
+		} else {
+			dimensions = []string{DATE, COUNTRY}
+		}
+	} else if rr.Mediation && !contains(dimensions, AD_SOURCE) {
+		// Mediation rows are meaningless without knowing which source filled them
+		dimensions = append([]string{AD_SOURCE}, dimensions...)
+	}
 
-	rr.reportURL = fmt.Sprintf("%v?%v", requestUrl.String(), query.Encode())
+	metrics := rr.Metrics
+	if len(metrics) == 0 {
+		metrics = []string{ESTIMATED_EARNINGS, AD_REQUESTS, MATCHED_REQUESTS, IMPRESSIONS, CLICKS}
+		if rr.Mediation {
+			metrics = append(metrics, OBSERVED_ECPM)
+		}
+	}
 
-	return nil
+	return ReportSpec{
+		DateRange: DateRange{
+			StartDate: Date{Year: rr.StartDate.Year(), Month: int(rr.StartDate.Month()), Day: rr.StartDate.Day()},
+			EndDate:   Date{Year: rr.EndDate.Year(), Month: int(rr.EndDate.Month()), Day: rr.EndDate.Day()},
+		},
+		Dimensions: dimensions,
+		Metrics:    metrics,
+	}
 }
 
 func (rr *ReportRequester) Fetch() ([]myrevenue.Model, error) {
 	headers := map[string]string{
 		"Accept":        "application/json; charset=utf-8",
+		"Content-Type":  "application/json",
 		"Authorization": fmt.Sprintf("Bearer %v", rr.authToken),
 	}
 
-	resp, err := myrevenue.GetRequest(rr.reportURL, headers, false)
+	resp, err := myrevenue.PostRequest(rr.reportURL, headers, rr.reportQuery, false)
 
 	if err != nil {
 		return nil, err
 	}
 
 	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized {
+		rr.tokens.Invalidate()
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, rr.parseError(resp.Body)
+	}
+
 	return rr.parse(resp.Body)
 }
 
-func (rr ReportRequester) parse(r io.Reader) ([]myrevenue.Model, error) {
+func (rr *ReportRequester) parse(r io.Reader) ([]myrevenue.Model, error) {
 	result := ReportResponse{}
 
 	body, err := ioutil.ReadAll(r)
@@ -140,95 +258,205 @@ func (rr ReportRequester) parse(r io.Reader) ([]myrevenue.Model, error) {
 		return nil, e
 	}
 
+	rr.rawData = result
 	return rr.convertToReportModel(result)
 }
 
+func (rr ReportRequester) parseError(r io.Reader) error {
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	// Errors raised mid-stream are wrapped in a single element array
+	var streamed []GenericErrorResponse
+	if json.Unmarshal(body, &streamed) == nil && len(streamed) > 0 {
+		return fmt.Errorf("%v: %v (%v)", rr.GetName(), streamed[0].Error.Message, streamed[0].Error.Code)
+	}
+
+	result := GenericErrorResponse{}
+	if e := json.Unmarshal(body, &result); e != nil {
+		return fmt.Errorf("%v: %v", rr.GetName(), string(body))
+	}
+
+	return fmt.Errorf("%v: %v (%v)", rr.GetName(), result.Error.Message, result.Error.Code)
+}
+
 func (rr ReportRequester) convertToReportModel(r ReportResponse) ([]myrevenue.Model, error) {
-	headers := make(map[string]int)
-	for i, h := range r.Headers {
-		headers[h.Name] = i
+	loc, e := time.LoadLocation("Etc/UTC")
+	if e != nil {
+		return nil, e
 	}
 
-	reportModels := make([]myrevenue.Model, len(r.Rows))
-	for i, result := range r.Rows {
-		reportModels[i].NetworkName = rr.GetName()
-		impressions, err := strconv.ParseUint(result[headers[IMPRESSIONS]], 10, 64)
-		if err == nil {
-			reportModels[i].Impressions = impressions
+	// Earnings are in the account's currency, given in the header
+	currency := ""
+
+	reportModels := make([]myrevenue.Model, 0, len(r))
+	for _, item := range r {
+		if item.Header != nil {
+			if item.Header.ReportingTimeZone != "" {
+				if l, err := time.LoadLocation(item.Header.ReportingTimeZone); err == nil {
+					loc = l
+				}
+			}
+			currency = item.Header.LocalizationSettings.CurrencyCode
 		}
 
-		revenue, err := strconv.ParseFloat(result[headers[EARNINGS]], 64)
-		if err == nil {
-			reportModels[i].Revenue = revenue
+		if item.Row == nil {
+			continue
 		}
 
-		requests, err := strconv.ParseUint(result[headers[AD_REQUESTS]], 10, 64)
-		if err == nil {
-			reportModels[i].Requests = requests
+		model, err := rr.convertRow(*item.Row, loc)
+		if err != nil {
+			return nil, err
 		}
+		model.Currency = currency
 
-		clicks, err := strconv.ParseUint(result[headers[CLICKS]], 10, 64)
-		if err == nil {
-			reportModels[i].Clicks = clicks
-		}
+		reportModels = append(reportModels, model)
+	}
+
+	return reportModels, nil
+}
 
-		index, found := headers[COUNTRY_CODE]
-		if found {
-			country := result[index]
-			reportModels[i].Country = country
+func (rr ReportRequester) convertRow(row ReportRow, loc *time.Location) (myrevenue.Model, error) {
+	model := myrevenue.Model{}
+	model.NetworkName = rr.GetName()
+
+	if d, found := row.DimensionValues[DATE]; found {
+		day, err := time.ParseInLocation("20060102", d.Value, loc)
+		if err != nil {
+			return model, err
 		}
+		model.DateTime = day
+	} else {
+		model.DateTime = time.Date(rr.StartDate.Year(), rr.StartDate.Month(), rr.StartDate.Day(), 0, 0, 0, 0, loc)
+	}
 
-		loc, e := time.LoadLocation("Etc/UTC")
-		if e != nil {
-			return nil, e
+	model.App = row.DimensionValues[APP].Value
+	model.AdUnit = row.DimensionValues[AD_UNIT].Value
+	model.Country = row.DimensionValues[COUNTRY].Value
+	model.Format = row.DimensionValues[FORMAT].Value
+	model.Platform = row.DimensionValues[PLATFORM].Value
+	model.AdSource = label(row.DimensionValues[AD_SOURCE])
+	model.AdSourceInstance = label(row.DimensionValues[AD_SOURCE_INSTANCE])
+
+	var err error
+	if model.Revenue, err = microsValue(row.MetricValues[ESTIMATED_EARNINGS]); err != nil {
+		return model, err
+	}
+
+	if model.Requests, err = integerValue(row.MetricValues[AD_REQUESTS]); err != nil {
+		return model, err
+	}
+
+	if model.Impressions, err = integerValue(row.MetricValues[IMPRESSIONS]); err != nil {
+		return model, err
+	}
+
+	if model.Clicks, err = integerValue(row.MetricValues[CLICKS]); err != nil {
+		return model, err
+	}
+
+	if v, found := row.MetricValues[MATCHED_REQUESTS]; found {
+		matched, err := integerValue(v)
+		if err != nil {
+			return model, err
 		}
+		model.SetExtendedMetric(MATCHED_REQUESTS, float64(matched))
+	}
 
-		day, err := time.ParseInLocation("2006-01-02", r.StartDate, loc)
+	if v, found := row.MetricValues[OBSERVED_ECPM]; found {
+		ecpm, err := microsValue(v)
 		if err != nil {
-			return nil, err
-		} else {
-			reportModels[i].DateTime = day
+			return model, err
 		}
+		model.SetExtendedMetric(OBSERVED_ECPM, ecpm)
 	}
 
-	return reportModels, nil
+	if model.Impressions > 0 {
+		model.CTR = float64(model.Clicks) / float64(model.Impressions)
+		model.ECPM = model.Revenue / float64(model.Impressions) * 1000
+	}
+
+	return model, nil
+}
+
+// label prefers the human readable name of a dimension, e.g. an ad source's
+// "Meta Audience Network" rather than its numeric ID
+func label(v DimensionValue) string {
+	if v.DisplayLabel != "" {
+		return v.DisplayLabel
+	}
+	return v.Value
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func integerValue(v MetricValue) (uint64, error) {
+	if v.IntegerValue == "" {
+		return 0, nil
+	}
+
+	return strconv.ParseUint(v.IntegerValue, 10, 64)
 }
 
-func (rr ReportRequester) fetchAuthToken() string {
+// microsValue converts a micros amount (1,000,000 micros = 1 unit of currency)
+func microsValue(v MetricValue) (float64, error) {
+	if v.MicrosValue == "" {
+		return 0, nil
+	}
+
+	micros, err := strconv.ParseInt(v.MicrosValue, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	return float64(micros) / 1e6, nil
+}
+
+func (rr ReportRequester) fetchAuthToken(refreshToken string) (oauth.Response, error) {
 	baseUrl := "https://accounts.google.com"
 	resource := "/o/oauth2/token"
 	body := url.Values{}
 	body.Set("client_id", rr.ClientID)
 	body.Add("client_secret", rr.ClientSecret)
 	body.Add("grant_type", "refresh_token")
-	body.Add("refresh_token", rr.RefreshToken)
+	body.Add("refresh_token", refreshToken)
 
 	requestUrl, _ := url.ParseRequestURI(baseUrl)
 	requestUrl.Path = resource
 
-	client := &http.Client{}
-	r, err := http.NewRequest(http.MethodPost, requestUrl.String(), strings.NewReader(body.Encode()))
-	if err != nil {
-		log.Fatalln(err)
-		return ""
+	headers := map[string]string{
+		"Content-Type": "application/x-www-form-urlencoded; charset=utf-8",
 	}
 
-	r.Header.Add("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
-
-	resp, err := client.Do(r)
+	resp, err := myrevenue.PostRequest(requestUrl.String(), headers, body.Encode(), false)
 	if err != nil {
-		return ""
+		return oauth.Response{}, err
 	}
 
-	authModel, _, err := rr.unmarshalAuth(resp.Body)
+	authModel, authError, err := rr.unmarshalAuth(resp.Body)
 	defer resp.Body.Close()
 	if err != nil {
-		log.Println(err)
-		return ""
+		return oauth.Response{}, err
 	}
 
-	rr.RefreshToken = authModel.RefreshToken
-	return authModel.AccessToken
+	if authModel.AccessToken == "" {
+		return oauth.Response{}, fmt.Errorf("%v: %v (%v)", rr.GetName(), authError.ErrorDescription, authError.Error)
+	}
+
+	return oauth.Response{
+		AccessToken:  authModel.AccessToken,
+		RefreshToken: authModel.RefreshToken,
+		ExpiresIn:    authModel.ExpiresIn,
+	}, nil
 }
 
 func (rr ReportRequester) unmarshalAuth(r io.ReadCloser) (TokenResponse, TokenErrorResponse, error) {
@@ -240,7 +468,7 @@ func (rr ReportRequester) unmarshalAuth(r io.ReadCloser) (TokenResponse, TokenEr
 	}
 
 	e = json.Unmarshal(body, &result)
-	if e != nil {
+	if e != nil || result.AccessToken == "" {
 		authError := TokenErrorResponse{}
 		e = json.Unmarshal(body, &authError)
 		if e != nil {
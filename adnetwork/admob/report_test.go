@@ -0,0 +1,149 @@
+package admob
+
+import (
+	"math"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseNetworkReport(t *testing.T) {
+	f, err := os.Open("testdata/network_report.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	rr := &ReportRequester{}
+	models, err := rr.parse(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The header and footer don't produce models
+	if len(models) != 2 {
+		t.Fatalf("got %v models, want 2", len(models))
+	}
+
+	m := models[0]
+	if math.Abs(m.Revenue-12.345678) > 1e-9 {
+		t.Errorf("Revenue = %v, want 12.345678 from micros", m.Revenue)
+	}
+	if m.Requests != 20000 || m.Impressions != 15000 || m.Clicks != 150 {
+		t.Errorf("Requests, Impressions, Clicks = %v, %v, %v", m.Requests, m.Impressions, m.Clicks)
+	}
+	if m.ExtendedMetrics[MATCHED_REQUESTS] != 18000 {
+		t.Errorf("matched requests = %v, want 18000", m.ExtendedMetrics[MATCHED_REQUESTS])
+	}
+	if m.Currency != "EUR" {
+		t.Errorf("Currency = %q, want the header's currency code", m.Currency)
+	}
+	if m.Country != "US" || m.Format != "BANNER" || m.Platform != "Android" {
+		t.Errorf("dimensions = %v, %v, %v", m.Country, m.Format, m.Platform)
+	}
+	if math.Abs(m.ECPM-12.345678/15000*1000) > 1e-9 {
+		t.Errorf("ECPM = %v", m.ECPM)
+	}
+
+	// Dates are days in the account's reporting time zone
+	if got := m.DateTime.Location().String(); got != "America/Los_Angeles" {
+		t.Errorf("location = %v, want the header's reporting time zone", got)
+	}
+	if got := m.DateTime.Format("2006-01-02 15:04 MST"); got != "2018-09-30 00:00 PDT" {
+		t.Errorf("DateTime = %v", got)
+	}
+
+	m = models[1]
+	if m.Revenue != 0.5 || m.Clicks != 0 || m.CTR != 0 || m.ECPM != 0 || m.Currency != "EUR" {
+		t.Errorf("second row = %+v", m)
+	}
+	if _, found := m.ExtendedMetrics[MATCHED_REQUESTS]; found {
+		t.Error("missing metrics shouldn't be reported as extended metrics")
+	}
+
+	if len(rr.GetReport().(ReportResponse)) != 4 {
+		t.Error("the raw report should keep the header, rows and footer")
+	}
+}
+
+func TestParseRejectsBadIntegerValue(t *testing.T) {
+	report := `[{"row": {"dimensionValues": {"DATE": {"value": "20180930"}}, "metricValues": {"CLICKS": {"integerValue": "lots"}}}}]`
+
+	rr := &ReportRequester{}
+	if _, err := rr.parse(strings.NewReader(report)); err == nil {
+		t.Error("expected an error for a non-numeric integerValue")
+	}
+}
+
+func TestParseErrorMidStream(t *testing.T) {
+	f, err := os.Open("testdata/stream_error.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	err = ReportRequester{}.parseError(f)
+	if err == nil || !strings.Contains(err.Error(), "Request contains an invalid argument. (400)") {
+		t.Errorf("parseError = %v", err)
+	}
+}
+
+func TestParseErrorObject(t *testing.T) {
+	body := `{"error": {"code": 401, "message": "Request had invalid authentication credentials.", "status": "UNAUTHENTICATED"}}`
+
+	err := ReportRequester{}.parseError(strings.NewReader(body))
+	if err == nil || !strings.Contains(err.Error(), "invalid authentication credentials. (401)") {
+		t.Errorf("parseError = %v", err)
+	}
+}
+
+func TestParseMediationReport(t *testing.T) {
+	f, err := os.Open("testdata/mediation_report.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	rr := &ReportRequester{Mediation: true}
+	models, err := rr.parse(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(models) != 2 {
+		t.Fatalf("got %v models, want 2", len(models))
+	}
+
+	// Sources are named by their display label, falling back to the ID
+	m := models[0]
+	if m.AdSource != "Meta Audience Network" || m.AdSourceInstance != "Meta Audience Network (default)" {
+		t.Errorf("AdSource, AdSourceInstance = %q, %q", m.AdSource, m.AdSourceInstance)
+	}
+	if m.Revenue != 4.5 || m.ExtendedMetrics[OBSERVED_ECPM] != 2.25 || m.ExtendedMetrics[MATCHED_REQUESTS] != 2500 {
+		t.Errorf("model = %+v", m)
+	}
+	if models[1].AdSource != "5450213213286189855" || models[1].AdSourceInstance != "" {
+		t.Errorf("AdSource, AdSourceInstance = %q, %q", models[1].AdSource, models[1].AdSourceInstance)
+	}
+}
+
+func TestReportSpec(t *testing.T) {
+	tests := []struct {
+		rr         ReportRequester
+		dimensions []string
+		metrics    int
+	}{
+		{ReportRequester{}, []string{DATE, COUNTRY}, 5},
+		{ReportRequester{Mediation: true}, []string{DATE, AD_SOURCE, AD_SOURCE_INSTANCE}, 6},
+		// Mediation rows always say which source filled them
+		{ReportRequester{Mediation: true, Dimensions: []string{DATE, APP}}, []string{AD_SOURCE, DATE, APP}, 6},
+		{ReportRequester{Dimensions: []string{DATE, APP}, Metrics: []string{CLICKS}}, []string{DATE, APP}, 1},
+	}
+
+	for i, test := range tests {
+		spec := test.rr.reportSpec()
+		if strings.Join(spec.Dimensions, ",") != strings.Join(test.dimensions, ",") || len(spec.Metrics) != test.metrics {
+			t.Errorf("spec %v = %v, %v", i, spec.Dimensions, spec.Metrics)
+		}
+	}
+}
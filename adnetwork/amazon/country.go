@@ -0,0 +1,53 @@
+package amazon
+
+import "strings"
+
+// regionCodes maps the region and marketplace names used in Amazon exports to
+// ISO 3166-1 alpha-2 codes
+var regionCodes = map[string]string{
+	"united states":  "US",
+	"usa":            "US",
+	"amazon.com":     "US",
+	"united kingdom": "GB",
+	"uk":             "GB",
+	"amazon.co.uk":   "GB",
+	"germany":        "DE",
+	"amazon.de":      "DE",
+	"france":         "FR",
+	"amazon.fr":      "FR",
+	"italy":          "IT",
+	"amazon.it":      "IT",
+	"spain":          "ES",
+	"amazon.es":      "ES",
+	"japan":          "JP",
+	"amazon.co.jp":   "JP",
+	"canada":         "CA",
+	"amazon.ca":      "CA",
+	"brazil":         "BR",
+	"amazon.com.br":  "BR",
+	"mexico":         "MX",
+	"amazon.com.mx":  "MX",
+	"india":          "IN",
+	"amazon.in":      "IN",
+	"australia":      "AU",
+	"amazon.com.au":  "AU",
+	"netherlands":    "NL",
+	"amazon.nl":      "NL",
+	"china":          "CN",
+	"amazon.cn":      "CN",
+}
+
+// CountryCode converts an Amazon region name to an ISO country code. Values
+// that are already codes are upper cased and unknown names are returned as is.
+func CountryCode(region string) string {
+	region = strings.TrimSpace(region)
+	if code, found := regionCodes[strings.ToLower(region)]; found {
+		return code
+	}
+
+	if len(region) == 2 {
+		return strings.ToUpper(region)
+	}
+
+	return region
+}
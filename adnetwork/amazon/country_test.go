@@ -0,0 +1,24 @@
+package amazon
+
+import "testing"
+
+func TestCountryCode(t *testing.T) {
+	tests := []struct {
+		region string
+		want   string
+	}{
+		{"United States", "US"},
+		{"amazon.co.jp", "JP"},
+		{" UK ", "GB"},
+		{"de", "DE"},
+		{"US", "US"},
+		{"Atlantis", "Atlantis"},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		if got := CountryCode(test.region); got != test.want {
+			t.Errorf("CountryCode(%q) = %q, want %q", test.region, got, test.want)
+		}
+	}
+}
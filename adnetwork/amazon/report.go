@@ -6,8 +6,8 @@ import (
 	"github.com/econnelly/myrevenue/adnetwork"
 	"github.com/pkg/errors"
 	"io"
-	"log"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -19,109 +19,210 @@ type ReportResponse struct {
 	Data [][]string
 }
 
+// Columns that may hold each dimension, depending on which export layout
+// (by app, by ad unit or by marketplace) was downloaded
+var (
+	countryColumns = []string{"Region", "Marketplace", "Country"}
+	appColumns     = []string{"App", "App Name", "Application"}
+	adUnitColumns  = []string{"Ad Unit", "Ad Unit Name", "Slot", "Placement"}
+)
+
+const (
+	EARNINGS_PREFIX = "Ad Earnings ("
+	ECPM_PREFIX     = "eCPM ("
+)
+
+// header describes the column layout found in an export
+type header struct {
+	columns  map[string]int
+	earnings string
+	ecpm     string
+	currency string
+}
+
 func (r ReportParser) ParseRevenue(reader io.Reader) ([]myrevenue.Model, error) {
 	models := make([]myrevenue.Model, 0)
-	headerMap := make(map[string]int, 12)
-	ch := make(chan []string)
 	if reader == nil {
 		return nil, errors.New("reader is nil")
 	}
 
-	go func() {
-		r := csv.NewReader(reader)
-		r.FieldsPerRecord = -1
-		r.TrimLeadingSpace = true
-
-		// Skip the first 4 lines of Amazon's CSV
-		r.Read()
-		r.Read()
-		r.Read()
+	csvReader := csv.NewReader(reader)
+	csvReader.FieldsPerRecord = -1
+	csvReader.TrimLeadingSpace = true
 
-		headers, err := r.Read()
-		if err != nil { //read header
-			log.Printf("fatal: %v", err)
-			ch <- nil
-			return
+	var h *header
+	for row := 1; ; row++ {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return models, &myrevenue.ParseError{Network: "Amazon", Row: row, Err: err}
 		}
-		for index, header := range headers {
-			// Ad Earnings and eCPM headers contain currency type, but we don't want mixed currency in our revenue data
-
-			//var key string
-			//if strings.Contains(header, "Ad Earnings") {
-			//	key = "Earnings"
-			//} else if strings.Contains(header, "eCPM") {
-			//	key = "eCPM"
-			//} else {
-			//	key = header
-			//}
-			headerMap[header] = index
+
+		// Amazon prefixes the export with a title and the date range, so the
+		// header is the first row that looks like one
+		if h == nil {
+			h = findHeader(record)
+			continue
 		}
-		defer close(ch)
-		for {
-			rec, err := r.Read()
-			if err != nil {
-				if err == io.EOF {
-					ch <- nil
-					break
-				}
-				log.Fatal(err)
 
-			}
-			ch <- rec
+		if isBlank(record) || strings.EqualFold(strings.TrimSpace(record[0]), "Total") {
+			continue
 		}
-	}()
 
-	for {
-		line := <-ch
-		if line == nil {
-			break
-		} else {
-			model, err := stringArrayToModel(headerMap, line)
-			if err == nil {
-				models = append(models, model)
-			} else {
-				return models, err
+		model, err := stringArrayToModel(*h, record)
+		if err != nil {
+			if parseError, ok := err.(*myrevenue.ParseError); ok {
+				parseError.Row = row
 			}
+			return models, err
 		}
+		models = append(models, model)
+	}
+
+	if h == nil {
+		return nil, errors.New("Amazon: no header row with Date and Ad Earnings columns found")
 	}
 
 	return models, nil
 }
 
-func stringArrayToModel(headers map[string]int, revenues []string) (myrevenue.Model, error) {
-	revenue := myrevenue.Model{}
-	if len(headers) != len(revenues) {
-		return revenue, errors.New("header size must match revenues size")
+func findHeader(record []string) *header {
+	h := header{columns: make(map[string]int, len(record))}
+	for index, column := range record {
+		column = strings.TrimSpace(column)
+		h.columns[column] = index
+
+		if strings.HasPrefix(column, EARNINGS_PREFIX) {
+			h.earnings = column
+			h.currency = currencyOf(column)
+		} else if strings.HasPrefix(column, ECPM_PREFIX) {
+			h.ecpm = column
+		}
+	}
+
+	if _, found := h.columns["Date"]; !found || h.earnings == "" {
+		return nil
 	}
 
+	return &h
+}
+
+// currencyOf extracts XXX from "Ad Earnings (XXX)"
+func currencyOf(column string) string {
+	start := strings.LastIndex(column, "(")
+	end := strings.LastIndex(column, ")")
+	if start < 0 || end <= start {
+		return ""
+	}
+	return strings.ToUpper(strings.TrimSpace(column[start+1 : end]))
+}
+
+func isBlank(record []string) bool {
+	for _, field := range record {
+		if strings.TrimSpace(field) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func stringArrayToModel(h header, revenues []string) (myrevenue.Model, error) {
+	revenue := myrevenue.Model{}
+	revenue.NetworkName = "Amazon"
+	revenue.Currency = h.currency
+
 	loc, err := time.LoadLocation("Etc/UTC")
 	if err != nil {
 		return revenue, err
 	}
 
-	day, err := time.ParseInLocation("01/02/2006", revenues[headers["Date"]], loc)
-	revenue.DateTime = day
-	revenue.Country = revenues[headers["Region"]]
+	field := func(column string) string {
+		index, found := h.columns[column]
+		if !found || index >= len(revenues) {
+			return ""
+		}
+		return strings.TrimSpace(revenues[index])
+	}
 
-	requests, err := strconv.ParseInt(revenues[headers["Requests"]], 10, 64)
-	if err != nil {
-		return revenue, err
+	firstField := func(columns []string) string {
+		for _, c := range columns {
+			if v := field(c); v != "" {
+				return v
+			}
+		}
+		return ""
 	}
-	revenue.Requests = uint64(requests)
 
-	impressions, err := strconv.ParseInt(revenues[headers["Impressions"]], 10, 64)
-	if err != nil {
-		return revenue, err
+	parseError := func(column string, err error) error {
+		return &myrevenue.ParseError{Network: revenue.NetworkName, Column: column, Err: err}
 	}
-	revenue.Impressions = uint64(impressions)
 
-	earnings, err := strconv.ParseFloat(revenues[headers["Ad Earnings (USD)"]], 64)
+	day, err := parseDate(field("Date"), loc)
 	if err != nil {
-		return revenue, err
+		return revenue, parseError("Date", err)
 	}
-	revenue.Revenue = float64(earnings)
+	revenue.DateTime = day
 
-	revenue.NetworkName = "Amazon"
+	revenue.Country = CountryCode(firstField(countryColumns))
+	revenue.App = firstField(appColumns)
+	revenue.AdUnit = firstField(adUnitColumns)
+
+	if revenue.Requests, err = parseCount(field("Requests")); err != nil {
+		return revenue, parseError("Requests", err)
+	}
+
+	if revenue.Impressions, err = parseCount(field("Impressions")); err != nil {
+		return revenue, parseError("Impressions", err)
+	}
+
+	if revenue.Clicks, err = parseCount(field("Clicks")); err != nil {
+		return revenue, parseError("Clicks", err)
+	}
+
+	if revenue.Revenue, err = parseAmount(field(h.earnings)); err != nil {
+		return revenue, parseError(h.earnings, err)
+	}
+
+	if h.ecpm != "" {
+		if revenue.ECPM, err = parseAmount(field(h.ecpm)); err != nil {
+			return revenue, parseError(h.ecpm, err)
+		}
+	}
+
+	if revenue.Impressions > 0 {
+		revenue.CTR = float64(revenue.Clicks) / float64(revenue.Impressions)
+	}
 
 	return revenue, nil
 }
+
+func parseDate(value string, loc *time.Location) (time.Time, error) {
+	day, err := time.ParseInLocation("01/02/2006", value, loc)
+	if err == nil {
+		return day, nil
+	}
+
+	if day, e := time.ParseInLocation("2006-01-02", value, loc); e == nil {
+		return day, nil
+	}
+
+	return day, err
+}
+
+func parseCount(value string) (uint64, error) {
+	value = strings.Replace(value, ",", "", -1)
+	if value == "" || value == "-" {
+		return 0, nil
+	}
+	return strconv.ParseUint(value, 10, 64)
+}
+
+func parseAmount(value string) (float64, error) {
+	value = strings.Replace(value, ",", "", -1)
+	value = strings.TrimLeft(value, "$€£¥")
+	if value == "" || value == "-" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(value, 64)
+}
@@ -0,0 +1,93 @@
+package amazon
+
+import (
+	"errors"
+	"github.com/econnelly/myrevenue"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseMarketplaceReport(t *testing.T) {
+	f, err := os.Open("testdata/marketplace_report.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	models, err := ReportParser{}.ParseRevenue(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The preamble, blank lines and totals don't produce models
+	if len(models) != 4 {
+		t.Fatalf("got %v models, want 4", len(models))
+	}
+
+	m := models[0]
+	if m.Currency != "GBP" {
+		t.Errorf("Currency = %q, want the earnings column's currency", m.Currency)
+	}
+	if m.Requests != 2000 || m.Impressions != 1500 || m.Clicks != 15 || m.Revenue != 3 || m.ECPM != 2 || m.CTR != 0.01 {
+		t.Errorf("first row = %+v", m)
+	}
+	if m.AdUnit != "Banner" || m.DateTime.Format("2006-01-02") != "2018-09-30" {
+		t.Errorf("AdUnit, DateTime = %v, %v", m.AdUnit, m.DateTime)
+	}
+
+	if models[1].Revenue != 0 || models[1].ECPM != 0 {
+		t.Errorf("dashes should read as 0, got %+v", models[1])
+	}
+	if models[2].DateTime.Format("2006-01-02") != "2018-10-01" {
+		t.Errorf("ISO dates should parse too, got %v", models[2].DateTime)
+	}
+
+	countries := []string{"GB", "DE", "Atlantis", "FR"}
+	for i, want := range countries {
+		if models[i].Country != want {
+			t.Errorf("row %v Country = %q, want %q", i, models[i].Country, want)
+		}
+	}
+}
+
+func TestParseBadRow(t *testing.T) {
+	tests := []struct {
+		row    string
+		column string
+	}{
+		{"10/01/2018,Example App,lots,1500,15,3.00,2.00", "Requests"},
+		{"10/01/2018,Example App,2000,-5,15,3.00,2.00", "Impressions"},
+		{"10/01/2018,Example App,2000,1500,15,three,2.00", "Ad Earnings (EUR)"},
+		{"10/01/2018,Example App,2000,1500,15,3.00,2.x", "eCPM (EUR)"},
+		{"Oct 1 2018,Example App,2000,1500,15,3.00,2.00", "Date"},
+	}
+
+	for _, test := range tests {
+		report := "Amazon Publisher Report\n" +
+			"Date,App,Requests,Impressions,Clicks,Ad Earnings (EUR),eCPM (EUR)\n" +
+			"10/01/2018,Example App,2000,1500,15,3.00,2.00\n" +
+			test.row + "\n"
+
+		models, err := ReportParser{}.ParseRevenue(strings.NewReader(report))
+
+		var parseErr *myrevenue.ParseError
+		if !errors.As(err, &parseErr) {
+			t.Errorf("%q: error = %v, want a *ParseError", test.row, err)
+			continue
+		}
+		if parseErr.Row != 4 || parseErr.Column != test.column {
+			t.Errorf("%q: error at row %v column %q, want row 4 column %q", test.row, parseErr.Row, parseErr.Column, test.column)
+		}
+		if len(models) != 1 {
+			t.Errorf("%q: got %v models before the bad row, want 1", test.row, len(models))
+		}
+	}
+}
+
+func TestParseNoHeader(t *testing.T) {
+	report := "Amazon Publisher Report\nDate,App,Requests\n10/01/2018,Example App,2000\n"
+	if _, err := (ReportParser{}).ParseRevenue(strings.NewReader(report)); err == nil {
+		t.Error("expected an error without an Ad Earnings column")
+	}
+}
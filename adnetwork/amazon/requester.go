@@ -0,0 +1,282 @@
+package amazon
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/econnelly/myrevenue"
+	"github.com/econnelly/myrevenue/adnetwork"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	DEFAULT_BASE_URL      = "https://reporting.amazon-adsystem.com"
+	DEFAULT_POLL_INTERVAL = 10 * time.Second
+	DEFAULT_MAX_POLLS     = 60
+)
+
+// Report generation states
+const (
+	PENDING     = "PENDING"
+	IN_PROGRESS = "IN_PROGRESS"
+	COMPLETED   = "COMPLETED"
+	FAILED      = "FAILED"
+)
+
+// Report groupings, matching the dashboard export layouts
+const (
+	BY_APP         = "app"
+	BY_AD_UNIT     = "adUnit"
+	BY_MARKETPLACE = "marketplace"
+)
+
+// ReportRequester generates a report through Amazon's publisher reporting
+// API, waits for it to complete, then downloads the CSV and parses it the
+// same way as a dashboard export
+type ReportRequester struct {
+	PublisherID  string        `json:"publisher_id"`
+	AccessKey    string        `json:"access_key"`
+	SecretKey    string        `json:"secret_key"`
+	GroupBy      string        `json:"group_by"` // BY_APP, BY_AD_UNIT or BY_MARKETPLACE. Defaults to BY_APP.
+	BaseURL      string        `json:"base_url"` // Defaults to DEFAULT_BASE_URL
+	PollInterval time.Duration `json:"poll_interval"`
+	MaxPolls     int           `json:"max_polls"`
+	StartDate    time.Time
+	EndDate      time.Time
+	adnetwork.Request
+
+	Clock myrevenue.Clock `json:"-"` // Defaults to myrevenue.SystemClock
+
+	reportQuery string
+	rawData     ReportStatus
+}
+
+type ReportQuery struct {
+	PublisherID string `json:"publisherId"`
+	StartDate   string `json:"startDate"`
+	EndDate     string `json:"endDate"`
+	GroupBy     string `json:"groupBy"`
+	Format      string `json:"format"`
+}
+
+type ReportStatus struct {
+	ReportID    string `json:"reportId"`
+	Status      string `json:"status"`
+	DownloadURL string `json:"downloadUrl"`
+	Message     string `json:"message"`
+}
+
+type ErrorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (rr *ReportRequester) Initialize() error {
+	if rr.AccessKey == "" || rr.SecretKey == "" {
+		return errors.New("Amazon: access key and secret key are required")
+	}
+
+	if rr.BaseURL == "" {
+		rr.BaseURL = DEFAULT_BASE_URL
+	}
+
+	if rr.GroupBy == "" {
+		rr.GroupBy = BY_APP
+	}
+
+	if rr.PollInterval == 0 {
+		rr.PollInterval = DEFAULT_POLL_INTERVAL
+	}
+
+	if rr.MaxPolls == 0 {
+		rr.MaxPolls = DEFAULT_MAX_POLLS
+	}
+
+	if rr.Clock == nil {
+		rr.Clock = myrevenue.SystemClock
+	}
+
+	query, err := json.Marshal(ReportQuery{
+		PublisherID: rr.PublisherID,
+		StartDate:   rr.StartDate.Format("2006-01-02"),
+		EndDate:     rr.EndDate.Format("2006-01-02"),
+		GroupBy:     rr.GroupBy,
+		Format:      "csv",
+	})
+	if err != nil {
+		return err
+	}
+	rr.reportQuery = string(query)
+
+	return nil
+}
+
+func (rr *ReportRequester) Fetch() ([]myrevenue.Model, error) {
+	status, err := rr.createReport()
+	if err != nil {
+		return nil, err
+	}
+
+	for polls := 0; status.Status != COMPLETED; polls++ {
+		if status.Status == FAILED {
+			return nil, errors.Errorf("Amazon: report %v failed: %v", status.ReportID, status.Message)
+		}
+
+		if polls >= rr.MaxPolls {
+			return nil, errors.Errorf("Amazon: report %v not ready after %v polls", status.ReportID, polls)
+		}
+
+		time.Sleep(rr.PollInterval)
+		if status, err = rr.reportStatus(status.ReportID); err != nil {
+			return nil, err
+		}
+	}
+
+	rr.rawData = status
+	return rr.download(status.DownloadURL)
+}
+
+func (rr ReportRequester) createReport() (ReportStatus, error) {
+	resp, err := rr.signedRequest(http.MethodPost, rr.BaseURL+"/v1/reports", rr.reportQuery)
+	if err != nil {
+		return ReportStatus{}, err
+	}
+	defer resp.Body.Close()
+
+	return rr.parseStatus(resp)
+}
+
+func (rr ReportRequester) reportStatus(reportID string) (ReportStatus, error) {
+	resp, err := rr.signedRequest(http.MethodGet, fmt.Sprintf("%v/v1/reports/%v", rr.BaseURL, url.PathEscape(reportID)), "")
+	if err != nil {
+		return ReportStatus{}, err
+	}
+	defer resp.Body.Close()
+
+	return rr.parseStatus(resp)
+}
+
+func (rr ReportRequester) download(downloadURL string) ([]myrevenue.Model, error) {
+	if downloadURL == "" {
+		return nil, errors.New("Amazon: completed report has no download URL")
+	}
+
+	// Download URLs are pre-signed, relative ones are served by the API itself
+	var resp *http.Response
+	var err error
+	if strings.HasPrefix(downloadURL, "/") {
+		resp, err = rr.signedRequest(http.MethodGet, rr.BaseURL+downloadURL, "")
+	} else {
+		resp, err = myrevenue.GetRequest(downloadURL, nil, false)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, rr.parseError(resp)
+	}
+
+	return ReportParser{}.ParseRevenue(resp.Body)
+}
+
+func (rr ReportRequester) parseStatus(resp *http.Response) (ReportStatus, error) {
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusAccepted {
+		return ReportStatus{}, rr.parseError(resp)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return ReportStatus{}, err
+	}
+
+	status := ReportStatus{}
+	if err := json.Unmarshal(body, &status); err != nil {
+		return ReportStatus{}, err
+	}
+
+	if status.ReportID == "" {
+		return ReportStatus{}, errors.New("Amazon: report response has no report ID")
+	}
+
+	return status, nil
+}
+
+func (rr ReportRequester) parseError(resp *http.Response) error {
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	result := ErrorResponse{}
+	if json.Unmarshal(body, &result) != nil || result.Message == "" {
+		return errors.Errorf("Amazon: request failed (%v): %v", resp.StatusCode, string(body))
+	}
+
+	return errors.Errorf("Amazon: %v (%v)", result.Message, result.Code)
+}
+
+func (rr ReportRequester) signedRequest(method string, requestURL string, body string) (*http.Response, error) {
+	u, err := url.Parse(requestURL)
+	if err != nil {
+		return nil, err
+	}
+
+	timestamp := rr.Clock.Now().UTC().Format("20060102T150405Z")
+	headers := map[string]string{
+		"Accept":        "application/json",
+		"X-Amz-Date":    timestamp,
+		"Authorization": rr.authorization(method, u, timestamp, body),
+	}
+
+	if body == "" {
+		return myrevenue.GetRequest(requestURL, headers, false)
+	}
+
+	headers["Content-Type"] = "application/json"
+	return myrevenue.PostRequest(requestURL, headers, body, false)
+}
+
+// authorization signs the method, path, query, timestamp and a hash of the
+// body with the secret key using HMAC-SHA256
+func (rr ReportRequester) authorization(method string, u *url.URL, timestamp string, body string) string {
+	bodyHash := sha256.Sum256([]byte(body))
+	canonical := strings.Join([]string{
+		method,
+		u.EscapedPath(),
+		u.Query().Encode(),
+		timestamp,
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+
+	mac := hmac.New(sha256.New, []byte(rr.SecretKey))
+	io.WriteString(mac, canonical)
+	signature := hex.EncodeToString(mac.Sum(nil))
+
+	return fmt.Sprintf("AMZ-HMAC-SHA256 AccessKey=%v, Timestamp=%v, Signature=%v", rr.AccessKey, timestamp, signature)
+}
+
+func (rr ReportRequester) GetName() string {
+	return "Amazon"
+}
+
+func (rr ReportRequester) GetReport() interface{} {
+	return rr.rawData
+}
+
+func (rr ReportRequester) GetStartDate() time.Time {
+	return rr.StartDate
+}
+
+func (rr ReportRequester) GetEndDate() time.Time {
+	return rr.EndDate
+}
@@ -0,0 +1,253 @@
+package amazon
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/econnelly/myrevenue"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testAccessKey = "test-access-key"
+	testSecretKey = "test-secret-key"
+	testReportCSV = "Amazon Publisher Report\n" +
+		"Date Range,10/01/2018 - 10/01/2018\n" +
+		"\n" +
+		"Date,App,Requests,Impressions,Clicks,Ad Earnings (EUR),eCPM (EUR)\n" +
+		"10/01/2018,Example App,2000,1500,15,3.00,2.00\n" +
+		"Total,,2000,1500,15,3.00,2.00\n"
+)
+
+var testNow = time.Date(2018, time.October, 2, 8, 30, 0, 0, time.UTC)
+
+// fakeReportingServer checks every request's signature and walks a report
+// through the given statuses, one per status poll
+type fakeReportingServer struct {
+	*httptest.Server
+
+	statuses    []string
+	downloadURL string // Relative to the server when it starts with "/"
+
+	mu        sync.Mutex
+	polls     int
+	created   ReportQuery
+	downloads int
+}
+
+func newFakeReportingServer(t *testing.T, statuses ...string) *fakeReportingServer {
+	s := &fakeReportingServer{statuses: statuses, downloadURL: "/v1/reports/r-1/download"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/reports", func(w http.ResponseWriter, r *http.Request) {
+		if !s.verify(t, w, r) {
+			return
+		}
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		s.mu.Lock()
+		json.NewDecoder(r.Body).Decode(&s.created)
+		s.mu.Unlock()
+
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(ReportStatus{ReportID: "r-1", Status: PENDING})
+	})
+	mux.HandleFunc("/v1/reports/r-1", func(w http.ResponseWriter, r *http.Request) {
+		if !s.verify(t, w, r) {
+			return
+		}
+
+		s.mu.Lock()
+		status := s.statuses[len(s.statuses)-1]
+		if s.polls < len(s.statuses) {
+			status = s.statuses[s.polls]
+		}
+		s.polls++
+		s.mu.Unlock()
+
+		response := ReportStatus{ReportID: "r-1", Status: status}
+		if status == COMPLETED {
+			response.DownloadURL = s.downloadURL
+			if !strings.HasPrefix(s.downloadURL, "/") {
+				response.DownloadURL = s.URL + "/presigned/r-1.csv"
+			}
+		} else if status == FAILED {
+			response.Message = "internal error"
+		}
+		json.NewEncoder(w).Encode(response)
+	})
+	mux.HandleFunc("/v1/reports/r-1/download", func(w http.ResponseWriter, r *http.Request) {
+		if !s.verify(t, w, r) {
+			return
+		}
+		s.serveReport(w)
+	})
+	// Pre-signed URLs carry their own credentials
+	mux.HandleFunc("/presigned/r-1.csv", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			t.Error("pre-signed downloads shouldn't be signed")
+		}
+		s.serveReport(w)
+	})
+
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+func (s *fakeReportingServer) serveReport(w http.ResponseWriter) {
+	s.mu.Lock()
+	s.downloads++
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/csv")
+	io.WriteString(w, testReportCSV)
+}
+
+// verify recomputes the signature from the request as received
+func (s *fakeReportingServer) verify(t *testing.T, w http.ResponseWriter, r *http.Request) bool {
+	body, _ := ioutil.ReadAll(r.Body)
+	r.Body = ioutil.NopCloser(strings.NewReader(string(body)))
+
+	timestamp := r.Header.Get("X-Amz-Date")
+	if timestamp != testNow.Format("20060102T150405Z") {
+		t.Errorf("X-Amz-Date = %q, want the clock's time", timestamp)
+	}
+
+	bodyHash := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, []byte(testSecretKey))
+	fmt.Fprintf(mac, "%v\n%v\n%v\n%v\n%v", r.Method, r.URL.EscapedPath(), r.URL.Query().Encode(), timestamp, hex.EncodeToString(bodyHash[:]))
+	want := fmt.Sprintf("AMZ-HMAC-SHA256 AccessKey=%v, Timestamp=%v, Signature=%v", testAccessKey, timestamp, hex.EncodeToString(mac.Sum(nil)))
+
+	if r.Header.Get("Authorization") != want {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(ErrorResponse{Code: "InvalidSignature", Message: "signature does not match"})
+		return false
+	}
+	return true
+}
+
+func (s *fakeReportingServer) requester(secretKey string) *ReportRequester {
+	return &ReportRequester{
+		PublisherID:  "pub-1",
+		AccessKey:    testAccessKey,
+		SecretKey:    secretKey,
+		BaseURL:      s.URL,
+		PollInterval: time.Millisecond,
+		MaxPolls:     5,
+		StartDate:    time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:      time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC),
+		Clock:        myrevenue.NewFakeClock(testNow),
+	}
+}
+
+func TestFetchPollsUntilComplete(t *testing.T) {
+	server := newFakeReportingServer(t, PENDING, IN_PROGRESS, COMPLETED)
+	defer server.Close()
+
+	rr := server.requester(testSecretKey)
+	if err := rr.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	models, err := rr.Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if server.polls != 3 || server.downloads != 1 {
+		t.Errorf("polls, downloads = %v, %v, want 3, 1", server.polls, server.downloads)
+	}
+
+	want := ReportQuery{PublisherID: "pub-1", StartDate: "2018-10-01", EndDate: "2018-10-01", GroupBy: BY_APP, Format: "csv"}
+	if server.created != want {
+		t.Errorf("report query = %+v, want %+v", server.created, want)
+	}
+
+	// The totals row is skipped
+	if len(models) != 1 {
+		t.Fatalf("got %v models, want 1", len(models))
+	}
+
+	m := models[0]
+	if m.App != "Example App" || m.Revenue != 3 || m.Impressions != 1500 || m.Currency != "EUR" {
+		t.Errorf("model = %+v", m)
+	}
+
+	if rr.GetReport().(ReportStatus).Status != COMPLETED {
+		t.Error("GetReport should return the final status")
+	}
+}
+
+func TestFetchPresignedDownload(t *testing.T) {
+	server := newFakeReportingServer(t, COMPLETED)
+	server.downloadURL = "presigned"
+	defer server.Close()
+
+	rr := server.requester(testSecretKey)
+	rr.Initialize()
+
+	models, err := rr.Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(models) != 1 || server.downloads != 1 {
+		t.Errorf("models, downloads = %v, %v", len(models), server.downloads)
+	}
+}
+
+func TestFetchFailedReport(t *testing.T) {
+	server := newFakeReportingServer(t, IN_PROGRESS, FAILED)
+	defer server.Close()
+
+	rr := server.requester(testSecretKey)
+	rr.Initialize()
+
+	if _, err := rr.Fetch(); err == nil || !strings.Contains(err.Error(), "failed: internal error") {
+		t.Errorf("Fetch() error = %v, want the failure message", err)
+	}
+
+	if server.downloads != 0 {
+		t.Error("a failed report shouldn't be downloaded")
+	}
+}
+
+func TestFetchGivesUpAfterMaxPolls(t *testing.T) {
+	server := newFakeReportingServer(t, IN_PROGRESS)
+	defer server.Close()
+
+	rr := server.requester(testSecretKey)
+	rr.Initialize()
+
+	if _, err := rr.Fetch(); err == nil || !strings.Contains(err.Error(), "not ready after 5 polls") {
+		t.Errorf("Fetch() error = %v, want a poll limit error", err)
+	}
+
+	if server.polls != 5 {
+		t.Errorf("polls = %v, want MaxPolls", server.polls)
+	}
+}
+
+func TestFetchBadSignature(t *testing.T) {
+	server := newFakeReportingServer(t, COMPLETED)
+	defer server.Close()
+
+	rr := server.requester("wrong-secret")
+	rr.Initialize()
+
+	if _, err := rr.Fetch(); err == nil || !strings.Contains(err.Error(), "signature does not match (InvalidSignature)") {
+		t.Errorf("Fetch() error = %v, want the signature error", err)
+	}
+}
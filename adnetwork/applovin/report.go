@@ -0,0 +1,295 @@
+package applovin
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/econnelly/myrevenue"
+	"github.com/econnelly/myrevenue/adnetwork"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const DEFAULT_BASE_URL = "https://r.applovin.com"
+
+type ReportRequester struct {
+	APIKey    string   `json:"api_key"`
+	Hourly    bool     `json:"hourly"`   // Break rows down by hour instead of day
+	Columns   []string `json:"columns"`  // Defaults to every dimension and metric this adapter maps
+	Format    string   `json:"format"`   // JSON or CSV, defaults to JSON
+	BaseURL   string   `json:"base_url"` // Defaults to DEFAULT_BASE_URL
+	StartDate time.Time
+	EndDate   time.Time
+	adnetwork.Request
+
+	reportURL string
+	rawData   ReportResponse
+}
+
+// ReportResponse holds the rows of a JSON or CSV report
+type ReportResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+	Count   int    `json:"count"`
+	Results []Row  `json:"results"`
+}
+
+// Row maps column names to values. MAX sends values as strings, but numbers
+// are accepted too.
+type Row map[string]string
+
+func (r *Row) UnmarshalJSON(data []byte) error {
+	raw := make(map[string]interface{})
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	row := make(Row, len(raw))
+	for k, v := range raw {
+		switch value := v.(type) {
+		case string:
+			row[k] = value
+		case float64:
+			row[k] = strconv.FormatFloat(value, 'f', -1, 64)
+		case bool:
+			row[k] = strconv.FormatBool(value)
+		case nil:
+			row[k] = ""
+		default:
+			return fmt.Errorf("column %v: unexpected value %v", k, v)
+		}
+	}
+
+	*r = row
+	return nil
+}
+
+// Columns
+const (
+	DAY               = "day"
+	HOUR              = "hour"
+	APPLICATION       = "application"
+	PACKAGE_NAME      = "package_name"
+	PLATFORM          = "platform"
+	COUNTRY           = "country"
+	AD_FORMAT         = "ad_format"
+	NETWORK           = "network"
+	IMPRESSIONS       = "impressions"
+	ESTIMATED_REVENUE = "estimated_revenue"
+	ECPM              = "ecpm"
+	ATTEMPTS          = "attempts"
+	RESPONSES         = "responses"
+)
+
+// Formats
+const (
+	JSON = "json"
+	CSV  = "csv"
+)
+
+func (rr *ReportRequester) Initialize() error {
+	if rr.APIKey == "" {
+		return errors.New("AppLovin: API key is required")
+	}
+
+	if rr.EndDate.Before(rr.StartDate) {
+		return fmt.Errorf("start date (%v) is after end date (%v)", rr.StartDate, rr.EndDate)
+	}
+
+	if rr.BaseURL == "" {
+		rr.BaseURL = DEFAULT_BASE_URL
+	}
+
+	if rr.Format == "" {
+		rr.Format = JSON
+	}
+
+	columns := rr.Columns
+	if len(columns) == 0 {
+		columns = []string{DAY, APPLICATION, PACKAGE_NAME, PLATFORM, COUNTRY, AD_FORMAT, NETWORK, IMPRESSIONS, ESTIMATED_REVENUE, ECPM, ATTEMPTS, RESPONSES}
+	}
+
+	if rr.Hourly && !contains(columns, HOUR) {
+		columns = append([]string{HOUR}, columns...)
+	}
+
+	query := url.Values{}
+	query.Set("api_key", rr.APIKey)
+	query.Add("start", rr.StartDate.Format("2006-01-02"))
+	query.Add("end", rr.EndDate.Format("2006-01-02"))
+	query.Add("columns", strings.Join(columns, ","))
+	query.Add("format", rr.Format)
+
+	rr.reportURL = fmt.Sprintf("%v/maxReport?%v", rr.BaseURL, query.Encode())
+
+	return nil
+}
+
+func (rr *ReportRequester) Fetch() ([]myrevenue.Model, error) {
+	resp, err := myrevenue.GetRequest(rr.reportURL, nil, false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, errors.Errorf("%v: request failed (%v): %v", rr.GetName(), resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	return rr.parse(resp.Body)
+}
+
+func (rr *ReportRequester) parse(reader io.Reader) ([]myrevenue.Model, error) {
+	result := ReportResponse{}
+
+	if rr.Format == CSV {
+		records, err := csv.NewReader(reader).ReadAll()
+		if err != nil {
+			return nil, err
+		}
+
+		if len(records) > 0 {
+			headers := records[0]
+			for _, record := range records[1:] {
+				row := make(Row, len(headers))
+				for i, h := range headers {
+					if i < len(record) {
+						row[h] = record[i]
+					}
+				}
+				result.Results = append(result.Results, row)
+			}
+		}
+		result.Count = len(result.Results)
+	} else {
+		body, err := ioutil.ReadAll(reader)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(body, &result); err != nil {
+			return nil, err
+		}
+
+		if result.Code != 0 && result.Code != http.StatusOK {
+			return nil, errors.Errorf("%v: %v (%v)", rr.GetName(), result.Message, result.Code)
+		}
+	}
+
+	rr.rawData = result
+	return rr.convertToReportModel(result)
+}
+
+func (rr ReportRequester) convertToReportModel(response ReportResponse) ([]myrevenue.Model, error) {
+	loc, e := time.LoadLocation("Etc/UTC")
+	if e != nil {
+		return nil, e
+	}
+
+	reportModels := make([]myrevenue.Model, len(response.Results))
+	for i, row := range response.Results {
+		parseError := func(column string, err error) error {
+			return &myrevenue.ParseError{Network: rr.GetName(), Row: i + 1, Column: column, Err: err}
+		}
+
+		model := &reportModels[i]
+		model.NetworkName = rr.GetName()
+
+		day, err := time.ParseInLocation("2006-01-02", row[DAY], loc)
+		if err != nil {
+			return nil, parseError(DAY, err)
+		}
+
+		// Hours are reported as "13:00"
+		if hour := row[HOUR]; hour != "" {
+			h, err := strconv.Atoi(strings.SplitN(hour, ":", 2)[0])
+			if err != nil {
+				return nil, parseError(HOUR, err)
+			}
+			day = day.Add(time.Duration(h) * time.Hour)
+		}
+		model.DateTime = day
+
+		model.App = row[APPLICATION]
+		if model.App == "" {
+			model.App = row[PACKAGE_NAME]
+		}
+		model.Platform = row[PLATFORM]
+		model.Country = strings.ToUpper(row[COUNTRY])
+		model.Format = row[AD_FORMAT]
+		model.AdSource = row[NETWORK]
+
+		if model.Impressions, err = parseCount(row[IMPRESSIONS]); err != nil {
+			return nil, parseError(IMPRESSIONS, err)
+		}
+
+		if model.Requests, err = parseCount(row[ATTEMPTS]); err != nil {
+			return nil, parseError(ATTEMPTS, err)
+		}
+
+		if model.Revenue, err = parseAmount(row[ESTIMATED_REVENUE]); err != nil {
+			return nil, parseError(ESTIMATED_REVENUE, err)
+		}
+
+		if model.ECPM, err = parseAmount(row[ECPM]); err != nil {
+			return nil, parseError(ECPM, err)
+		}
+
+		if value, found := row[RESPONSES]; found {
+			responses, err := parseCount(value)
+			if err != nil {
+				return nil, parseError(RESPONSES, err)
+			}
+			model.SetExtendedMetric(RESPONSES, float64(responses))
+		}
+	}
+
+	return reportModels, nil
+}
+
+func parseCount(value string) (uint64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.ParseUint(value, 10, 64)
+}
+
+func parseAmount(value string) (float64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(value, 64)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (ReportRequester) GetName() string {
+	return "AppLovin"
+}
+
+func (rr ReportRequester) GetReport() interface{} {
+	return rr.rawData
+}
+
+func (rr ReportRequester) GetStartDate() time.Time {
+	return rr.StartDate
+}
+
+func (rr ReportRequester) GetEndDate() time.Time {
+	return rr.EndDate
+}
@@ -0,0 +1,137 @@
+package applovin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseJSON(t *testing.T) {
+	f, err := os.Open("testdata/max_report.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	rr := &ReportRequester{Format: JSON}
+	models, err := rr.parse(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(models) != 2 {
+		t.Fatalf("got %v models, want 2", len(models))
+	}
+
+	// String values
+	m := models[0]
+	if got := m.DateTime.Format("2006-01-02 15:04"); got != "2018-10-01 13:00" {
+		t.Errorf("DateTime = %v, want the hour added to the day", got)
+	}
+	if m.App != "Example App" || m.Country != "US" || m.Format != "INTER" || m.AdSource != "APPLOVIN_NETWORK" {
+		t.Errorf("dimensions = %+v", m)
+	}
+	if m.Impressions != 1500 || m.Requests != 2000 || m.Revenue != 3.25 || m.ExtendedMetrics[RESPONSES] != 1800 {
+		t.Errorf("metrics = %+v", m)
+	}
+
+	// Numeric values, and a null
+	m = models[1]
+	if got := m.DateTime.Format("15:04"); got != "14:00" {
+		t.Errorf("hour = %v", got)
+	}
+	if m.App != "com.example.app" {
+		t.Errorf("App = %q, want the package name when the application is blank", m.App)
+	}
+	if m.Impressions != 800 || m.Requests != 1000 || m.Revenue != 0.4 || m.ECPM != 0.5 {
+		t.Errorf("metrics = %+v", m)
+	}
+	if m.ExtendedMetrics[RESPONSES] != 0 {
+		t.Errorf("responses = %v, want 0 for null", m.ExtendedMetrics[RESPONSES])
+	}
+}
+
+func TestParseCSV(t *testing.T) {
+	f, err := os.Open("testdata/max_report.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	rr := &ReportRequester{Format: CSV}
+	models, err := rr.parse(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(models) != 2 {
+		t.Fatalf("got %v models, want 2", len(models))
+	}
+
+	m := models[0]
+	if m.DateTime.Format("2006-01-02 15:04") != "2018-10-01 00:00" || m.Country != "DE" || m.Impressions != 300 || m.Revenue != 1.2 || m.Requests != 400 {
+		t.Errorf("model = %+v", m)
+	}
+
+	if rr.GetReport().(ReportResponse).Count != 2 {
+		t.Error("Count should be set from the CSV rows")
+	}
+}
+
+func TestParseErrorBody(t *testing.T) {
+	f, err := os.Open("testdata/max_error.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	rr := &ReportRequester{Format: JSON}
+	if _, err := rr.parse(f); err == nil || err.Error() != "AppLovin: Invalid API key (401)" {
+		t.Errorf("parse() error = %v", err)
+	}
+}
+
+func TestParseBadHour(t *testing.T) {
+	rr := &ReportRequester{Format: JSON}
+	_, err := rr.parse(strings.NewReader(`{"code": 200, "results": [{"day": "2018-10-01", "hour": "1pm"}]}`))
+	if err == nil || !strings.Contains(err.Error(), `column "hour"`) {
+		t.Errorf("parse() error = %v, want an hour column error", err)
+	}
+}
+
+func TestFetchHourly(t *testing.T) {
+	var query map[string][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		http.ServeFile(w, r, "testdata/max_report.json")
+	}))
+	defer server.Close()
+
+	rr := &ReportRequester{
+		APIKey:    "key",
+		Hourly:    true,
+		Columns:   []string{DAY, COUNTRY, ESTIMATED_REVENUE},
+		BaseURL:   server.URL,
+		StartDate: time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC),
+	}
+	if err := rr.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	models, err := rr.Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(models) != 2 {
+		t.Errorf("got %v models, want 2", len(models))
+	}
+
+	if query["api_key"][0] != "key" || query["columns"][0] != "hour,day,country,estimated_revenue" || query["format"][0] != JSON {
+		t.Errorf("query = %v", query)
+	}
+}
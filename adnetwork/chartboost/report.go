@@ -0,0 +1,166 @@
+package chartboost
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/econnelly/myrevenue"
+	"github.com/econnelly/myrevenue/adnetwork"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const DEFAULT_BASE_URL = "https://analytics.chartboost.com"
+
+type ReportRequester struct {
+	UserID        string `json:"user_id"`
+	UserSignature string `json:"user_signature"`
+	BaseURL       string `json:"base_url"` // Defaults to DEFAULT_BASE_URL
+	StartDate     time.Time
+	EndDate       time.Time
+	adnetwork.Request
+
+	reportURL string
+	rawData   ReportResponse
+}
+
+type ReportResponse []struct {
+	Date                 string  `json:"dt"`
+	App                  string  `json:"app"`
+	AppID                string  `json:"appId"`
+	Platform             string  `json:"platform"`
+	CountryCode          string  `json:"countryCode"`
+	Requests             uint64  `json:"requestsDelivered"`
+	ImpressionsDelivered uint64  `json:"impressionsDelivered"`
+	ClicksDelivered      uint64  `json:"clicksDelivered"`
+	MoneyEarned          float64 `json:"moneyEarned"`
+	ECPMEarned           float64 `json:"ecpmEarned"`
+}
+
+type ErrorResponse struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+func (rr *ReportRequester) Initialize() error {
+	if rr.UserID == "" || rr.UserSignature == "" {
+		return errors.New("Chartboost: user ID and user signature are required")
+	}
+
+	if rr.BaseURL == "" {
+		rr.BaseURL = DEFAULT_BASE_URL
+	}
+
+	query := url.Values{}
+	query.Set("dateMin", rr.StartDate.Format("2006-01-02"))
+	query.Add("dateMax", rr.EndDate.Format("2006-01-02"))
+	query.Add("groupBy", "app,country")
+	query.Add("aggregate", "daily")
+	query.Add("userId", rr.UserID)
+	query.Add("userSignature", rr.UserSignature)
+
+	rr.reportURL = fmt.Sprintf("%v/v3/metrics/appcountry?%v", rr.BaseURL, query.Encode())
+
+	return nil
+}
+
+func (rr *ReportRequester) Fetch() ([]myrevenue.Model, error) {
+	headers := map[string]string{
+		"Accept": "application/json",
+	}
+
+	resp, err := myrevenue.GetRequest(rr.reportURL, headers, false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, rr.parseError(resp)
+	}
+
+	return rr.parse(resp.Body)
+}
+
+func (rr *ReportRequester) parse(reader io.Reader) ([]myrevenue.Model, error) {
+	result := ReportResponse{}
+
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+
+	rr.rawData = result
+	return rr.convertToReportModel(result)
+}
+
+func (rr ReportRequester) parseError(resp *http.Response) error {
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	result := ErrorResponse{}
+	if json.Unmarshal(body, &result) != nil || result.Message == "" {
+		return errors.Errorf("%v: request failed (%v): %v", rr.GetName(), resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	return errors.Errorf("%v: %v (%v)", rr.GetName(), result.Message, resp.StatusCode)
+}
+
+func (rr ReportRequester) convertToReportModel(response ReportResponse) ([]myrevenue.Model, error) {
+	loc, e := time.LoadLocation("Etc/UTC")
+	if e != nil {
+		return nil, e
+	}
+
+	reportModels := make([]myrevenue.Model, len(response))
+	for i, row := range response {
+		day, err := time.ParseInLocation("2006-01-02", row.Date, loc)
+		if err != nil {
+			return nil, &myrevenue.ParseError{Network: rr.GetName(), Row: i + 1, Column: "dt", Err: err}
+		}
+
+		reportModels[i].NetworkName = rr.GetName()
+		reportModels[i].DateTime = day
+		reportModels[i].Country = row.CountryCode
+		reportModels[i].App = row.AppID
+		reportModels[i].Name = row.App
+		reportModels[i].Platform = row.Platform
+		reportModels[i].Requests = row.Requests
+		reportModels[i].Impressions = row.ImpressionsDelivered
+		reportModels[i].Clicks = row.ClicksDelivered
+		reportModels[i].Revenue = row.MoneyEarned
+		reportModels[i].ECPM = row.ECPMEarned
+		if row.ImpressionsDelivered > 0 {
+			reportModels[i].CTR = float64(row.ClicksDelivered) / float64(row.ImpressionsDelivered)
+		}
+	}
+
+	return reportModels, nil
+}
+
+func (ReportRequester) GetName() string {
+	return "Chartboost"
+}
+
+func (rr ReportRequester) GetReport() interface{} {
+	return rr.rawData
+}
+
+func (rr ReportRequester) GetStartDate() time.Time {
+	return rr.StartDate
+}
+
+func (rr ReportRequester) GetEndDate() time.Time {
+	return rr.EndDate
+}
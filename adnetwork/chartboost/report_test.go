@@ -0,0 +1,71 @@
+package chartboost
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newServer(t *testing.T) (*httptest.Server, *map[string][]string) {
+	query := make(map[string][]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		if r.URL.Query().Get("userSignature") != "signature" {
+			w.WriteHeader(http.StatusUnauthorized)
+			http.ServeFile(w, r, "testdata/error.json")
+			return
+		}
+		http.ServeFile(w, r, "testdata/appcountry.json")
+	}))
+	return server, &query
+}
+
+func TestFetch(t *testing.T) {
+	server, query := newServer(t)
+	defer server.Close()
+
+	rr := &ReportRequester{
+		UserID:        "user",
+		UserSignature: "signature",
+		BaseURL:       server.URL,
+		StartDate:     time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:       time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC),
+	}
+	if err := rr.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	models, err := rr.Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if q := *query; q["userId"][0] != "user" || q["dateMin"][0] != "2018-10-01" || q["groupBy"][0] != "app,country" {
+		t.Errorf("query = %v", q)
+	}
+
+	if len(models) != 1 {
+		t.Fatalf("got %v models, want 1", len(models))
+	}
+
+	m := models[0]
+	if m.App != "4f21c409cd1cb2fb7000001b" || m.Name != "Example App" || m.Country != "BR" || m.Platform != "Android" {
+		t.Errorf("dimensions = %+v", m)
+	}
+	if m.Requests != 3000 || m.Impressions != 2000 || m.Clicks != 40 || m.Revenue != 4.2 || m.ECPM != 2.1 || m.CTR != 0.02 {
+		t.Errorf("metrics = %+v", m)
+	}
+}
+
+func TestFetchError(t *testing.T) {
+	server, _ := newServer(t)
+	defer server.Close()
+
+	rr := &ReportRequester{UserID: "user", UserSignature: "wrong", BaseURL: server.URL}
+	rr.Initialize()
+
+	if _, err := rr.Fetch(); err == nil || err.Error() != "Chartboost: Invalid user signature (401)" {
+		t.Errorf("Fetch() error = %v", err)
+	}
+}
@@ -0,0 +1,276 @@
+package detect
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/econnelly/myrevenue"
+	"github.com/econnelly/myrevenue/adnetwork"
+	"github.com/econnelly/myrevenue/adnetwork/admob"
+	"github.com/econnelly/myrevenue/adnetwork/amazon"
+	"github.com/econnelly/myrevenue/adnetwork/flurry"
+	"github.com/econnelly/myrevenue/adnetwork/glispa"
+	"github.com/econnelly/myrevenue/adnetwork/inmobi"
+	"github.com/econnelly/myrevenue/adnetwork/mobfox"
+	"github.com/econnelly/myrevenue/adnetwork/mopub"
+	"github.com/econnelly/myrevenue/store/appstore"
+	"github.com/econnelly/myrevenue/store/googleplay"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// MinConfidence is the score a match needs before ParseAny will use it
+const MinConfidence = 0.6
+
+// sampleSize is how much of a report is inspected, enough for Amazon's title
+// lines and a few rows of any format
+const sampleSize = 64 * 1024
+
+// csvHeaderRows is how many leading CSV rows may hold the header
+const csvHeaderRows = 10
+
+type Match struct {
+	Network    string
+	Confidence float64 // 0 to 1
+	Parser     adnetwork.DirectlyParsable
+}
+
+// signature describes the shape of one network's export. A CSV or TSV header
+// row is scored by the fraction of columns present, where a column ending in
+// "(" matches any column with that prefix. A JSON object is scored by the
+// fraction of top-level keys present.
+type signature struct {
+	network string
+	columns []string
+	keys    []string
+	parser  adnetwork.DirectlyParsable
+}
+
+var signatures = []signature{
+	{network: "Amazon", columns: []string{"Date", "Requests", "Impressions", "Ad Earnings (", "eCPM ("}, parser: amazon.ReportParser{}},
+	{network: "Admob", columns: []string{"Date", "Estimated earnings (", "Ad requests", "Matched requests", "Impressions", "Clicks"}, parser: admob.ReportParser{}},
+	{network: "MoPub", columns: []string{"Day", "Country", "Attempts", "Impressions", "Clicks", "CTR", "Revenue"}, parser: mopub.ReportParser{}},
+	{network: "Flurry", columns: []string{"dateTime", "impressions", "revenueInUSD", "adsRequested"}, parser: flurry.ReportParser{}},
+	{network: "Flurry", keys: []string{"rows"}, parser: flurry.ReportParser{}},
+	{network: "MobFox", keys: []string{"columns", "results", "rowcount"}, parser: mobfox.ReportParser{}},
+	{network: "Glispa", keys: []string{"query", "data", "meta"}, parser: glispa.ReportParser{}},
+	{network: "Inmobi", keys: []string{"respList", "error", "errorList"}, parser: inmobi.ReportParser{}},
+	{network: googleplay.NAME, columns: []string{"Transaction Date", "Transaction Type", "Product id", "Amount (Merchant Currency)"}, parser: googleplay.ReportParser{}},
+	{network: googleplay.NAME, columns: []string{"Order Charged Date", "Financial Status", "Product ID", "Charged Amount"}, parser: googleplay.ReportParser{}},
+	{network: appstore.NAME, columns: []string{"Begin Date", "SKU", "Units", "Developer Proceeds"}, parser: appstore.ReportParser{}},
+	{network: appstore.NAME, columns: []string{"Start Date", "Vendor Identifier", "Quantity", "Partner Share"}, parser: appstore.ReportParser{}},
+}
+
+// Google Play is the only source exporting zip archives, its parser checks
+// what they hold
+var zipSignature = signature{network: googleplay.NAME, parser: googleplay.ReportParser{}}
+
+// UnknownFormatError is returned when no network matches with enough
+// confidence. Closest lists the best partial matches.
+type UnknownFormatError struct {
+	Closest []Match
+}
+
+func (e *UnknownFormatError) Error() string {
+	if len(e.Closest) == 0 {
+		return "unrecognised report format"
+	}
+
+	names := make([]string, len(e.Closest))
+	for i, m := range e.Closest {
+		names[i] = fmt.Sprintf("%v (%.0f%%)", m.Network, m.Confidence*100)
+	}
+	return fmt.Sprintf("unrecognised report format, closest matches: %v", strings.Join(names, ", "))
+}
+
+// Detect sniffs the start of a report and returns every network it partially
+// matches, best first
+func Detect(reader io.Reader) ([]Match, error) {
+	sample, err := ioutil.ReadAll(io.LimitReader(reader, sampleSize))
+	if err != nil {
+		return nil, err
+	}
+
+	return detect(sample), nil
+}
+
+// ParseAny detects the report's network and parses it with that network's
+// ReportParser. Reports matching two networks equally well are not guessed at.
+func ParseAny(reader io.Reader) ([]myrevenue.Model, Match, error) {
+	content, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, Match{}, err
+	}
+
+	sample := content
+	if len(sample) > sampleSize {
+		sample = sample[:sampleSize]
+	}
+
+	matches := detect(sample)
+	if len(matches) == 0 || matches[0].Confidence < MinConfidence ||
+		(len(matches) > 1 && matches[1].Confidence == matches[0].Confidence) {
+		return nil, Match{}, &UnknownFormatError{Closest: closest(matches)}
+	}
+
+	models, err := matches[0].Parser.ParseRevenue(bytes.NewReader(content))
+	return models, matches[0], err
+}
+
+func detect(sample []byte) []Match {
+	// App Store reports are gzipped as downloaded
+	if bytes.HasPrefix(sample, []byte{0x1f, 0x8b}) {
+		sample = gunzipSample(sample)
+	}
+
+	sample = bytes.TrimPrefix(sample, []byte("\xef\xbb\xbf"))
+	trimmed := bytes.TrimSpace(sample)
+
+	var scores map[string]Match
+	if bytes.HasPrefix(sample, []byte("PK\x03\x04")) {
+		scores = make(map[string]Match)
+		keepBest(scores, zipSignature, 1)
+	} else if len(trimmed) > 0 && trimmed[0] == '{' {
+		scores = scoreJSON(trimmed)
+	} else {
+		scores = scoreCSV(sample)
+	}
+
+	matches := make([]Match, 0, len(scores))
+	for _, m := range scores {
+		if m.Confidence > 0 {
+			matches = append(matches, m)
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Confidence == matches[j].Confidence {
+			return matches[i].Network < matches[j].Network
+		}
+		return matches[i].Confidence > matches[j].Confidence
+	})
+
+	return matches
+}
+
+func scoreJSON(sample []byte) map[string]Match {
+	scores := make(map[string]Match)
+
+	// The sample may be truncated, so only the keys seen before the cut matter
+	keys := topLevelKeys(sample)
+	for _, s := range signatures {
+		if len(s.keys) == 0 {
+			continue
+		}
+
+		found := 0
+		for _, k := range s.keys {
+			if keys[k] {
+				found++
+			}
+		}
+		keepBest(scores, s, float64(found)/float64(len(s.keys)))
+	}
+
+	return scores
+}
+
+func topLevelKeys(sample []byte) map[string]bool {
+	keys := make(map[string]bool)
+	decoder := json.NewDecoder(bytes.NewReader(sample))
+
+	if t, err := decoder.Token(); err != nil || t != json.Delim('{') {
+		return keys
+	}
+
+	for decoder.More() {
+		t, err := decoder.Token()
+		if err != nil {
+			return keys
+		}
+
+		key, ok := t.(string)
+		if !ok {
+			return keys
+		}
+		keys[key] = true
+
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return keys
+		}
+	}
+
+	return keys
+}
+
+// gunzipSample inflates as much of a truncated gzip stream as it can
+func gunzipSample(sample []byte) []byte {
+	gz, err := gzip.NewReader(bytes.NewReader(sample))
+	if err != nil {
+		return sample
+	}
+
+	inflated, _ := ioutil.ReadAll(io.LimitReader(gz, sampleSize))
+	return inflated
+}
+
+func scoreCSV(sample []byte) map[string]Match {
+	scores := make(map[string]Match)
+
+	for _, comma := range []rune{',', '\t'} {
+		reader := csv.NewReader(bytes.NewReader(sample))
+		reader.Comma = comma
+		reader.FieldsPerRecord = -1
+		reader.LazyQuotes = true
+
+		for i := 0; i < csvHeaderRows; i++ {
+			record, err := reader.Read()
+			if err != nil {
+				break
+			}
+
+			for _, s := range signatures {
+				if len(s.columns) == 0 {
+					continue
+				}
+				keepBest(scores, s, columnScore(s.columns, record))
+			}
+		}
+	}
+
+	return scores
+}
+
+func columnScore(expected []string, header []string) float64 {
+	found := 0
+	for _, e := range expected {
+		for _, h := range header {
+			h = strings.TrimSpace(h)
+			if h == e || (strings.HasSuffix(e, "(") && strings.HasPrefix(h, e)) {
+				found++
+				break
+			}
+		}
+	}
+	return float64(found) / float64(len(expected))
+}
+
+// keepBest keeps the best score seen for a network
+func keepBest(scores map[string]Match, s signature, confidence float64) {
+	if best, found := scores[s.network]; found && best.Confidence >= confidence {
+		return
+	}
+	scores[s.network] = Match{Network: s.network, Confidence: confidence, Parser: s.parser}
+}
+
+func closest(matches []Match) []Match {
+	if len(matches) > 3 {
+		return matches[:3]
+	}
+	return matches
+}
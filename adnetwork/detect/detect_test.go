@@ -0,0 +1,161 @@
+package detect
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func readFixture(t *testing.T, path string) []byte {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content
+}
+
+func gzipped(t *testing.T, content []byte) []byte {
+	buffer := &bytes.Buffer{}
+	gz := gzip.NewWriter(buffer)
+	if _, err := gz.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func zipped(t *testing.T, name string, content []byte) []byte {
+	buffer := &bytes.Buffer{}
+	archive := zip.NewWriter(buffer)
+	w, err := archive.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func TestParseAny(t *testing.T) {
+	earnings := readFixture(t, "../../store/googleplay/testdata/earnings.csv")
+
+	tests := []struct {
+		name    string
+		report  []byte
+		network string
+	}{
+		{"admob csv", readFixture(t, "testdata/admob.csv"), "Admob"},
+		{"mopub csv", readFixture(t, "testdata/mopub.csv"), "MoPub"},
+		{"amazon csv after a preamble", readFixture(t, "../amazon/testdata/marketplace_report.csv"), "Amazon"},
+		{"flurry csv", readFixture(t, "../flurry/testdata/report.csv"), "Flurry"},
+		{"flurry csv with BOM", append([]byte("\xef\xbb\xbf"), readFixture(t, "../flurry/testdata/report.csv")...), "Flurry"},
+		{"flurry json", readFixture(t, "../flurry/testdata/report.json"), "Flurry"},
+		{"mobfox json", readFixture(t, "../mobfox/testdata/report.json"), "MobFox"},
+		{"inmobi json", readFixture(t, "../inmobi/testdata/report.json"), "Inmobi"},
+		{"google play earnings", earnings, "Google Play"},
+		{"google play sales", readFixture(t, "../../store/googleplay/testdata/sales.csv"), "Google Play"},
+		{"google play zip", zipped(t, "earnings_201810.csv", earnings), "Google Play"},
+		{"app store sales tsv", readFixture(t, "../../store/appstore/testdata/sales_2018-10-01.txt"), "App Store"},
+		{"app store financial tsv", readFixture(t, "../../store/appstore/testdata/financial_2018-10.txt"), "App Store"},
+		{"gzipped app store sales", gzipped(t, readFixture(t, "../../store/appstore/testdata/sales_2018-10-03.txt")), "App Store"},
+	}
+
+	for _, test := range tests {
+		models, match, err := ParseAny(bytes.NewReader(test.report))
+		if err != nil {
+			t.Errorf("%v: %v", test.name, err)
+			continue
+		}
+
+		if match.Network != test.network || match.Confidence < MinConfidence {
+			t.Errorf("%v: matched %v (%v), want %v", test.name, match.Network, match.Confidence, test.network)
+		}
+		if len(models) == 0 {
+			t.Errorf("%v: no models", test.name)
+		}
+	}
+}
+
+func TestDetectScores(t *testing.T) {
+	tests := []struct {
+		name       string
+		report     string
+		network    string
+		confidence float64
+	}{
+		{"every column", "Day,Country,Attempts,Impressions,Clicks,CTR,Revenue\n", "MoPub", 1},
+		{"columns in any order", "Revenue,CTR,Clicks,Impressions,Attempts,Country,Day\n", "MoPub", 1},
+		{"currency suffixed columns", "Date,Requests,Impressions,Ad Earnings (JPY),eCPM (JPY)\n", "Amazon", 1},
+		{"some columns", "Date,Requests,Impressions,Ad Earnings (USD)\n", "Amazon", 0.8},
+		{"header below a title", "Report\n\nDate,Requests,Impressions,Ad Earnings (USD),eCPM (USD)\n", "Amazon", 1},
+		{"some keys", `{"columns": [], "results": []}`, "MobFox", 2.0 / 3},
+		{"keys before a truncated value", `{"query": {}, "data": [{"timestamp": "2018-`, "Glispa", 2.0 / 3},
+	}
+
+	for _, test := range tests {
+		matches, err := Detect(strings.NewReader(test.report))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(matches) == 0 || matches[0].Network != test.network || matches[0].Confidence != test.confidence {
+			t.Errorf("%v: matches = %+v, want %v at %v", test.name, matches, test.network, test.confidence)
+		}
+	}
+}
+
+func TestDetectOrdersTiesByName(t *testing.T) {
+	matches, err := Detect(strings.NewReader(`{"columns": [], "results": [], "query": {}, "data": []}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(matches) < 2 || matches[0].Network != "Glispa" || matches[1].Network != "MobFox" || matches[0].Confidence != matches[1].Confidence {
+		t.Errorf("matches = %+v, want Glispa then MobFox at the same confidence", matches)
+	}
+}
+
+func TestParseAnyUnknownFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		report  string
+		closest []string
+	}{
+		{"nothing matches", "foo,bar\n1,2\n", nil},
+		{"empty", "", nil},
+		{"too few columns", "Date,Impressions,Clicks\n2018-10-01,1,0\n", []string{"Admob", "Amazon", "MoPub"}},
+		// Half a MobFox report and half a Glispa one is neither
+		{"tie", `{"columns": [], "results": [], "query": {}, "data": []}`, []string{"Glispa", "MobFox"}},
+	}
+
+	for _, test := range tests {
+		_, _, err := ParseAny(strings.NewReader(test.report))
+
+		var unknown *UnknownFormatError
+		if !errors.As(err, &unknown) {
+			t.Errorf("%v: error = %v, want an UnknownFormatError", test.name, err)
+			continue
+		}
+
+		names := make([]string, len(unknown.Closest))
+		for i, m := range unknown.Closest {
+			names[i] = m.Network
+		}
+		if strings.Join(names, ",") != strings.Join(test.closest, ",") {
+			t.Errorf("%v: closest = %v, want %v", test.name, names, test.closest)
+		}
+		if len(test.closest) > 0 && !strings.Contains(err.Error(), test.closest[0]) {
+			t.Errorf("%v: error %q should name the closest match", test.name, err)
+		}
+	}
+}
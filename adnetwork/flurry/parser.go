@@ -0,0 +1,75 @@
+package flurry
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"github.com/econnelly/myrevenue"
+	"github.com/econnelly/myrevenue/adnetwork"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// ReportParser reads reports downloaded from the Flurry dashboard in either
+// CSV or JSON
+type ReportParser struct {
+	TimeZone string `json:"time_zone"` // Defaults to Etc/UTC
+	adnetwork.DirectlyParsable
+}
+
+func (r ReportParser) ParseRevenue(reader io.Reader) ([]myrevenue.Model, error) {
+	if reader == nil {
+		return nil, errors.New("reader is nil")
+	}
+
+	rr := ReportRequester{TimeZone: r.TimeZone, Format: CSV}
+	if rr.TimeZone == "" {
+		rr.TimeZone = "Etc/UTC"
+	}
+
+	buffered := bufio.NewReader(reader)
+	if err := skipBOM(buffered); err != nil {
+		return nil, err
+	}
+
+	first, err := firstNonSpace(buffered)
+	if err != nil {
+		return nil, err
+	}
+
+	if first == '{' {
+		rr.Format = JSON
+	}
+
+	return rr.parse(ioutil.NopCloser(buffered))
+}
+
+// skipBOM drops a UTF-8 byte order mark, which spreadsheet tools add to
+// saved CSVs and which would otherwise end up in the first column name
+func skipBOM(r *bufio.Reader) error {
+	peek, err := r.Peek(3)
+	if bytes.Equal(peek, []byte("\xef\xbb\xbf")) {
+		_, err = r.Discard(3)
+		return err
+	}
+
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// firstNonSpace peeks past whitespace
+func firstNonSpace(r *bufio.Reader) (byte, error) {
+	for n := 1; ; n++ {
+		peek, err := r.Peek(n)
+		if len(peek) < n {
+			return 0, err
+		}
+
+		if c := peek[n-1]; !strings.ContainsRune(" \t\r\n", rune(c)) {
+			return c, nil
+		}
+	}
+}
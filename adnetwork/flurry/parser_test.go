@@ -0,0 +1,69 @@
+package flurry
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestReportParser(t *testing.T) {
+	csvReport, err := os.ReadFile("testdata/report.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jsonReport, err := os.ReadFile("testdata/report.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bom := []byte("\xef\xbb\xbf")
+	tests := []struct {
+		name   string
+		report []byte
+	}{
+		{"csv", csvReport},
+		{"json", jsonReport},
+		{"csv with BOM", append(bom, csvReport...)},
+		{"json with BOM", append(bom, jsonReport...)},
+		{"csv after blank lines", append([]byte("\r\n\n"), csvReport...)},
+		{"json after whitespace", append([]byte(" \n\t"), jsonReport...)},
+		{"BOM then whitespace", append(append(bom, "\n  "...), jsonReport...)},
+	}
+
+	for _, test := range tests {
+		models, err := ReportParser{TimeZone: "America/Los_Angeles"}.ParseRevenue(bytes.NewReader(test.report))
+		if err != nil {
+			t.Errorf("%v: %v", test.name, err)
+			continue
+		}
+
+		if len(models) != 2 {
+			t.Errorf("%v: got %v models, want 2", test.name, len(models))
+			continue
+		}
+
+		m := models[0]
+		if m.NetworkName != "Flurry" || m.App != "Example App" || m.Country != "US" {
+			t.Errorf("%v: dimensions = %v, %v, %v", test.name, m.NetworkName, m.App, m.Country)
+		}
+		if m.Revenue != 3.25 || m.Impressions != 1500 || m.Requests != 2000 || m.Clicks != 12 {
+			t.Errorf("%v: metrics = %+v", test.name, m)
+		}
+		if got := m.DateTime.Format("2006-01-02 15:04 MST"); got != "2018-09-30 00:00 PDT" {
+			t.Errorf("%v: DateTime = %v", test.name, got)
+		}
+
+		if models[1].Revenue != 0 || models[1].Impressions != 500 {
+			t.Errorf("%v: an empty revenue should read as 0, got %+v", test.name, models[1])
+		}
+	}
+}
+
+func TestReportParserEmpty(t *testing.T) {
+	for _, report := range []string{"", "\xef\xbb\xbf", " \n"} {
+		if _, err := (ReportParser{}).ParseRevenue(bytes.NewReader([]byte(report))); err == nil {
+			t.Errorf("ParseRevenue(%q) should fail", report)
+		}
+	}
+}
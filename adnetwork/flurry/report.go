@@ -1,6 +1,7 @@
 package flurry
 
 import (
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"github.com/econnelly/myrevenue"
@@ -8,30 +9,71 @@ import (
 	"io"
 	"io/ioutil"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 )
 
 type ReportRequester struct {
-	APIKey    string `json:"api_key"`
-	TimeZone  string `json:"time_zone"`
-	StartDate time.Time
-	EndDate   time.Time
+	APIKey     string   `json:"api_key"`
+	TimeZone   string   `json:"time_zone"`
+	Grain      string   `json:"grain"`      // DAY, HOUR or MONTH in any case. Defaults to HOUR.
+	Dimensions []string `json:"dimensions"` // Any of APP, AD_SPACE, COUNTRY, PLATFORM. Defaults to APP.
+	Metrics    []string `json:"metrics"`    // Defaults to impressions, revenue, requests, clicks, eCPM and CTR
+	Format     string   `json:"format"`     // JSON or CSV in any case. CSV is faster for large reports.
+	StartDate  time.Time
+	EndDate    time.Time
 	adnetwork.Request
 
 	reportURL string
 	rawData   ReportResponse
 }
 
+// Row is keyed by column, e.g. "dateTime", "app|name" or "revenueInUSD".
+// Values are numbers or strings for JSON reports and always strings for CSV.
+type Row map[string]interface{}
+
 type ReportResponse struct {
-	Rows []struct {
-		DateTime     string  `json:"dateTime"`
-		AppName      string  `json:"app|name"`
-		Impressions  int     `json:"impressions"`
-		RevenueInUSD float64 `json:"revenueInUSD"`
-		AdsRequested int     `json:"adsRequested"`
-		ECPM         float64 `json:"eCPM"`
-		Ctr          float64 `json:"ctr"`
-	} `json:"rows"`
+	Rows []Row `json:"rows"`
+}
+
+// Grains
+const (
+	DAY   = "day"
+	HOUR  = "hour"
+	MONTH = "month"
+)
+
+// Dimensions
+const (
+	APP      = "app"
+	AD_SPACE = "adSpace"
+	COUNTRY  = "country"
+	PLATFORM = "platform"
+)
+
+// Metrics
+const (
+	IMPRESSIONS    = "impressions"
+	REVENUE_IN_USD = "revenueInUSD"
+	ADS_REQUESTED  = "adsRequested"
+	CLICKS         = "clicks"
+	ECPM           = "eCPM"
+	CTR            = "ctr"
+)
+
+// Formats
+const (
+	JSON = "json"
+	CSV  = "csv"
+)
+
+// dimensionFields is the column each dimension is reported under
+var dimensionFields = map[string]string{
+	APP:      "app|name",
+	AD_SPACE: "adSpace|name",
+	COUNTRY:  "country|iso",
+	PLATFORM: "platform|name",
 }
 
 func (rr *ReportRequester) Initialize() error {
@@ -49,10 +91,34 @@ func (rr *ReportRequester) Initialize() error {
 		endDate = rr.EndDate.Format("2006-01-02")
 	}
 
+	switch rr.Grain = strings.ToLower(rr.Grain); rr.Grain {
+	case "":
+		rr.Grain = HOUR
+	case DAY, HOUR, MONTH:
+	default:
+		return fmt.Errorf("%v: unknown grain %q", rr.GetName(), rr.Grain)
+	}
+
+	if len(rr.Dimensions) == 0 {
+		rr.Dimensions = []string{APP}
+	}
+
+	if len(rr.Metrics) == 0 {
+		rr.Metrics = []string{IMPRESSIONS, REVENUE_IN_USD, ADS_REQUESTED, CLICKS, ECPM, CTR}
+	}
+
+	switch rr.Format = strings.ToLower(rr.Format); rr.Format {
+	case "":
+		rr.Format = JSON
+	case JSON, CSV:
+	default:
+		return fmt.Errorf("%v: unknown format %q", rr.GetName(), rr.Format)
+	}
+
 	reportURL := url.URL{
 		Scheme: "https",
 		Host:   "api-metrics.flurry.com",
-		Path:   fmt.Sprintf("public/v1/data/publisherRecent/%v/app", "hour"),
+		Path:   fmt.Sprintf("public/v1/data/publisherRecent/%v/%v", rr.Grain, strings.Join(rr.Dimensions, "/")),
 	}
 
 	if rr.TimeZone == "" {
@@ -60,11 +126,18 @@ func (rr *ReportRequester) Initialize() error {
 	}
 
 	query := url.Values{}
-	query.Set("metrics", "impressions,revenueInUSD,adsRequested,eCPM,ctr")
+	query.Set("metrics", strings.Join(rr.Metrics, ","))
 	query.Add("dateTime", fmt.Sprintf("%v/%v", startDate, endDate))
 	query.Add("timeZone", rr.TimeZone)
+	query.Add("format", rr.Format)
 	query.Add("token", rr.APIKey)
 
+	for _, d := range rr.Dimensions {
+		if field, found := dimensionFields[d]; found {
+			query.Add(fmt.Sprintf("fields[%v]", d), strings.TrimPrefix(field, d+"|"))
+		}
+	}
+
 	rr.reportURL = fmt.Sprintf("%v?%v", reportURL.String(), query.Encode())
 
 	return nil
@@ -81,7 +154,11 @@ func (rr *ReportRequester) Fetch() ([]myrevenue.Model, error) {
 	return rr.parse(resp.Body)
 }
 
-func (rr ReportRequester) parse(reader io.ReadCloser) ([]myrevenue.Model, error) {
+func (rr *ReportRequester) parse(reader io.ReadCloser) ([]myrevenue.Model, error) {
+	if rr.Format == CSV {
+		return rr.parseCSV(reader)
+	}
+
 	result := ReportResponse{}
 
 	body, err := ioutil.ReadAll(reader)
@@ -101,21 +178,77 @@ func (rr ReportRequester) Error(reader io.ReadCloser, err error) {
 	reader.Close()
 }
 
+func (rr *ReportRequester) parseCSV(reader io.Reader) ([]myrevenue.Model, error) {
+	records, err := csv.NewReader(reader).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%v: 0-length csv", rr.GetName())
+	}
+
+	headers := records[0]
+	result := ReportResponse{Rows: make([]Row, len(records)-1)}
+	for i, record := range records[1:] {
+		if len(record) != len(headers) {
+			return nil, fmt.Errorf("%v: row %v has %v columns, expected %v", rr.GetName(), i+2, len(record), len(headers))
+		}
+
+		row := make(Row, len(headers))
+		for j, h := range headers {
+			row[h] = record[j]
+		}
+		result.Rows[i] = row
+	}
+
+	rr.rawData = result
+	return rr.convertToReportModel(result)
+}
+
 func (rr ReportRequester) convertToReportModel(result ReportResponse) ([]myrevenue.Model, error) {
+	loc, e := time.LoadLocation(rr.TimeZone)
+	if e != nil {
+		return nil, e
+	}
+
 	reports := make([]myrevenue.Model, len(result.Rows))
 	for i, row := range result.Rows {
 		reports[i].NetworkName = rr.GetName()
-		reports[i].Impressions = uint64(row.Impressions)
-		reports[i].Revenue = row.RevenueInUSD
-		reports[i].Requests = uint64(row.AdsRequested)
-		reports[i].CTR = row.Ctr
-
-		loc, e := time.LoadLocation(rr.TimeZone)
-		if e != nil {
-			return nil, e
+		reports[i].App = row.String(dimensionFields[APP])
+		reports[i].AdUnit = row.String(dimensionFields[AD_SPACE])
+		reports[i].Country = row.String(dimensionFields[COUNTRY])
+		reports[i].Platform = row.String(dimensionFields[PLATFORM])
+
+		for column := range row {
+			if column == "dateTime" || strings.Contains(column, "|") {
+				continue
+			}
+
+			value, err := row.Float(column)
+			if err != nil {
+				return nil, fmt.Errorf("%v: %v: %v", rr.GetName(), column, err)
+			}
+
+			switch column {
+			case IMPRESSIONS:
+				reports[i].Impressions = uint64(value)
+			case REVENUE_IN_USD:
+				reports[i].Revenue = value
+			case ADS_REQUESTED:
+				reports[i].Requests = uint64(value)
+			case CLICKS:
+				reports[i].Clicks = uint64(value)
+			case ECPM:
+				reports[i].ECPM = value
+			case CTR:
+				reports[i].CTR = value
+			default:
+				reports[i].SetExtendedMetric(column, value)
+			}
 		}
 
-		day, err := time.ParseInLocation("2006-01-02 15:04:05.000-07:00", row.DateTime, loc)
+		day, err := time.ParseInLocation("2006-01-02 15:04:05.000-07:00", row.String("dateTime"), loc)
 		if err != nil {
 			return nil, err
 		} else {
@@ -126,6 +259,33 @@ func (rr ReportRequester) convertToReportModel(result ReportResponse) ([]myreven
 	return reports, nil
 }
 
+func (r Row) String(column string) string {
+	switch v := r[column].(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return ""
+	}
+}
+
+func (r Row) Float(column string) (float64, error) {
+	switch v := r[column].(type) {
+	case float64:
+		return v, nil
+	case string:
+		if v == "" {
+			return 0, nil
+		}
+		return strconv.ParseFloat(v, 64)
+	case nil:
+		return 0, nil
+	default:
+		return 0, fmt.Errorf("unexpected value %v", v)
+	}
+}
+
 func (ReportRequester) GetName() string {
 	return "Flurry"
 }
@@ -0,0 +1,76 @@
+package flurry
+
+import (
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInitializeGrainAndFormat(t *testing.T) {
+	tests := []struct {
+		grain, format   string
+		wantGrain       string
+		wantFormat      string
+		wantErrContains string
+	}{
+		{"", "", HOUR, JSON, ""},
+		{"DAY", "CSV", DAY, CSV, ""},
+		{"Month", "Json", MONTH, JSON, ""},
+		{"hour", "csv", HOUR, CSV, ""},
+		{"week", "", "", "", "unknown grain"},
+		{"", "xml", "", "", "unknown format"},
+	}
+
+	day := time.Date(2018, time.September, 30, 0, 0, 0, 0, time.UTC)
+	for _, test := range tests {
+		rr := ReportRequester{Grain: test.grain, Format: test.format, StartDate: day, EndDate: day}
+		err := rr.Initialize()
+		if test.wantErrContains != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErrContains) {
+				t.Errorf("Initialize(%q, %q) error = %v, want %v", test.grain, test.format, err, test.wantErrContains)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Initialize(%q, %q) = %v", test.grain, test.format, err)
+			continue
+		}
+
+		if rr.Grain != test.wantGrain || rr.Format != test.wantFormat {
+			t.Errorf("Initialize(%q, %q) set %q, %q", test.grain, test.format, rr.Grain, rr.Format)
+		}
+
+		u, err := url.Parse(rr.reportURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(u.Path, "/publisherRecent/"+test.wantGrain+"/") || u.Query().Get("format") != test.wantFormat {
+			t.Errorf("reportURL = %v", rr.reportURL)
+		}
+	}
+}
+
+func TestParseUpperCaseCSVFormat(t *testing.T) {
+	f, err := os.Open("testdata/report.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// Settings files spell the format the way the field doc does
+	day := time.Date(2018, time.September, 30, 0, 0, 0, 0, time.UTC)
+	rr := ReportRequester{Format: "CSV", StartDate: day, EndDate: day}
+	if err := rr.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	models, err := rr.parse(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(models) != 2 || models[0].Revenue != 3.25 {
+		t.Errorf("models = %+v", models)
+	}
+}
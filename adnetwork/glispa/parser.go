@@ -0,0 +1,23 @@
+package glispa
+
+import (
+	"errors"
+	"github.com/econnelly/myrevenue"
+	"github.com/econnelly/myrevenue/adnetwork"
+	"io"
+	"io/ioutil"
+)
+
+// ReportParser reads saved reporting API responses
+type ReportParser struct {
+	adnetwork.DirectlyParsable
+}
+
+func (r ReportParser) ParseRevenue(reader io.Reader) ([]myrevenue.Model, error) {
+	if reader == nil {
+		return nil, errors.New("reader is nil")
+	}
+
+	rr := ReportRequester{}
+	return rr.parse(ioutil.NopCloser(reader))
+}
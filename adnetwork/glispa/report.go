@@ -6,9 +6,9 @@ import (
 	"fmt"
 	"github.com/econnelly/myrevenue"
 	"github.com/econnelly/myrevenue/adnetwork"
+	"github.com/econnelly/myrevenue/adnetwork/oauth"
 	"io"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"net/url"
 	"strings"
@@ -26,8 +26,14 @@ type ReportRequester struct {
 	StartDate time.Time
 	EndDate   time.Time
 
+	Group   []string            `json:"group"`   // Dimensions to break the report down by, e.g. COUNTRY or APP_ID
+	Filters map[string][]string `json:"filters"` // Dimension to allowed values
+
+	TokenStore oauth.TokenStore `json:"-"` // Optional, persists access and rotated refresh tokens
+
 	adnetwork.Request
 
+	tokens    *oauth.Manager
 	authToken string
 	reportURL string
 	rawData   ReportResponse
@@ -102,9 +108,35 @@ type ReportResponse struct {
 	} `json:"meta"`
 }
 
+// Dimensions
+const (
+	ADUNIT_ID          = "adunit_id"
+	ADUNIT_TYPE        = "adunit_type"
+	APP_ID             = "app_id"
+	APP_VERSION        = "app_version"
+	CARRIER            = "carrier"
+	CITY               = "city"
+	CONNECTION_TYPE    = "connection_type"
+	COUNTRY            = "country"
+	DEVICE_BRAND       = "device_brand"
+	DEVICE_MODEL       = "device_model"
+	DEVICE_ORIENTATION = "device_orientation"
+	DEVICE_OS_VERSION  = "device_os_version"
+	DEVICE_OS          = "device_os"
+	PUBLISHER_ID       = "publisher_id"
+	SDK_VERSION        = "sdk_version"
+)
+
+// Extended metrics
+const (
+	RENDER_RATE = "render_rate"
+	FILL_RATE   = "fill_rate"
+)
+
 type AuthResponse struct {
 	AccessToken  string `json:"access_token"`
 	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int    `json:"expires_in,omitempty"`
 }
 
 type AuthErrorResponse struct {
@@ -113,16 +145,14 @@ type AuthErrorResponse struct {
 }
 
 func (rr *ReportRequester) Initialize() error {
-	accessToken := rr.fetchAccessToken()
-	if accessToken == "" {
-
-		if rr.hasLoginCredentials() {
-			rr.RefreshToken = ""
-			accessToken = rr.fetchAccessToken()
-		} else {
-			return errors.New("empty access token")
-		}
+	rr.tokens = oauth.Shared("glispa:"+rr.ClientID+":"+rr.PublisherKey, rr.RefreshToken, rr.TokenStore, rr.refreshAccessToken)
+
+	accessToken, err := rr.tokens.AccessToken()
+	if err != nil {
+		return err
 	}
+	rr.authToken = accessToken
+	rr.RefreshToken = rr.tokens.RefreshToken()
 
 	startDate := rr.StartDate.UTC().Format("2006-01-02 15:04:05.999999999")
 	endDate := rr.EndDate.UTC().Format("2006-01-02 15:04:05.999999999")
@@ -139,6 +169,16 @@ func (rr *ReportRequester) Initialize() error {
 	query.Add("timestamp[to]", endDate)
 	query.Add("granularity", "hour")
 
+	for _, g := range rr.Group {
+		query.Add("group[]", g)
+	}
+
+	for dimension, values := range rr.Filters {
+		for _, v := range values {
+			query.Add(fmt.Sprintf("filters[%v][]", dimension), v)
+		}
+	}
+
 	rr.reportURL = fmt.Sprintf("%v?%v", reportUrl.String(), query.Encode())
 
 	return nil
@@ -156,6 +196,11 @@ func (rr *ReportRequester) Fetch() ([]myrevenue.Model, error) {
 	}
 
 	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized {
+		rr.tokens.Invalidate()
+		return nil, fmt.Errorf("%v: access token rejected", rr.GetName())
+	}
+
 	return rr.parse(resp.Body)
 }
 
@@ -176,7 +221,22 @@ func (rr *ReportRequester) parse(reader io.ReadCloser) ([]myrevenue.Model, error
 	return rr.convertToReportModel(result)
 }
 
-func (rr ReportRequester) fetchAccessToken() string {
+// refreshAccessToken uses the refresh token when there is one, falling back
+// to the password grant if it's missing or has been revoked
+func (rr ReportRequester) refreshAccessToken(refreshToken string) (oauth.Response, error) {
+	if refreshToken != "" {
+		resp, err := rr.fetchAccessToken(refreshToken)
+		if err == nil || !rr.hasLoginCredentials() {
+			return resp, err
+		}
+	} else if !rr.hasLoginCredentials() {
+		return oauth.Response{}, errors.New("empty access token")
+	}
+
+	return rr.fetchAccessToken("")
+}
+
+func (rr ReportRequester) fetchAccessToken(refreshToken string) (oauth.Response, error) {
 	baseUrl := "https://auth.glispaconnect.com"
 	resource := "/token"
 	body := url.Values{}
@@ -184,9 +244,9 @@ func (rr ReportRequester) fetchAccessToken() string {
 	body.Add("client_secret", rr.ClientSecret)
 
 	var grantType string
-	if rr.RefreshToken != "" {
+	if refreshToken != "" {
 		grantType = "refresh_token"
-		body.Add("refresh_token", rr.RefreshToken)
+		body.Add("refresh_token", refreshToken)
 	} else {
 		grantType = "password"
 		body.Add("username", rr.Username)
@@ -201,25 +261,31 @@ func (rr ReportRequester) fetchAccessToken() string {
 	client := &http.Client{}
 	n, err := http.NewRequest(http.MethodPost, requestUrl.String(), strings.NewReader(body.Encode()))
 	if err != nil {
-		log.Fatalln(err)
-		return ""
+		return oauth.Response{}, err
 	}
 
 	n.Header.Add("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
 
 	resp, err := client.Do(n)
 	if err != nil {
-		return ""
+		return oauth.Response{}, err
 	}
 
-	authModel, _, err := rr.unmarshalAuth(resp.Body)
+	authModel, authError, err := rr.unmarshalAuth(resp.Body)
 	defer resp.Body.Close()
 	if err != nil {
-		return ""
+		return oauth.Response{}, err
+	}
+
+	if authModel.AccessToken == "" {
+		return oauth.Response{}, fmt.Errorf("%v: %v (%v)", rr.GetName(), authError.ErrorDescription, authError.Error)
 	}
 
-	rr.RefreshToken = authModel.RefreshToken
-	return authModel.AccessToken
+	return oauth.Response{
+		AccessToken:  authModel.AccessToken,
+		RefreshToken: authModel.RefreshToken,
+		ExpiresIn:    authModel.ExpiresIn,
+	}, nil
 }
 
 func (rr ReportRequester) unmarshalAuth(reader io.Reader) (AuthResponse, AuthErrorResponse, error) {
@@ -269,8 +335,20 @@ func (rr ReportRequester) convertToReportModel(response ReportResponse) ([]myrev
 		reportModels[i].Revenue = d.Result.Earnings
 		reportModels[i].Impressions = uint64(d.Result.Impressions)
 		reportModels[i].Requests = uint64(d.Result.AdRequests)
+		reportModels[i].Clicks = uint64(d.Result.Clicks)
 		reportModels[i].CTR = d.Result.Ctr
+		reportModels[i].ECPM = d.Result.Ecpm
 		reportModels[i].DateTime = d.Timestamp
+		reportModels[i].Currency = strings.ToUpper(response.Meta.Currency)
+
+		reportModels[i].Country = d.Dimensions.Country
+		reportModels[i].App = d.Dimensions.AppID
+		reportModels[i].AdUnit = d.Dimensions.AdunitID
+		reportModels[i].Format = d.Dimensions.AdunitType
+		reportModels[i].Platform = d.Dimensions.DeviceOs
+
+		reportModels[i].SetExtendedMetric(RENDER_RATE, d.Result.RenderRate)
+		reportModels[i].SetExtendedMetric(FILL_RATE, d.Result.FillRate)
 	}
 
 	return reportModels, nil
@@ -0,0 +1,33 @@
+package glispa
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCopiesCurrency(t *testing.T) {
+	report := `{
+		"query": {"granularity": "day", "group": ["country"]},
+		"data": [
+			{"timestamp": "2018-10-01T00:00:00Z", "dimensions": {"country": "DE"}, "result": {"earnings": 12.5, "impressions": 5000}}
+		],
+		"meta": {"currency": "eur"}
+	}`
+
+	models, err := ReportParser{}.ParseRevenue(strings.NewReader(report))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(models) != 1 {
+		t.Fatalf("got %v models, want 1", len(models))
+	}
+
+	if models[0].Currency != "EUR" {
+		t.Errorf("Currency = %q, want EUR", models[0].Currency)
+	}
+
+	if record := models[0].Record(); record.Currency != "EUR" {
+		t.Errorf("Record().Currency = %q, want EUR rather than the USD default", record.Currency)
+	}
+}
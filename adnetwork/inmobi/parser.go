@@ -0,0 +1,33 @@
+package inmobi
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/econnelly/myrevenue"
+	"github.com/econnelly/myrevenue/adnetwork"
+	"io"
+	"io/ioutil"
+)
+
+// ReportParser reads saved reporting API responses
+type ReportParser struct {
+	adnetwork.DirectlyParsable
+}
+
+func (r ReportParser) ParseRevenue(reader io.Reader) ([]myrevenue.Model, error) {
+	if reader == nil {
+		return nil, errors.New("reader is nil")
+	}
+
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	result := ReportResponse{}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+
+	return ReportRequester{}.convertToReportModel(result)
+}
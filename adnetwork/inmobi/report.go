@@ -2,26 +2,33 @@ package inmobi
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
 	"github.com/econnelly/myrevenue"
 	"github.com/econnelly/myrevenue/adnetwork"
 	"io"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"net/url"
 	"time"
 )
 
+const DEFAULT_BASE_URL = "https://api.inmobi.com"
+
 type ReportRequester struct {
 	SessionID string `json:"session_id"`
 	AccountID string `json:"account_id"`
 	Username  string `json:"username"`
 	SecretKey string `json:"secret_key"`
+	BaseURL   string `json:"base_url"` // Defaults to DEFAULT_BASE_URL
 	StartDate time.Time
 	EndDate   time.Time
 
+	GroupBy []string        `json:"group_by"` // Any of "country", "inventoryId", "placementId" and "platform", see the group by constants. Rows are always grouped by date.
+	Filters []RequestFilter `json:"filters"`  // Added to the default adImpressions > 0 filter
+
+	SessionStore SessionStore    `json:"-"` // Defaults to DefaultSessionStore
+	Clock        myrevenue.Clock `json:"-"` // Defaults to myrevenue.SystemClock
+
 	adnetwork.Request
 
 	reportURL string
@@ -29,17 +36,20 @@ type ReportRequester struct {
 }
 
 type ReportResponse struct {
-	Error     bool `json:"error"`
-	ErrorList []struct {
-		Message string `json:"message"`
-		Code    int    `json:"code"`
-	} `json:"errorList"`
-	RespList []struct {
+	Error     bool          `json:"error"`
+	ErrorList []ErrorDetail `json:"errorList"`
+	RespList  []struct {
 		AdImpressions uint64  `json:"adImpressions"`
 		AdRequests    uint64  `json:"adRequests"`
 		Clicks        int     `json:"clicks"`
 		Earnings      float64 `json:"earnings"`
 		Date          string  `json:"date"`
+		Country       string  `json:"country"`
+		InventoryID   ID      `json:"inventoryId"`
+		InventoryName string  `json:"inventoryName"`
+		PlacementID   ID      `json:"placementId"`
+		PlacementName string  `json:"placementName"`
+		Platform      string  `json:"platform"`
 	} `json:"respList"`
 }
 
@@ -50,9 +60,40 @@ type Session struct {
 		SubAccounts interface{} `json:"subAccounts"`
 	} `json:"respList"`
 	Error     bool          `json:"error"`
-	ErrorList []interface{} `json:"errorList"`
+	ErrorList []ErrorDetail `json:"errorList"`
+}
+
+// ID is an identifier InMobi may send as either a JSON number or string
+type ID string
+
+func (id *ID) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+
+	var str string
+	if err := json.Unmarshal(data, &str); err == nil {
+		*id = ID(str)
+		return nil
+	}
+
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err != nil {
+		return err
+	}
+	*id = ID(number.String())
+	return nil
 }
 
+// Group by
+const (
+	DATE         = "date"
+	COUNTRY      = "country"
+	INVENTORY_ID = "inventoryId"
+	PLACEMENT_ID = "placementId"
+	PLATFORM     = "platform"
+)
+
 type RequestFilter struct {
 	FilterName  string `json:"filterName"`
 	FilterValue string `json:"filterValue"`
@@ -71,22 +112,55 @@ type RequestData struct {
 }
 
 func (rr *ReportRequester) Initialize() error {
+	if rr.BaseURL == "" {
+		rr.BaseURL = DEFAULT_BASE_URL
+	}
+
+	if rr.SessionStore == nil {
+		rr.SessionStore = DefaultSessionStore
+	}
+
+	if rr.Clock == nil {
+		rr.Clock = myrevenue.SystemClock
+	}
+
+	cached, err := rr.SessionStore.Load(rr.Username)
+	if err == nil && rr.Clock.Now().Before(cached.Expiry) {
+		rr.SessionID, rr.AccountID = cached.SessionID, cached.AccountID
+		return nil
+	} else if err != nil && err != ErrSessionNotFound {
+		return err
+	}
+
+	return rr.renewSession()
+}
+
+func (rr *ReportRequester) renewSession() error {
 	var err error
 	rr.SessionID, rr.AccountID, err = rr.startSession()
-	return err
+	if err != nil {
+		return err
+	}
+
+	return rr.SessionStore.Save(rr.Username, CachedSession{
+		SessionID: rr.SessionID,
+		AccountID: rr.AccountID,
+		Expiry:    rr.Clock.Now().Add(SessionLifetime),
+	})
 }
 
 func (rr *ReportRequester) startSession() (string, string, error) {
-	baseUrl := "https://api.inmobi.com"
 	resource := "/v1.0/generatesession/generate"
 
-	requestUrl, _ := url.ParseRequestURI(baseUrl)
+	requestUrl, err := url.ParseRequestURI(rr.BaseURL)
+	if err != nil {
+		return "", "", err
+	}
 	requestUrl.Path = resource
 
 	client := &http.Client{}
 	n, err := http.NewRequest(http.MethodGet, requestUrl.String(), nil)
 	if err != nil {
-		log.Fatalln(err)
 		return "", "", err
 	}
 
@@ -105,6 +179,10 @@ func (rr *ReportRequester) startSession() (string, string, error) {
 		return "", "", err
 	}
 
+	if session.Error || len(session.RespList) == 0 {
+		return "", "", &Error{StatusCode: resp.StatusCode, Errors: session.ErrorList}
+	}
+
 	return session.RespList[0].SessionID, session.RespList[0].AccountID, nil
 }
 
@@ -121,14 +199,27 @@ func (rr ReportRequester) createSessionModel(reader io.Reader) (Session, error)
 		return result, e
 	}
 
-	if result.RespList == nil || len(result.RespList) == 0 {
-		return result, e
-	}
-
 	return result, nil
 }
 
 func (rr *ReportRequester) Fetch() ([]myrevenue.Model, error) {
+	models, err := rr.fetch()
+
+	if apiError, ok := err.(*Error); ok && apiError.SessionExpired() {
+		if err := rr.SessionStore.Delete(rr.Username); err != nil {
+			return nil, err
+		}
+		if err := rr.renewSession(); err != nil {
+			return nil, err
+		}
+
+		return rr.fetch()
+	}
+
+	return models, err
+}
+
+func (rr *ReportRequester) fetch() ([]myrevenue.Model, error) {
 	headers := map[string]string{
 		"Accept":       "application/json; charset=utf-8",
 		"Content-Type": "application/json",
@@ -140,16 +231,24 @@ func (rr *ReportRequester) Fetch() ([]myrevenue.Model, error) {
 	startDate := rr.StartDate.UTC().Format("2006-01-02")
 	endDate := rr.EndDate.UTC().Format("2006-01-02")
 
-	filter := make([]RequestFilter, 1)
+	filter := make([]RequestFilter, 1, len(rr.Filters)+1)
 	filter[0].Comparator = ">"
 	filter[0].FilterName = "adImpressions"
 	filter[0].FilterValue = "0"
+	filter = append(filter, rr.Filters...)
+
+	groupBy := []string{DATE}
+	for _, g := range rr.GroupBy {
+		if g != DATE {
+			groupBy = append(groupBy, g)
+		}
+	}
 
 	dataStruct := RequestData{
 		ReportRequest: RequestInfo{
 			Metrics:   []string{"adRequests", "adImpressions", "clicks", "earnings"},
 			TimeFrame: fmt.Sprintf("%v:%v", startDate, endDate),
-			GroupBy:   []string{"date"},
+			GroupBy:   groupBy,
 			FilterBy:  filter,
 		},
 	}
@@ -159,31 +258,43 @@ func (rr *ReportRequester) Fetch() ([]myrevenue.Model, error) {
 		return nil, err
 	}
 
-	baseUrl := "https://api.inmobi.com"
 	resource := "/v3.0/reporting/publisher"
 
-	requestUrl, _ := url.ParseRequestURI(baseUrl)
+	requestUrl, err := url.ParseRequestURI(rr.BaseURL)
+	if err != nil {
+		return nil, err
+	}
 	requestUrl.Path = resource
 
 	resp, err := myrevenue.PostRequest(requestUrl.String(), headers, string(data), false)
+	if err != nil {
+		return nil, err
+	}
 	defer resp.Body.Close()
 
-	return rr.parse(resp.Body)
+	return rr.parse(resp)
 }
 
-func (rr *ReportRequester) parse(reader io.ReadCloser) ([]myrevenue.Model, error) {
+func (rr *ReportRequester) parse(resp *http.Response) ([]myrevenue.Model, error) {
 	result := ReportResponse{}
 
-	body, err := ioutil.ReadAll(reader)
+	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
 	}
 
 	e := json.Unmarshal(body, &result)
 	if e != nil {
+		if resp.StatusCode != http.StatusOK {
+			return nil, &Error{StatusCode: resp.StatusCode}
+		}
 		return nil, e
 	}
 
+	if result.Error || resp.StatusCode != http.StatusOK {
+		return nil, &Error{StatusCode: resp.StatusCode, Errors: result.ErrorList}
+	}
+
 	rr.rawData = result
 	return rr.convertToReportModel(result)
 }
@@ -192,8 +303,7 @@ func (rr ReportRequester) convertToReportModel(response ReportResponse) ([]myrev
 	reportModels := make([]myrevenue.Model, len(response.RespList))
 
 	if response.Error {
-		responseError := response.ErrorList[0]
-		return nil, errors.New(responseError.Message)
+		return nil, &Error{Errors: response.ErrorList}
 	}
 
 	loc, e := time.LoadLocation("Etc/UTC")
@@ -202,9 +312,28 @@ func (rr ReportRequester) convertToReportModel(response ReportResponse) ([]myrev
 	}
 
 	for i, item := range response.RespList {
+		reportModels[i].NetworkName = rr.GetName()
 		reportModels[i].Impressions = item.AdImpressions
 		reportModels[i].Revenue = item.Earnings
 		reportModels[i].Requests = item.AdRequests
+		reportModels[i].Clicks = uint64(item.Clicks)
+		reportModels[i].Country = item.Country
+		reportModels[i].Platform = item.Platform
+
+		reportModels[i].App = item.InventoryName
+		if reportModels[i].App == "" {
+			reportModels[i].App = string(item.InventoryID)
+		}
+
+		reportModels[i].AdUnit = item.PlacementName
+		if reportModels[i].AdUnit == "" {
+			reportModels[i].AdUnit = string(item.PlacementID)
+		}
+
+		if item.AdImpressions > 0 {
+			reportModels[i].CTR = float64(item.Clicks) / float64(item.AdImpressions)
+			reportModels[i].ECPM = item.Earnings / float64(item.AdImpressions) * 1000
+		}
 		day, parseError := time.ParseInLocation("2006-01-02 15:04:05", item.Date, loc)
 		if parseError != nil {
 			return nil, parseError
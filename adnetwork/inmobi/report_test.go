@@ -0,0 +1,271 @@
+package inmobi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/econnelly/myrevenue"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServer issues sessions and only accepts the latest one for reports
+type fakeServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	sessions int
+	reports  int
+	valid    string
+	expiry   int // Status code for rejected sessions, 200 with an errorList otherwise
+	report   string
+	lastBody RequestData
+}
+
+func newFakeServer(t *testing.T, report string) *fakeServer {
+	s := &fakeServer{report: report, expiry: http.StatusOK}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1.0/generatesession/generate", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if r.Header.Get("userName") != "user" || r.Header.Get("secretKey") != "secret" {
+			fmt.Fprint(w, `{"error": true, "errorList": [{"message": "Invalid credentials", "code": 1001}]}`)
+			return
+		}
+
+		s.sessions++
+		s.valid = fmt.Sprintf("session-%v", s.sessions)
+		fmt.Fprintf(w, `{"error": false, "respList": [{"sessionId": %q, "accountId": "account"}]}`, s.valid)
+	})
+	mux.HandleFunc("/v3.0/reporting/publisher", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.reports++
+		s.lastBody = RequestData{}
+		if err := json.NewDecoder(r.Body).Decode(&s.lastBody); err != nil {
+			t.Error(err)
+		}
+
+		if r.Header.Get("sessionId") != s.valid || r.Header.Get("accountId") != "account" {
+			w.WriteHeader(s.expiry)
+			fmt.Fprint(w, `{"error": true, "errorList": [{"message": "Session has expired. Please generate a new session.", "code": 5004}]}`)
+			return
+		}
+
+		http.ServeFile(w, r, s.report)
+	})
+	s.Server = httptest.NewServer(mux)
+
+	return s
+}
+
+// expire makes the server forget every session it issued
+func (s *fakeServer) expire() {
+	s.mu.Lock()
+	s.valid = ""
+	s.mu.Unlock()
+}
+
+func newRequester(server *fakeServer, store SessionStore, clock myrevenue.Clock) *ReportRequester {
+	return &ReportRequester{
+		Username:     "user",
+		SecretKey:    "secret",
+		BaseURL:      server.URL,
+		StartDate:    time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:      time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC),
+		SessionStore: store,
+		Clock:        clock,
+	}
+}
+
+func TestFetchReusesSession(t *testing.T) {
+	server := newFakeServer(t, "testdata/report.json")
+	defer server.Close()
+
+	store := NewMemorySessionStore()
+	clock := myrevenue.NewFakeClock(time.Date(2018, time.October, 2, 9, 0, 0, 0, time.UTC))
+
+	for i := 0; i < 2; i++ {
+		rr := newRequester(server, store, clock)
+		if err := rr.Initialize(); err != nil {
+			t.Fatal(err)
+		}
+
+		models, err := rr.Fetch()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(models) != 1 || models[0].Revenue != 2.5 || models[0].Requests != 1200 {
+			t.Errorf("models = %+v", models)
+		}
+	}
+
+	if server.sessions != 1 {
+		t.Errorf("generated %v sessions, want 1", server.sessions)
+	}
+
+	// Past its lifetime the cached session isn't used
+	clock.Advance(SessionLifetime)
+	if err := newRequester(server, store, clock).Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	if server.sessions != 2 {
+		t.Errorf("generated %v sessions, want a new one after expiry", server.sessions)
+	}
+}
+
+func TestFetchRetriesExpiredSession(t *testing.T) {
+	for _, status := range []int{http.StatusOK, http.StatusUnauthorized} {
+		server := newFakeServer(t, "testdata/report.json")
+		server.expiry = status
+
+		store := NewMemorySessionStore()
+		rr := newRequester(server, store, nil)
+		if err := rr.Initialize(); err != nil {
+			t.Fatal(err)
+		}
+
+		// InMobi dropped the session before its cached expiry
+		server.expire()
+
+		models, err := rr.Fetch()
+		if err != nil {
+			t.Fatalf("status %v: %v", status, err)
+		}
+		if len(models) != 1 {
+			t.Errorf("status %v: got %v models, want 1", status, len(models))
+		}
+
+		if server.sessions != 2 || server.reports != 2 {
+			t.Errorf("status %v: %v sessions and %v reports, want one retry", status, server.sessions, server.reports)
+		}
+		if cached, _ := store.Load("user"); cached.SessionID != "session-2" {
+			t.Errorf("status %v: cached session = %v, want the new one", status, cached.SessionID)
+		}
+
+		server.Close()
+	}
+}
+
+func TestFetchRenewalFails(t *testing.T) {
+	server := newFakeServer(t, "testdata/report.json")
+	defer server.Close()
+
+	rr := newRequester(server, NewMemorySessionStore(), nil)
+	if err := rr.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The session is rejected and a new one can't be generated
+	rr.SessionID = "rejected"
+	rr.SecretKey = "wrong"
+
+	if _, err := rr.Fetch(); err == nil {
+		t.Error("expected an error")
+	}
+	if server.reports != 1 {
+		t.Errorf("made %v report requests, want no retry without a new session", server.reports)
+	}
+}
+
+// failingStore can't delete sessions
+type failingStore struct {
+	*MemorySessionStore
+}
+
+func (failingStore) Delete(string) error {
+	return errors.New("store is read only")
+}
+
+func TestFetchReportsDeleteError(t *testing.T) {
+	server := newFakeServer(t, "testdata/report.json")
+	defer server.Close()
+
+	rr := newRequester(server, failingStore{NewMemorySessionStore()}, nil)
+	if err := rr.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	server.expire()
+
+	if _, err := rr.Fetch(); err == nil || err.Error() != "store is read only" {
+		t.Errorf("Fetch() error = %v", err)
+	}
+}
+
+func TestSessionExpired(t *testing.T) {
+	tests := []struct {
+		err     Error
+		expired bool
+	}{
+		{Error{StatusCode: 401}, true},
+		{Error{StatusCode: 403}, true},
+		{Error{StatusCode: 500}, false},
+		{Error{StatusCode: 200, Errors: []ErrorDetail{{Message: "Session has expired"}}}, true},
+		{Error{StatusCode: 200, Errors: []ErrorDetail{{Message: "Invalid sessionId"}}}, true},
+		{Error{StatusCode: 200, Errors: []ErrorDetail{{Message: "Invalid date range"}}}, false},
+		{Error{StatusCode: 200, Errors: []ErrorDetail{{Message: "Request limit exceeded"}, {Message: "SESSION EXPIRED"}}}, true},
+	}
+
+	for _, test := range tests {
+		if got := test.err.SessionExpired(); got != test.expired {
+			t.Errorf("%v: SessionExpired() = %v, want %v", test.err.Error(), got, test.expired)
+		}
+	}
+}
+
+func TestFetchGrouped(t *testing.T) {
+	server := newFakeServer(t, "testdata/grouped_report.json")
+	defer server.Close()
+
+	rr := newRequester(server, NewMemorySessionStore(), nil)
+	rr.GroupBy = []string{COUNTRY, INVENTORY_ID, PLACEMENT_ID, PLATFORM, DATE}
+	if err := rr.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	models, err := rr.Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Date always comes first, and only once
+	request := server.lastBody.ReportRequest
+	if fmt.Sprint(request.GroupBy) != "[date country inventoryId placementId platform]" {
+		t.Errorf("groupBy = %v", request.GroupBy)
+	}
+	if request.TimeFrame != "2018-10-01:2018-10-01" || len(request.FilterBy) != 1 || request.FilterBy[0].FilterName != "adImpressions" {
+		t.Errorf("request = %+v", request)
+	}
+
+	if len(models) != 2 {
+		t.Fatalf("got %v models, want 2", len(models))
+	}
+
+	// Names are preferred, IDs of either JSON type fill in for them
+	tests := []struct {
+		country  string
+		app      string
+		adUnit   string
+		platform string
+		ecpm     float64
+	}{
+		{"US", "Example App", "Home Banner", "Android", 5},
+		{"IN", "1234567890123", "98766", "Android", 2.5},
+	}
+
+	for i, test := range tests {
+		m := models[i]
+		if m.Country != test.country || m.App != test.app || m.AdUnit != test.adUnit || m.Platform != test.platform || m.ECPM != test.ecpm {
+			t.Errorf("model %v = %+v", i, m)
+		}
+		if m.DateTime.Format("2006-01-02") != "2018-10-01" {
+			t.Errorf("model %v: DateTime = %v", i, m.DateTime)
+		}
+	}
+}
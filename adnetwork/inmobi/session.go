@@ -0,0 +1,109 @@
+package inmobi
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SessionLifetime is how long InMobi honours a generated session
+const SessionLifetime = 24 * time.Hour
+
+var ErrSessionNotFound = errors.New("session not found")
+
+type CachedSession struct {
+	SessionID string    `json:"session_id"`
+	AccountID string    `json:"account_id"`
+	Expiry    time.Time `json:"expiry"`
+}
+
+// SessionStore keeps sessions by username so requesters for the same account
+// don't each generate a new one
+type SessionStore interface {
+	Load(username string) (CachedSession, error)
+	Save(username string, session CachedSession) error
+	Delete(username string) error
+}
+
+type MemorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]CachedSession
+}
+
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: make(map[string]CachedSession)}
+}
+
+func (s *MemorySessionStore) Load(username string) (CachedSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, found := s.sessions[username]
+	if !found {
+		return CachedSession{}, ErrSessionNotFound
+	}
+	return session, nil
+}
+
+func (s *MemorySessionStore) Save(username string, session CachedSession) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.sessions == nil {
+		s.sessions = make(map[string]CachedSession)
+	}
+	s.sessions[username] = session
+	return nil
+}
+
+func (s *MemorySessionStore) Delete(username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, username)
+	return nil
+}
+
+// DefaultSessionStore is used by requesters that don't set their own
+var DefaultSessionStore SessionStore = NewMemorySessionStore()
+
+type ErrorDetail struct {
+	Message string `json:"message"`
+	Code    int    `json:"code"`
+}
+
+// Error carries the errorList returned by the session and reporting APIs
+type Error struct {
+	StatusCode int
+	Errors     []ErrorDetail
+}
+
+func (e *Error) Error() string {
+	if len(e.Errors) == 0 {
+		return fmt.Sprintf("Inmobi: request failed (%v)", e.StatusCode)
+	}
+
+	messages := make([]string, len(e.Errors))
+	for i, detail := range e.Errors {
+		messages[i] = fmt.Sprintf("%v (%v)", detail.Message, detail.Code)
+	}
+	return "Inmobi: " + strings.Join(messages, "; ")
+}
+
+// SessionExpired reports whether a new session should be generated before
+// retrying the request
+func (e *Error) SessionExpired() bool {
+	if e.StatusCode == 401 || e.StatusCode == 403 {
+		return true
+	}
+
+	for _, detail := range e.Errors {
+		message := strings.ToLower(detail.Message)
+		if strings.Contains(message, "session") && (strings.Contains(message, "expired") || strings.Contains(message, "invalid")) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+// Package ironsourcetest provides a local stand-in for the ironSource
+// platform API, so the ironsource adapter can be exercised without network
+// access or real credentials.
+package ironsourcetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+const (
+	SECRET_KEY    = "test-secret-key"
+	REFRESH_TOKEN = "test-refresh-token"
+	BEARER_TOKEN  = "test-bearer-token"
+)
+
+// Server serves the auth and stats endpoints. Stats is returned as-is from the
+// stats endpoint once the request carries a valid bearer token.
+type Server struct {
+	*httptest.Server
+
+	Stats interface{}
+
+	mu         sync.Mutex
+	token      string
+	expired    int
+	authCalls  int
+	statsCalls int
+	lastQuery  map[string][]string
+}
+
+func NewServer(stats interface{}) *Server {
+	s := &Server{Stats: stats, token: BEARER_TOKEN}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/partners/publisher/auth", s.auth)
+	mux.HandleFunc("/partners/publisher/mediation/applications/v6/stats", s.stats)
+	s.Server = httptest.NewServer(mux)
+
+	return s
+}
+
+func (s *Server) auth(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.authCalls++
+	s.mu.Unlock()
+
+	if r.Header.Get("secretkey") != SECRET_KEY || r.Header.Get("refreshToken") != REFRESH_TOKEN {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"code":401,"message":"invalid credentials"}`)
+		return
+	}
+
+	s.mu.Lock()
+	token := s.token
+	s.mu.Unlock()
+
+	json.NewEncoder(w).Encode(token)
+}
+
+func (s *Server) stats(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.statsCalls++
+	s.lastQuery = r.URL.Query()
+	s.mu.Unlock()
+
+	s.mu.Lock()
+	token := s.token
+	s.mu.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer "+token {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"code":401,"message":"invalid token"}`)
+		return
+	}
+
+	json.NewEncoder(w).Encode(s.Stats)
+}
+
+// ExpireToken rejects the current bearer token, as the API does once it
+// expires, and issues a new one on the next auth call
+func (s *Server) ExpireToken() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expired++
+	s.token = fmt.Sprintf("%v-%v", BEARER_TOKEN, s.expired)
+}
+
+// AuthCalls is how many times a bearer token was requested
+func (s *Server) AuthCalls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.authCalls
+}
+
+// StatsCalls is how many times the stats endpoint was requested
+func (s *Server) StatsCalls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.statsCalls
+}
+
+// LastQuery is the query string of the most recent stats request
+func (s *Server) LastQuery() map[string][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastQuery
+}
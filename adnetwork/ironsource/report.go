@@ -0,0 +1,278 @@
+package ironsource
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"github.com/econnelly/myrevenue"
+	"github.com/econnelly/myrevenue/adnetwork"
+	"github.com/econnelly/myrevenue/adnetwork/oauth"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const DEFAULT_BASE_URL = "https://platform.ironsrc.com"
+
+// TOKEN_LIFETIME is how long a bearer token from the auth endpoint is valid
+const TOKEN_LIFETIME = 60 * time.Minute
+
+type ReportRequester struct {
+	SecretKey    string   `json:"secret_key"`
+	RefreshToken string   `json:"refresh_token"`
+	AppKeys      []string `json:"app_keys"`   // Defaults to every app
+	Breakdowns   []string `json:"breakdowns"` // Defaults to DATE, APP, AD_UNITS, COUNTRY and AD_SOURCE
+	BaseURL      string   `json:"base_url"`   // Defaults to DEFAULT_BASE_URL
+	StartDate    time.Time
+	EndDate      time.Time
+	TokenStore   oauth.TokenStore `json:"-"` // Optional, persists bearer tokens across runs
+	adnetwork.Request
+
+	tokens    *oauth.Manager
+	reportURL string
+	rawData   ReportResponse
+}
+
+// ReportResponse has one entry per combination of the non-country
+// breakdowns, with country rows nested in Data
+type ReportResponse []struct {
+	AppKey       string       `json:"appKey"`
+	AppName      string       `json:"appName"`
+	Platform     string       `json:"platform"`
+	AdUnits      string       `json:"adUnits"`
+	ProviderName string       `json:"providerName"`
+	InstanceName string       `json:"instanceName"`
+	Date         string       `json:"date"`
+	Data         []ReportData `json:"data"`
+}
+
+type ReportData struct {
+	CountryCode       string  `json:"countryCode"`
+	Revenue           float64 `json:"revenue"`
+	Impressions       uint64  `json:"impressions"`
+	Clicks            uint64  `json:"clicks"`
+	AdSourceChecks    uint64  `json:"adSourceChecks"`
+	AdSourceResponses uint64  `json:"adSourceResponses"`
+	ECPM              float64 `json:"eCPM"`
+}
+
+type ErrorResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Errors  string `json:"errors"`
+}
+
+// Breakdowns
+const (
+	DATE      = "date"
+	APP       = "app"
+	PLATFORM  = "platform"
+	AD_UNITS  = "adUnits"
+	COUNTRY   = "country"
+	AD_SOURCE = "adSource"
+	INSTANCE  = "instance"
+)
+
+// Metrics
+const (
+	REVENUE             = "revenue"
+	IMPRESSIONS         = "impressions"
+	CLICKS              = "clicks"
+	AD_SOURCE_CHECKS    = "adSourceChecks"
+	AD_SOURCE_RESPONSES = "adSourceResponses"
+	ECPM                = "eCPM"
+)
+
+func (rr *ReportRequester) Initialize() error {
+	if rr.SecretKey == "" || rr.RefreshToken == "" {
+		return errors.New("ironSource: secret key and refresh token are required")
+	}
+
+	if rr.BaseURL == "" {
+		rr.BaseURL = DEFAULT_BASE_URL
+	}
+
+	breakdowns := rr.Breakdowns
+	if len(breakdowns) == 0 {
+		breakdowns = []string{DATE, APP, AD_UNITS, COUNTRY, AD_SOURCE}
+	}
+
+	rr.tokens = oauth.Shared(rr.tokenKey(), rr.RefreshToken, rr.TokenStore, rr.fetchBearerToken)
+
+	query := url.Values{}
+	query.Set("startDate", rr.StartDate.Format("2006-01-02"))
+	query.Add("endDate", rr.EndDate.Format("2006-01-02"))
+	query.Add("breakdowns", strings.Join(breakdowns, ","))
+	query.Add("metrics", strings.Join([]string{REVENUE, IMPRESSIONS, CLICKS, AD_SOURCE_CHECKS, AD_SOURCE_RESPONSES, ECPM}, ","))
+	if len(rr.AppKeys) > 0 {
+		query.Add("appKey", strings.Join(rr.AppKeys, ","))
+	}
+
+	rr.reportURL = fmt.Sprintf("%v/partners/publisher/mediation/applications/v6/stats?%v", rr.BaseURL, query.Encode())
+
+	return nil
+}
+
+func (rr *ReportRequester) Fetch() ([]myrevenue.Model, error) {
+	token, err := rr.tokens.AccessToken()
+	if err != nil {
+		return nil, err
+	}
+
+	headers := map[string]string{
+		"Accept":        "application/json",
+		"Authorization": fmt.Sprintf("Bearer %v", token),
+	}
+
+	resp, err := myrevenue.GetRequest(rr.reportURL, headers, false)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized {
+		rr.tokens.Invalidate()
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, rr.parseError(resp)
+	}
+
+	return rr.parse(resp.Body)
+}
+
+func (rr *ReportRequester) parse(reader io.Reader) ([]myrevenue.Model, error) {
+	result := ReportResponse{}
+
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+
+	rr.rawData = result
+	return rr.convertToReportModel(result)
+}
+
+func (rr ReportRequester) convertToReportModel(response ReportResponse) ([]myrevenue.Model, error) {
+	loc, e := time.LoadLocation("Etc/UTC")
+	if e != nil {
+		return nil, e
+	}
+
+	reportModels := make([]myrevenue.Model, 0, len(response))
+	for i, item := range response {
+		day, err := time.ParseInLocation("2006-01-02", item.Date, loc)
+		if err != nil {
+			return nil, &myrevenue.ParseError{Network: rr.GetName(), Row: i + 1, Column: DATE, Err: err}
+		}
+
+		for _, data := range item.Data {
+			model := myrevenue.Model{}
+			model.NetworkName = rr.GetName()
+			model.DateTime = day
+			model.App = item.AppKey
+			model.Name = item.AppName
+			model.Platform = item.Platform
+			model.Format = item.AdUnits
+			model.AdSource = item.ProviderName
+			model.AdSourceInstance = item.InstanceName
+			model.Country = data.CountryCode
+
+			model.Revenue = data.Revenue
+			model.Impressions = data.Impressions
+			model.Clicks = data.Clicks
+			model.Requests = data.AdSourceChecks
+			model.ECPM = data.ECPM
+			if data.Impressions > 0 {
+				model.CTR = float64(data.Clicks) / float64(data.Impressions)
+			}
+
+			model.SetExtendedMetric(AD_SOURCE_RESPONSES, float64(data.AdSourceResponses))
+
+			reportModels = append(reportModels, model)
+		}
+	}
+
+	return reportModels, nil
+}
+
+// fetchBearerToken exchanges the secret key and refresh token for a JWT. The
+// refresh token is long lived and never rotated.
+func (rr ReportRequester) fetchBearerToken(refreshToken string) (oauth.Response, error) {
+	headers := map[string]string{
+		"secretkey":    rr.SecretKey,
+		"refreshToken": refreshToken,
+	}
+
+	resp, err := myrevenue.GetRequest(rr.BaseURL+"/partners/publisher/auth", headers, false)
+	if err != nil {
+		return oauth.Response{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return oauth.Response{}, rr.parseError(resp)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return oauth.Response{}, err
+	}
+
+	// The token comes back as a bare JSON string
+	token := strings.TrimSpace(string(body))
+	var quoted string
+	if json.Unmarshal(body, &quoted) == nil {
+		token = quoted
+	}
+
+	return oauth.Response{AccessToken: token, ExpiresIn: int(TOKEN_LIFETIME / time.Second)}, nil
+}
+
+func (rr ReportRequester) parseError(resp *http.Response) error {
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	result := ErrorResponse{}
+	if json.Unmarshal(body, &result) != nil || (result.Message == "" && result.Errors == "") {
+		return errors.Errorf("%v: request failed (%v): %v", rr.GetName(), resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	message := result.Message
+	if message == "" {
+		message = result.Errors
+	}
+	return errors.Errorf("%v: %v (%v)", rr.GetName(), message, resp.StatusCode)
+}
+
+// tokenKey identifies the account without putting the secret in the store
+func (rr ReportRequester) tokenKey() string {
+	sum := sha256.Sum256([]byte(rr.SecretKey))
+	return fmt.Sprintf("ironsource:%x", sum[:8])
+}
+
+func (ReportRequester) GetName() string {
+	return "ironSource"
+}
+
+func (rr ReportRequester) GetReport() interface{} {
+	return rr.rawData
+}
+
+func (rr ReportRequester) GetStartDate() time.Time {
+	return rr.StartDate
+}
+
+func (rr ReportRequester) GetEndDate() time.Time {
+	return rr.EndDate
+}
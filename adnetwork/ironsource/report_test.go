@@ -0,0 +1,143 @@
+package ironsource
+
+import (
+	"github.com/econnelly/myrevenue/adnetwork/ironsource/ironsourcetest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testStats = []map[string]interface{}{
+	{
+		"appKey":       "app-1",
+		"appName":      "Example App",
+		"platform":     "Android",
+		"adUnits":      "Rewarded Video",
+		"providerName": "ironSource",
+		"date":         "2018-10-01",
+		"data": []map[string]interface{}{
+			{"countryCode": "US", "revenue": 10.5, "impressions": 1000, "clicks": 10, "adSourceChecks": 1200, "adSourceResponses": 1100, "eCPM": 10.5},
+			{"countryCode": "DE", "revenue": 2, "impressions": 400, "clicks": 0, "adSourceChecks": 500, "adSourceResponses": 450, "eCPM": 5},
+		},
+	},
+	{
+		"appKey":       "app-1",
+		"appName":      "Example App",
+		"platform":     "Android",
+		"adUnits":      "Interstitial",
+		"providerName": "AdMob",
+		"date":         "2018-10-02",
+		"data": []map[string]interface{}{
+			{"countryCode": "US", "revenue": 1.25, "impressions": 250, "clicks": 5, "adSourceChecks": 300, "adSourceResponses": 280, "eCPM": 5},
+		},
+	},
+}
+
+func newRequester(t *testing.T, server *ironsourcetest.Server) *ReportRequester {
+	rr := &ReportRequester{
+		SecretKey:    ironsourcetest.SECRET_KEY,
+		RefreshToken: ironsourcetest.REFRESH_TOKEN,
+		AppKeys:      []string{"app-1", "app-2"},
+		BaseURL:      server.URL,
+		StartDate:    time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:      time.Date(2018, time.October, 2, 0, 0, 0, 0, time.UTC),
+	}
+	if err := rr.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Tokens are shared process-wide per account, start every test without one
+	rr.tokens.Invalidate()
+	return rr
+}
+
+func TestFetchFlattensCountries(t *testing.T) {
+	server := ironsourcetest.NewServer(testStats)
+	defer server.Close()
+
+	models, err := newRequester(t, server).Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(models) != 3 {
+		t.Fatalf("got %v models, want one per country row", len(models))
+	}
+
+	m := models[1]
+	if m.Country != "DE" || m.App != "app-1" || m.Name != "Example App" || m.Format != "Rewarded Video" || m.AdSource != "ironSource" {
+		t.Errorf("dimensions = %+v", m)
+	}
+	if m.Revenue != 2 || m.Impressions != 400 || m.Requests != 500 || m.ExtendedMetrics[AD_SOURCE_RESPONSES] != 450 {
+		t.Errorf("metrics = %+v", m)
+	}
+	if m.DateTime.Format("2006-01-02") != "2018-10-01" || models[2].DateTime.Format("2006-01-02") != "2018-10-02" {
+		t.Errorf("dates = %v, %v", m.DateTime, models[2].DateTime)
+	}
+
+	query := server.LastQuery()
+	if got := query["breakdowns"][0]; got != strings.Join([]string{DATE, APP, AD_UNITS, COUNTRY, AD_SOURCE}, ",") {
+		t.Errorf("breakdowns = %v", got)
+	}
+	if got := query["appKey"][0]; got != "app-1,app-2" {
+		t.Errorf("appKey = %v", got)
+	}
+	if query["startDate"][0] != "2018-10-01" || query["endDate"][0] != "2018-10-02" {
+		t.Errorf("dates = %v to %v", query["startDate"], query["endDate"])
+	}
+}
+
+func TestFetchCachesBearerToken(t *testing.T) {
+	server := ironsourcetest.NewServer(testStats)
+	defer server.Close()
+
+	rr := newRequester(t, server)
+	for i := 0; i < 2; i++ {
+		if _, err := rr.Fetch(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if server.AuthCalls() != 1 || server.StatsCalls() != 2 {
+		t.Errorf("auth calls, stats calls = %v, %v, want 1, 2", server.AuthCalls(), server.StatsCalls())
+	}
+}
+
+func TestFetchInvalidatesRejectedToken(t *testing.T) {
+	server := ironsourcetest.NewServer(testStats)
+	defer server.Close()
+
+	rr := newRequester(t, server)
+	if _, err := rr.Fetch(); err != nil {
+		t.Fatal(err)
+	}
+
+	server.ExpireToken()
+	if _, err := rr.Fetch(); err == nil || !strings.Contains(err.Error(), "invalid token (401)") {
+		t.Fatalf("Fetch() with an expired token error = %v", err)
+	}
+
+	if _, err := rr.Fetch(); err != nil {
+		t.Fatalf("Fetch() after the token was invalidated: %v", err)
+	}
+
+	if server.AuthCalls() != 2 {
+		t.Errorf("auth calls = %v, want a new token after the 401", server.AuthCalls())
+	}
+}
+
+func TestFetchBadCredentials(t *testing.T) {
+	server := ironsourcetest.NewServer(testStats)
+	defer server.Close()
+
+	rr := newRequester(t, server)
+	rr.tokens.Refresh = ReportRequester{SecretKey: "wrong", BaseURL: server.URL}.fetchBearerToken
+
+	if _, err := rr.Fetch(); err == nil || !strings.Contains(err.Error(), "invalid credentials (401)") {
+		t.Errorf("Fetch() error = %v, want the auth error", err)
+	}
+
+	if server.StatsCalls() != 0 {
+		t.Error("stats shouldn't be requested without a token")
+	}
+}
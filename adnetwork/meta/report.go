@@ -0,0 +1,357 @@
+package meta
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/econnelly/myrevenue"
+	"github.com/econnelly/myrevenue/adnetwork"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DEFAULT_BASE_URL      = "https://graph.facebook.com"
+	DEFAULT_API_VERSION   = "v17.0"
+	DEFAULT_POLL_INTERVAL = 5 * time.Second
+	DEFAULT_MAX_POLLS     = 60
+)
+
+// ReportRequester submits an asynchronous Audience Network analytics query,
+// polls until it completes, then pages through the results
+type ReportRequester struct {
+	PropertyID   string        `json:"property_id"`
+	AccessToken  string        `json:"access_token"`
+	Breakdowns   []string      `json:"breakdowns"`    // Defaults to COUNTRY and PLACEMENT
+	APIVersion   string        `json:"api_version"`   // Defaults to DEFAULT_API_VERSION
+	BaseURL      string        `json:"base_url"`      // Defaults to DEFAULT_BASE_URL
+	PollInterval time.Duration `json:"poll_interval"` // Defaults to DEFAULT_POLL_INTERVAL
+	MaxPolls     int           `json:"max_polls"`     // Defaults to DEFAULT_MAX_POLLS
+	StartDate    time.Time
+	EndDate      time.Time
+	adnetwork.Request
+
+	queryURL string
+	rawData  []Result
+}
+
+type QueryResponse struct {
+	QueryID         string `json:"query_id"`
+	AsyncResultLink string `json:"async_result_link"`
+}
+
+type ResultsResponse struct {
+	Data []struct {
+		QueryID string   `json:"query_id"`
+		Status  string   `json:"status"`
+		Results []Result `json:"results"`
+	} `json:"data"`
+	Paging struct {
+		Next string `json:"next"`
+	} `json:"paging"`
+}
+
+// Result is a single metric value for one time period and breakdown
+type Result struct {
+	Time       string `json:"time"`
+	Metric     string `json:"metric"`
+	Breakdowns []struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	} `json:"breakdowns"`
+	Value string `json:"value"`
+}
+
+type ErrorResponse struct {
+	Error struct {
+		Message   string `json:"message"`
+		Type      string `json:"type"`
+		Code      int    `json:"code"`
+		FBTraceID string `json:"fbtrace_id"`
+	} `json:"error"`
+}
+
+// Query states
+const (
+	COMPLETE = "complete"
+	FAILED   = "failed"
+	INVALID  = "invalid"
+)
+
+// Breakdowns
+const (
+	COUNTRY   = "country"
+	PLACEMENT = "placement"
+	PLATFORM  = "platform"
+	APP       = "app"
+)
+
+// Metrics
+const (
+	REVENUE     = "fb_ad_network_revenue"
+	IMPRESSIONS = "fb_ad_network_imp"
+	REQUESTS    = "fb_ad_network_request"
+	CLICKS      = "fb_ad_network_click"
+)
+
+func (rr *ReportRequester) Initialize() error {
+	if rr.PropertyID == "" || rr.AccessToken == "" {
+		return errors.New("Meta: property ID and access token are required")
+	}
+
+	if rr.BaseURL == "" {
+		rr.BaseURL = DEFAULT_BASE_URL
+	}
+
+	if rr.APIVersion == "" {
+		rr.APIVersion = DEFAULT_API_VERSION
+	}
+
+	if rr.PollInterval == 0 {
+		rr.PollInterval = DEFAULT_POLL_INTERVAL
+	}
+
+	if rr.MaxPolls == 0 {
+		rr.MaxPolls = DEFAULT_MAX_POLLS
+	}
+
+	breakdowns := rr.Breakdowns
+	if len(breakdowns) == 0 {
+		breakdowns = []string{COUNTRY, PLACEMENT}
+	}
+
+	metrics, err := json.Marshal([]string{REVENUE, IMPRESSIONS, REQUESTS, CLICKS})
+	if err != nil {
+		return err
+	}
+
+	breakdownList, err := json.Marshal(breakdowns)
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{}
+	query.Set("metrics", string(metrics))
+	query.Add("breakdowns", string(breakdownList))
+	query.Add("aggregation_period", "day")
+	query.Add("since", rr.StartDate.Format("2006-01-02"))
+	// until is exclusive
+	query.Add("until", rr.EndDate.AddDate(0, 0, 1).Format("2006-01-02"))
+	query.Add("access_token", rr.AccessToken)
+
+	rr.queryURL = fmt.Sprintf("%v/%v/%v/adnw_analytics?%v", rr.BaseURL, rr.APIVersion, url.PathEscape(rr.PropertyID), query.Encode())
+
+	return nil
+}
+
+func (rr *ReportRequester) Fetch() ([]myrevenue.Model, error) {
+	queryID, err := rr.submitQuery()
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := rr.pollResults(queryID)
+	if err != nil {
+		return nil, err
+	}
+
+	rr.rawData = results
+	return rr.convertToReportModel(results)
+}
+
+func (rr ReportRequester) submitQuery() (string, error) {
+	resp, err := myrevenue.PostRequest(rr.queryURL, nil, "", false)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := rr.readBody(resp)
+	if err != nil {
+		return "", err
+	}
+
+	result := QueryResponse{}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", err
+	}
+
+	if result.QueryID == "" {
+		return "", errors.Errorf("%v: no query_id in response", rr.GetName())
+	}
+
+	return result.QueryID, nil
+}
+
+// pollResults waits for the query to complete, then follows paging.next
+// until every page has been read
+func (rr ReportRequester) pollResults(queryID string) ([]Result, error) {
+	ids, err := json.Marshal([]string{queryID})
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{}
+	query.Set("query_ids", string(ids))
+	query.Add("access_token", rr.AccessToken)
+	next := fmt.Sprintf("%v/%v/%v/adnw_analytics_results?%v", rr.BaseURL, rr.APIVersion, url.PathEscape(rr.PropertyID), query.Encode())
+
+	results := make([]Result, 0)
+	for polls := 0; next != ""; {
+		page, err := rr.resultsPage(next)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(page.Data) == 0 {
+			return nil, errors.Errorf("%v: query %v not found", rr.GetName(), queryID)
+		}
+
+		status := strings.ToLower(page.Data[0].Status)
+		if status == FAILED || status == INVALID {
+			return nil, errors.Errorf("%v: query %v %v", rr.GetName(), queryID, status)
+		}
+
+		if status != COMPLETE {
+			polls++
+			if polls >= rr.MaxPolls {
+				return nil, errors.Errorf("%v: query %v not complete after %v polls", rr.GetName(), queryID, polls)
+			}
+			time.Sleep(rr.PollInterval)
+			continue
+		}
+
+		results = append(results, page.Data[0].Results...)
+		next = page.Paging.Next
+	}
+
+	return results, nil
+}
+
+func (rr ReportRequester) resultsPage(pageURL string) (ResultsResponse, error) {
+	resp, err := myrevenue.GetRequest(pageURL, nil, false)
+	if err != nil {
+		return ResultsResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	body, err := rr.readBody(resp)
+	if err != nil {
+		return ResultsResponse{}, err
+	}
+
+	page := ResultsResponse{}
+	if err := json.Unmarshal(body, &page); err != nil {
+		return ResultsResponse{}, err
+	}
+
+	return page, nil
+}
+
+func (rr ReportRequester) readBody(resp *http.Response) ([]byte, error) {
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		result := ErrorResponse{}
+		if json.Unmarshal(body, &result) != nil || result.Error.Message == "" {
+			return nil, errors.Errorf("%v: request failed (%v): %v", rr.GetName(), resp.StatusCode, strings.TrimSpace(string(body)))
+		}
+		return nil, errors.Errorf("%v: %v (%v)", rr.GetName(), result.Error.Message, result.Error.Code)
+	}
+
+	return body, nil
+}
+
+// convertToReportModel merges the one-metric-per-row results into a model per
+// day and breakdown combination
+func (rr ReportRequester) convertToReportModel(results []Result) ([]myrevenue.Model, error) {
+	index := make(map[string]int)
+	reportModels := make([]myrevenue.Model, 0)
+
+	for i, r := range results {
+		parseError := func(column string, err error) error {
+			return &myrevenue.ParseError{Network: rr.GetName(), Row: i + 1, Column: column, Err: err}
+		}
+
+		day, err := time.Parse("2006-01-02T15:04:05-0700", r.Time)
+		if err != nil {
+			return nil, parseError("time", err)
+		}
+
+		breakdowns := make(map[string]string, len(r.Breakdowns))
+		keys := make([]string, 0, len(r.Breakdowns))
+		for _, b := range r.Breakdowns {
+			breakdowns[b.Key] = b.Value
+			keys = append(keys, b.Key+"="+b.Value)
+		}
+		sort.Strings(keys)
+		key := r.Time + "|" + strings.Join(keys, "|")
+
+		position, found := index[key]
+		if !found {
+			model := myrevenue.Model{
+				NetworkName: rr.GetName(),
+				DateTime:    day,
+				Country:     breakdowns[COUNTRY],
+				AdUnit:      breakdowns[PLACEMENT],
+				Platform:    breakdowns[PLATFORM],
+				App:         breakdowns[APP],
+			}
+			reportModels = append(reportModels, model)
+			position = len(reportModels) - 1
+			index[key] = position
+		}
+
+		value, err := strconv.ParseFloat(r.Value, 64)
+		if err != nil {
+			return nil, parseError(r.Metric, err)
+		}
+
+		model := &reportModels[position]
+		switch r.Metric {
+		case REVENUE:
+			model.Revenue = value
+		case IMPRESSIONS:
+			model.Impressions = uint64(value)
+		case REQUESTS:
+			model.Requests = uint64(value)
+		case CLICKS:
+			model.Clicks = uint64(value)
+		default:
+			model.SetExtendedMetric(r.Metric, value)
+		}
+	}
+
+	for i := range reportModels {
+		if reportModels[i].Impressions > 0 {
+			reportModels[i].CTR = float64(reportModels[i].Clicks) / float64(reportModels[i].Impressions)
+			reportModels[i].ECPM = reportModels[i].Revenue / float64(reportModels[i].Impressions) * 1000
+		}
+	}
+
+	return reportModels, nil
+}
+
+func (ReportRequester) GetName() string {
+	return "Meta Audience Network"
+}
+
+func (rr ReportRequester) GetReport() interface{} {
+	return rr.rawData
+}
+
+func (rr ReportRequester) GetStartDate() time.Time {
+	return rr.StartDate
+}
+
+func (rr ReportRequester) GetEndDate() time.Time {
+	return rr.EndDate
+}
@@ -0,0 +1,193 @@
+package meta
+
+import (
+	"errors"
+	"fmt"
+	"github.com/econnelly/myrevenue"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServer accepts one query, reports it running for the given number of
+// polls, then serves the results in two pages
+type fakeServer struct {
+	*httptest.Server
+
+	running   int
+	status    string
+	submitErr string
+
+	mu    sync.Mutex
+	polls int
+	pages []string
+}
+
+func newFakeServer(t *testing.T, running int) *fakeServer {
+	s := &fakeServer{running: running, status: COMPLETE}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v17.0/prop-1/adnw_analytics", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Query().Get("access_token") != "token" {
+			t.Errorf("unexpected submit %v %v", r.Method, r.URL)
+		}
+		if query := r.URL.Query(); query.Get("since") != "2018-10-01" || query.Get("until") != "2018-10-03" {
+			t.Errorf("unexpected range %v", query)
+		}
+
+		if s.submitErr != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, s.submitErr)
+			return
+		}
+		fmt.Fprint(w, `{"query_id": "q-1", "async_result_link": "ignored"}`)
+	})
+	mux.HandleFunc("/v17.0/prop-1/adnw_analytics_results", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if r.URL.Query().Get("page") == "2" {
+			s.pages = append(s.pages, "2")
+			s.serve(t, w, "testdata/results_page2.json")
+			return
+		}
+
+		if r.URL.Query().Get("query_ids") != `["q-1"]` {
+			t.Errorf("unexpected poll %v", r.URL)
+		}
+
+		s.polls++
+		if s.polls <= s.running {
+			fmt.Fprint(w, `{"data": [{"query_id": "q-1", "status": "running"}]}`)
+			return
+		}
+		if s.status != COMPLETE {
+			fmt.Fprintf(w, `{"data": [{"query_id": "q-1", "status": %q}]}`, s.status)
+			return
+		}
+
+		s.pages = append(s.pages, "1")
+		s.serve(t, w, "testdata/results_page1.json")
+	})
+
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+func (s *fakeServer) serve(t *testing.T, w http.ResponseWriter, fixture string) {
+	content, err := os.ReadFile(fixture)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	fmt.Fprint(w, strings.Replace(string(content), "{{server}}", s.URL, -1))
+}
+
+func (s *fakeServer) requester(t *testing.T) *ReportRequester {
+	rr := &ReportRequester{
+		PropertyID:   "prop-1",
+		AccessToken:  "token",
+		BaseURL:      s.URL,
+		PollInterval: time.Millisecond,
+		MaxPolls:     5,
+		StartDate:    time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:      time.Date(2018, time.October, 2, 0, 0, 0, 0, time.UTC),
+	}
+	if err := rr.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	return rr
+}
+
+func TestFetchPollsAndPages(t *testing.T) {
+	server := newFakeServer(t, 2)
+	defer server.Close()
+
+	rr := server.requester(t)
+	models, err := rr.Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if server.polls != 3 || strings.Join(server.pages, ",") != "1,2" {
+		t.Errorf("polls, pages = %v, %v", server.polls, server.pages)
+	}
+	if len(rr.GetReport().([]Result)) != 7 {
+		t.Errorf("raw report has %v results, want every page's", len(rr.GetReport().([]Result)))
+	}
+
+	// One model per day and breakdown, whatever order the breakdowns came in
+	if len(models) != 3 {
+		t.Fatalf("got %v models, want 3", len(models))
+	}
+
+	m := models[0]
+	if m.Country != "US" || m.AdUnit != "123_456" || m.Revenue != 12.5 || m.Impressions != 5000 || m.Clicks != 50 || m.Requests != 6000 {
+		t.Errorf("merged model = %+v", m)
+	}
+	if m.CTR != 0.01 || m.ECPM != 2.5 || m.ExtendedMetrics["fb_ad_network_fill_rate"] != 0.83 {
+		t.Errorf("CTR, ECPM, fill rate = %v, %v, %v", m.CTR, m.ECPM, m.ExtendedMetrics)
+	}
+	if _, offset := m.DateTime.Zone(); offset != -7*60*60 || m.DateTime.Format("2006-01-02") != "2018-10-01" {
+		t.Errorf("DateTime = %v", m.DateTime)
+	}
+
+	if models[1].Country != "GB" || models[1].Impressions != 1000 || models[1].Revenue != 0 {
+		t.Errorf("second model = %+v", models[1])
+	}
+	if models[2].DateTime.Format("2006-01-02") != "2018-10-02" || models[2].Revenue != 3 || models[2].ECPM != 0 {
+		t.Errorf("third model = %+v", models[2])
+	}
+}
+
+func TestFetchErrorResponse(t *testing.T) {
+	server := newFakeServer(t, 0)
+	defer server.Close()
+
+	server.submitErr = `{"error": {"message": "Invalid OAuth access token.", "type": "OAuthException", "code": 190, "fbtrace_id": "abc"}}`
+	if _, err := server.requester(t).Fetch(); err == nil || err.Error() != "Meta Audience Network: Invalid OAuth access token. (190)" {
+		t.Errorf("Fetch() error = %v", err)
+	}
+
+	server.submitErr = "Bad Gateway"
+	if _, err := server.requester(t).Fetch(); err == nil || err.Error() != "Meta Audience Network: request failed (400): Bad Gateway" {
+		t.Errorf("Fetch() error = %v", err)
+	}
+}
+
+func TestFetchFailedQuery(t *testing.T) {
+	server := newFakeServer(t, 1)
+	defer server.Close()
+
+	server.status = FAILED
+	if _, err := server.requester(t).Fetch(); err == nil || !strings.Contains(err.Error(), "query q-1 failed") {
+		t.Errorf("Fetch() error = %v", err)
+	}
+}
+
+func TestFetchGivesUpAfterMaxPolls(t *testing.T) {
+	server := newFakeServer(t, 100)
+	defer server.Close()
+
+	if _, err := server.requester(t).Fetch(); err == nil || !strings.Contains(err.Error(), "not complete after 5 polls") {
+		t.Errorf("Fetch() error = %v", err)
+	}
+}
+
+func TestConvertBadValue(t *testing.T) {
+	results := []Result{
+		{Time: "2018-10-01T00:00:00-0700", Metric: REVENUE, Value: "1"},
+		{Time: "2018-10-01T00:00:00-0700", Metric: IMPRESSIONS, Value: "n/a"},
+	}
+
+	_, err := ReportRequester{}.convertToReportModel(results)
+
+	var parseErr *myrevenue.ParseError
+	if !errors.As(err, &parseErr) || parseErr.Row != 2 || parseErr.Column != IMPRESSIONS {
+		t.Errorf("convertToReportModel() error = %v, want row 2 column %v", err, IMPRESSIONS)
+	}
+}
@@ -0,0 +1,40 @@
+package mobfox
+
+import (
+	"encoding/json"
+	"github.com/econnelly/myrevenue"
+	"github.com/econnelly/myrevenue/adnetwork"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+)
+
+// ReportParser reads dashboard reports downloaded as JSON, which share the
+// API's columns/results format
+type ReportParser struct {
+	TimeZone string `json:"time_zone"` // Defaults to Etc/UTC
+	adnetwork.DirectlyParsable
+}
+
+func (r ReportParser) ParseRevenue(reader io.Reader) ([]myrevenue.Model, error) {
+	if reader == nil {
+		return nil, errors.New("reader is nil")
+	}
+
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	result := ReportResponse{}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+
+	rr := ReportRequester{TimeZone: r.TimeZone}
+	if rr.TimeZone == "" {
+		rr.TimeZone = "Etc/UTC"
+	}
+
+	return rr.convertModel(result)
+}
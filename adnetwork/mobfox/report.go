@@ -9,12 +9,16 @@ import (
 	"io"
 	"io/ioutil"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 )
 
 type ReportRequester struct {
-	APIKey    string `json:"api_key"`
-	TimeZone  string `json:"time_zone"`
+	APIKey    string   `json:"api_key"`
+	TimeZone  string   `json:"time_zone"`
+	AdSources []string `json:"ad_sources"` // Defaults to STACK and EXCHANGE
+	Group     []string `json:"group"`      // Defaults to AD_SOURCE, INVENTORY_ID and COUNTRY_CODE
 	StartDate time.Time
 	EndDate   time.Time
 	adnetwork.Request
@@ -30,11 +34,38 @@ type ReportResponse struct {
 	Currentness []string        `json:"currentness"`
 }
 
+// Ad sources
+const (
+	STACK    = "stack"
+	EXCHANGE = "exchange"
+)
+
+// Groups
+const (
+	AD_SOURCE    = "ad_source"
+	INVENTORY_ID = "inventory_id"
+	COUNTRY_CODE = "country_code"
+)
+
+// Extended metrics
+const (
+	SERVED    = "served"
+	FILL_RATE = "fill_rate"
+)
+
 func (rr *ReportRequester) Initialize() error {
 	if rr.TimeZone == "" {
 		rr.TimeZone = "Etc/UTC"
 	}
 
+	if len(rr.AdSources) == 0 {
+		rr.AdSources = []string{STACK, EXCHANGE}
+	}
+
+	if len(rr.Group) == 0 {
+		rr.Group = []string{AD_SOURCE, INVENTORY_ID, COUNTRY_CODE}
+	}
+
 	requestUrl := url.URL{
 		Scheme: "https",
 		Host:   "api-v3.mobfox.com",
@@ -51,10 +82,10 @@ func (rr *ReportRequester) Initialize() error {
 	values.Set("to", endDate)
 	//values.Add("period", "yesterday")
 	values.Add("tz", rr.TimeZone)
-	values.Add("group", "ad_source,inventory_id,country_code")
+	values.Add("group", strings.Join(rr.Group, ","))
 	values.Add("timegroup", "day")
 	values.Add("totals", "total_impressions,total_served,total_requests,total_clicks,total_earnings,ecpm")
-	values.Add("ad_source", "stack,exchange")
+	values.Add("ad_source", strings.Join(rr.AdSources, ","))
 
 	rr.reportURL = fmt.Sprintf("%v?%v", requestUrl.String(), values.Encode())
 
@@ -90,43 +121,150 @@ func (rr *ReportRequester) parse(r io.ReadCloser) ([]myrevenue.Model, error) {
 }
 
 func (rr ReportRequester) convertModel(m ReportResponse) ([]myrevenue.Model, error) {
-	headerMap := make(map[string]int, m.Rowcount)
+	headerMap := make(map[string]int, len(m.Columns))
 	for i, v := range m.Columns {
 		headerMap[v] = i
 	}
 
-	var totalRevenue float64
-	reportModels := make([]myrevenue.Model, m.Rowcount)
+	reportModels := make([]myrevenue.Model, len(m.Results))
 	loc, e := time.LoadLocation(rr.TimeZone)
 	if e != nil {
 		return nil, errors.Errorf("Could not load timezone (%s)", rr.TimeZone)
 	}
 	for j, r := range m.Results {
+		row := resultRow{network: rr.GetName(), index: j + 1, headers: headerMap, values: r}
 		reportModels[j].NetworkName = rr.GetName()
-		day, err := time.ParseInLocation("2006-01-02", r[headerMap["day"]].(string), loc)
+
+		dayStr, err := row.string("day")
 		if err != nil {
-			return nil, errors.Errorf("%v: %v", rr.GetName(), err)
+			return nil, err
 		}
 
+		day, err := time.ParseInLocation("2006-01-02", dayStr, loc)
+		if err != nil {
+			return nil, row.error("day", err)
+		}
 		reportModels[j].DateTime = day
-		reportModels[j].Impressions = uint64(r[headerMap["total_impressions"]].(float64))
-		reportModels[j].Revenue = r[headerMap["total_earnings"]].(float64)
-		reportModels[j].Requests = uint64(r[headerMap["total_requests"]].(float64))
-		clicks := r[headerMap["total_clicks"]].(float64)
-		imp := r[headerMap["total_impressions"]].(float64)
-		reportModels[j].CTR = clicks / imp
-		reportModels[j].ECPM = r[headerMap["ecpm"]].(float64)
-		if r[headerMap["country_code"]] != nil {
-			reportModels[j].Country = r[headerMap["country_code"]].(string)
+
+		impressions, err := row.number("total_impressions")
+		if err != nil {
+			return nil, err
+		}
+
+		revenue, err := row.number("total_earnings")
+		if err != nil {
+			return nil, err
+		}
+
+		requests, err := row.number("total_requests")
+		if err != nil {
+			return nil, err
+		}
+
+		clicks, err := row.number("total_clicks")
+		if err != nil {
+			return nil, err
+		}
+
+		served, err := row.number("total_served")
+		if err != nil {
+			return nil, err
+		}
+
+		ecpm, err := row.number("ecpm")
+		if err != nil {
+			return nil, err
+		}
+
+		reportModels[j].Impressions = uint64(impressions)
+		reportModels[j].Revenue = revenue
+		reportModels[j].Requests = uint64(requests)
+		reportModels[j].Clicks = uint64(clicks)
+		reportModels[j].ECPM = ecpm
+		if impressions > 0 {
+			reportModels[j].CTR = clicks / impressions
+		}
+
+		reportModels[j].SetExtendedMetric(SERVED, served)
+		if requests > 0 {
+			reportModels[j].SetExtendedMetric(FILL_RATE, served/requests)
+		}
+
+		if reportModels[j].Country, err = row.string(COUNTRY_CODE); err != nil {
+			return nil, err
+		}
+
+		if reportModels[j].AdSource, err = row.string(AD_SOURCE); err != nil {
+			return nil, err
 		}
 
-		totalRevenue += reportModels[j].Revenue
+		// MobFox inventories are the apps and sites ads are served into
+		inventory, err := row.string(INVENTORY_ID)
+		if err != nil {
+			return nil, err
+		}
+		reportModels[j].App = inventory
+		reportModels[j].AdUnit = inventory
 	}
 
 	return reportModels, nil
 
 }
 
+// resultRow reads loosely typed JSON values by column name. Missing columns and
+// nulls read as zero values.
+type resultRow struct {
+	network string
+	index   int
+	headers map[string]int
+	values  []interface{}
+}
+
+func (r resultRow) value(column string) interface{} {
+	i, found := r.headers[column]
+	if !found || i >= len(r.values) {
+		return nil
+	}
+	return r.values[i]
+}
+
+func (r resultRow) number(column string) (float64, error) {
+	switch v := r.value(column).(type) {
+	case nil:
+		return 0, nil
+	case float64:
+		return v, nil
+	case string:
+		if v == "" {
+			return 0, nil
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return 0, r.error(column, err)
+		}
+		return f, nil
+	default:
+		return 0, r.error(column, errors.Errorf("unexpected %T value %v", v, v))
+	}
+}
+
+func (r resultRow) string(column string) (string, error) {
+	switch v := r.value(column).(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	default:
+		return "", r.error(column, errors.Errorf("unexpected %T value %v", v, v))
+	}
+}
+
+func (r resultRow) error(column string, err error) error {
+	return &myrevenue.ParseError{Network: r.network, Row: r.index, Column: column, Err: err}
+}
+
 func (ReportRequester) GetName() string {
 	return "MobFox"
 }
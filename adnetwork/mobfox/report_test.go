@@ -0,0 +1,91 @@
+package mobfox
+
+import (
+	"errors"
+	"github.com/econnelly/myrevenue"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseReport(t *testing.T) {
+	f, err := os.Open("testdata/report.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	models, err := ReportParser{TimeZone: "America/Los_Angeles"}.ParseRevenue(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(models) != 4 {
+		t.Fatalf("got %v models, want 4", len(models))
+	}
+
+	m := models[0]
+	if m.Impressions != 1000 || m.Requests != 1500 || m.Clicks != 10 || m.Revenue != 2.5 || m.ECPM != 2.5 {
+		t.Errorf("first row = %+v", m)
+	}
+	if m.CTR != 0.01 || m.ExtendedMetrics[SERVED] != 1200 || m.ExtendedMetrics[FILL_RATE] != 0.8 {
+		t.Errorf("CTR, served, fill rate = %v, %v, %v", m.CTR, m.ExtendedMetrics[SERVED], m.ExtendedMetrics[FILL_RATE])
+	}
+	if m.AdSource != STACK || m.App != "inv-1" || m.AdUnit != "inv-1" || m.Country != "US" {
+		t.Errorf("dimensions = %v, %v, %v", m.AdSource, m.App, m.Country)
+	}
+	if got := m.DateTime.Format("2006-01-02 MST"); got != "2018-09-30 PDT" {
+		t.Errorf("DateTime = %v", got)
+	}
+
+	// Numbers sent as strings, and IDs sent as numbers
+	m = models[1]
+	if m.Impressions != 400 || m.Revenue != 0.8 || m.ECPM != 2 || m.App != "12345" {
+		t.Errorf("second row = %+v", m)
+	}
+
+	// Nulls and short rows read as zero values
+	for _, m := range models[2:] {
+		if m.Impressions != 0 || m.Revenue != 0 || m.CTR != 0 {
+			t.Errorf("empty row = %+v", m)
+		}
+		if _, found := m.ExtendedMetrics[FILL_RATE]; found {
+			t.Error("fill rate without requests")
+		}
+	}
+	if models[2].Country != "" || models[2].AdSource != "" {
+		t.Errorf("null dimensions = %q, %q", models[2].Country, models[2].AdSource)
+	}
+}
+
+func TestParseBadValues(t *testing.T) {
+	tests := []struct {
+		name   string
+		row    string
+		column string
+	}{
+		{"non-numeric string", `["2018-09-30", "stack", "inv-1", "US", "lots", 0, 0, 0, 0, 0]`, "total_impressions"},
+		{"boolean number", `["2018-09-30", "stack", "inv-1", "US", 0, 0, 0, 0, true, 0]`, "total_earnings"},
+		{"object number", `["2018-09-30", "stack", "inv-1", "US", 0, 0, 0, 0, 0, {"value": 1}]`, "ecpm"},
+		{"array dimension", `["2018-09-30", "stack", ["inv-1"], "US", 0, 0, 0, 0, 0, 0]`, INVENTORY_ID},
+		{"boolean dimension", `["2018-09-30", "stack", "inv-1", false, 0, 0, 0, 0, 0, 0]`, COUNTRY_CODE},
+		{"bad day", `["30/09/2018", "stack", "inv-1", "US", 0, 0, 0, 0, 0, 0]`, "day"},
+		{"numeric day", `[20180930, "stack", "inv-1", "US", 0, 0, 0, 0, 0, 0]`, "day"},
+	}
+
+	for _, test := range tests {
+		report := `{"columns": ["day", "ad_source", "inventory_id", "country_code", "total_impressions", "total_served", "total_requests", "total_clicks", "total_earnings", "ecpm"],
+			"results": [["2018-09-30", "stack", "inv-1", "US", 0, 0, 0, 0, 0, 0], ` + test.row + `]}`
+
+		_, err := ReportParser{}.ParseRevenue(strings.NewReader(report))
+
+		var parseErr *myrevenue.ParseError
+		if !errors.As(err, &parseErr) {
+			t.Errorf("%v: error = %v, want a *ParseError", test.name, err)
+			continue
+		}
+		if parseErr.Network != "MobFox" || parseErr.Row != 2 || parseErr.Column != test.column {
+			t.Errorf("%v: error at %v row %v column %q, want row 2 column %q", test.name, parseErr.Network, parseErr.Row, parseErr.Column, test.column)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package mopub
+
+import (
+	"encoding/csv"
+	"errors"
+	"github.com/econnelly/myrevenue"
+	"github.com/econnelly/myrevenue/adnetwork"
+	"io"
+)
+
+// ReportParser reads custom reports exported from the MoPub dashboard, which
+// share the API's CSV format
+type ReportParser struct {
+	adnetwork.DirectlyParsable
+}
+
+func (r ReportParser) ParseRevenue(reader io.Reader) ([]myrevenue.Model, error) {
+	if reader == nil {
+		return nil, errors.New("reader is nil")
+	}
+
+	records, err := csv.NewReader(reader).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	return ReportRequester{}.convertCSVToModel(records)
+}
@@ -0,0 +1,37 @@
+package mopub
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseRevenue(t *testing.T) {
+	export := "Day,Country,Attempts,Impressions,Clicks,CTR,Revenue\n" +
+		"2018-10-01,US,1000,800,8,0.01,1.50\n" +
+		"2018-10-01,GB,500,400,,,0.75\n"
+
+	models, err := ReportParser{}.ParseRevenue(strings.NewReader(export))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// One model per data row, with no empty model for the header
+	if len(models) != 2 {
+		t.Fatalf("got %v models, want 2", len(models))
+	}
+
+	for _, m := range models {
+		if m.NetworkName != "MoPub" || m.DateTime.IsZero() {
+			t.Errorf("incomplete model %+v", m)
+		}
+	}
+
+	if m := models[0]; m.Country != "US" || m.Requests != 1000 || m.Impressions != 800 || m.Clicks != 8 {
+		t.Errorf("first model = %+v", m)
+	}
+
+	// An empty Clicks cell leaves Clicks at zero without touching Requests
+	if m := models[1]; m.Clicks != 0 || m.Requests != 500 || m.CTR != 0 {
+		t.Errorf("second model = %+v", m)
+	}
+}
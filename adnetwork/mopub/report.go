@@ -81,7 +81,7 @@ func (rr ReportRequester) convertCSVToModel(csv [][]string) ([]myrevenue.Model,
 	} else if csvLength == 0 {
 		return nil, errors.New("0-length csv")
 	}
-	reportModels := make([]myrevenue.Model, csvLength)
+	reportModels := make([]myrevenue.Model, csvLength-1)
 
 	loc, e := time.LoadLocation("Etc/UTC")
 	if e != nil {
@@ -159,7 +159,7 @@ func (rr ReportRequester) convertCSVToModel(csv [][]string) ([]myrevenue.Model,
 				}
 				model.Clicks = clicks
 			} else {
-				model.Requests = 0
+				model.Clicks = 0
 			}
 
 			reportModels[i-1] = model
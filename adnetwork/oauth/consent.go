@@ -0,0 +1,229 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/econnelly/myrevenue"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// InstalledAppFlow obtains a refresh token through the OAuth installed
+// application flow: the user grants access in a browser, which redirects back
+// to a short-lived loopback server with the authorization code. PKCE protects
+// the code in transit.
+type InstalledAppFlow struct {
+	ClientID     string
+	ClientSecret string
+	AuthURL      string
+	TokenURL     string
+	Scopes       []string
+
+	// ListenAddr is the loopback address for the redirect, defaults to any
+	// free port on 127.0.0.1
+	ListenAddr string
+
+	// OpenURL presents the consent page to the user, e.g. by printing it or
+	// launching a browser. It is called once the redirect server is listening.
+	OpenURL func(authURL string) error
+
+	Clock myrevenue.Clock
+}
+
+// REDIRECT_PATH is where the loopback server expects the authorization
+// response, every other path is ignored
+const REDIRECT_PATH = "/oauth2callback"
+
+type callbackResult struct {
+	code string
+	err  error
+}
+
+// Run walks the user through consent and returns the exchanged token
+func (f InstalledAppFlow) Run(ctx context.Context) (Token, error) {
+	if f.OpenURL == nil {
+		return Token{}, errors.New("OpenURL is required")
+	}
+
+	verifier, err := randomString(32)
+	if err != nil {
+		return Token{}, err
+	}
+
+	state, err := randomString(16)
+	if err != nil {
+		return Token{}, err
+	}
+
+	addr := f.ListenAddr
+	if addr == "" {
+		addr = "127.0.0.1:0"
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return Token{}, err
+	}
+
+	redirectURI := fmt.Sprintf("http://%v%v", listener.Addr().String(), REDIRECT_PATH)
+	results := make(chan callbackResult, 1)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(REDIRECT_PATH, func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		// Browsers and port scanners can reach the listener before the
+		// redirect does, only an authorization response may end the flow
+		if query.Get("code") == "" && query.Get("error") == "" {
+			http.Error(w, "waiting for the authorization response", http.StatusBadRequest)
+			return
+		}
+
+		var result callbackResult
+		if query.Get("state") != state {
+			result.err = errors.New("state mismatch in authorization response")
+		} else if e := query.Get("error"); e != "" {
+			result.err = fmt.Errorf("authorization denied: %v", e)
+		} else {
+			result.code = query.Get("code")
+		}
+
+		if result.err != nil {
+			http.Error(w, result.err.Error(), http.StatusBadRequest)
+		} else {
+			fmt.Fprintln(w, "Authorization complete, you may close this window.")
+		}
+
+		select {
+		case results <- result:
+		default:
+		}
+	})
+
+	server := &http.Server{Handler: mux}
+
+	go server.Serve(listener)
+	defer server.Close()
+
+	if err := f.OpenURL(f.authCodeURL(redirectURI, state, challenge(verifier))); err != nil {
+		return Token{}, err
+	}
+
+	var result callbackResult
+	select {
+	case result = <-results:
+	case <-ctx.Done():
+		return Token{}, ctx.Err()
+	}
+
+	if result.err != nil {
+		return Token{}, result.err
+	}
+
+	return f.exchange(ctx, result.code, verifier, redirectURI)
+}
+
+func (f InstalledAppFlow) authCodeURL(redirectURI string, state string, codeChallenge string) string {
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Add("client_id", f.ClientID)
+	query.Add("redirect_uri", redirectURI)
+	query.Add("scope", strings.Join(f.Scopes, " "))
+	query.Add("state", state)
+	query.Add("code_challenge", codeChallenge)
+	query.Add("code_challenge_method", "S256")
+	// Without these Google only issues a refresh token on first consent
+	query.Add("access_type", "offline")
+	query.Add("prompt", "consent")
+
+	separator := "?"
+	if strings.Contains(f.AuthURL, "?") {
+		separator = "&"
+	}
+
+	return f.AuthURL + separator + query.Encode()
+}
+
+func (f InstalledAppFlow) exchange(ctx context.Context, code string, verifier string, redirectURI string) (Token, error) {
+	body := url.Values{}
+	body.Set("grant_type", "authorization_code")
+	body.Add("code", code)
+	body.Add("code_verifier", verifier)
+	body.Add("redirect_uri", redirectURI)
+	body.Add("client_id", f.ClientID)
+	body.Add("client_secret", f.ClientSecret)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.TokenURL, strings.NewReader(body.Encode()))
+	if err != nil {
+		return Token{}, err
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return Token{}, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return Token{}, err
+	}
+
+	result := struct {
+		AccessToken      string `json:"access_token"`
+		RefreshToken     string `json:"refresh_token"`
+		ExpiresIn        int    `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}{}
+
+	if err := json.Unmarshal(data, &result); err != nil {
+		return Token{}, fmt.Errorf("token exchange failed (%v): %v", resp.StatusCode, string(data))
+	}
+
+	if result.Error != "" {
+		return Token{}, fmt.Errorf("token exchange failed: %v (%v)", result.ErrorDescription, result.Error)
+	}
+
+	if result.RefreshToken == "" {
+		return Token{}, errors.New("token exchange returned no refresh token")
+	}
+
+	token := Token{
+		AccessToken:  result.AccessToken,
+		RefreshToken: result.RefreshToken,
+	}
+
+	if result.ExpiresIn > 0 {
+		clock := f.Clock
+		if clock == nil {
+			clock = myrevenue.SystemClock
+		}
+		token.Expiry = clock.Now().Add(time.Duration(result.ExpiresIn) * time.Second)
+	}
+
+	return token, nil
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
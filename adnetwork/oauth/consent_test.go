@@ -0,0 +1,185 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/econnelly/myrevenue"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeAuthServer is a token endpoint that only accepts the code it issued,
+// with the verifier matching the challenge from the consent URL
+type fakeAuthServer struct {
+	*httptest.Server
+
+	code      string
+	challenge string
+}
+
+func newFakeAuthServer(t *testing.T) *fakeAuthServer {
+	s := &fakeAuthServer{code: "test-auth-code"}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if r.PostForm.Get("grant_type") != "authorization_code" || r.PostForm.Get("code") != s.code ||
+			r.PostForm.Get("client_id") != "client" || r.PostForm.Get("client_secret") != "secret" ||
+			!strings.HasSuffix(r.PostForm.Get("redirect_uri"), REDIRECT_PATH) {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error": "invalid_grant", "error_description": "Bad Request"}`)
+			return
+		}
+
+		if challenge(r.PostForm.Get("code_verifier")) != s.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error": "invalid_grant", "error_description": "Invalid code verifier."}`)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "access",
+			"refresh_token": "refresh",
+			"expires_in":    3600,
+		})
+	}))
+	return s
+}
+
+func (s *fakeAuthServer) flow(clock myrevenue.Clock, respond func(authURL *url.URL) error) InstalledAppFlow {
+	return InstalledAppFlow{
+		ClientID:     "client",
+		ClientSecret: "secret",
+		AuthURL:      s.URL + "/auth",
+		TokenURL:     s.URL + "/token",
+		Scopes:       []string{"scope-a", "scope-b"},
+		Clock:        clock,
+		OpenURL: func(authURL string) error {
+			u, err := url.Parse(authURL)
+			if err != nil {
+				return err
+			}
+			s.challenge = u.Query().Get("code_challenge")
+			// The browser follows the redirect on its own time
+			go respond(u)
+			return nil
+		},
+	}
+}
+
+// redirect plays the browser returning to the loopback server
+func redirect(authURL *url.URL, values url.Values) error {
+	resp, err := http.Get(authURL.Query().Get("redirect_uri") + "?" + values.Encode())
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func TestInstalledAppFlowRun(t *testing.T) {
+	server := newFakeAuthServer(t)
+	defer server.Close()
+
+	now := time.Date(2018, time.October, 1, 12, 0, 0, 0, time.UTC)
+	flow := server.flow(myrevenue.NewFakeClock(now), func(authURL *url.URL) error {
+		query := authURL.Query()
+		if query.Get("code_challenge_method") != "S256" || query.Get("scope") != "scope-a scope-b" || query.Get("access_type") != "offline" {
+			t.Errorf("unexpected consent URL %v", authURL)
+		}
+
+		// Stray requests must not end the flow
+		redirectURI, _ := url.Parse(query.Get("redirect_uri"))
+		if resp, err := http.Get(fmt.Sprintf("http://%v/favicon.ico", redirectURI.Host)); err == nil {
+			resp.Body.Close()
+		}
+		redirect(authURL, url.Values{})
+
+		return redirect(authURL, url.Values{"code": {server.code}, "state": {query.Get("state")}})
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	token, err := flow.Run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token.AccessToken != "access" || token.RefreshToken != "refresh" {
+		t.Errorf("token = %+v", token)
+	}
+	if !token.Expiry.Equal(now.Add(time.Hour)) {
+		t.Errorf("Expiry = %v, want an hour after the clock", token.Expiry)
+	}
+}
+
+func TestInstalledAppFlowStateMismatch(t *testing.T) {
+	server := newFakeAuthServer(t)
+	defer server.Close()
+
+	flow := server.flow(nil, func(authURL *url.URL) error {
+		return redirect(authURL, url.Values{"code": {server.code}, "state": {"forged"}})
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := flow.Run(ctx); err == nil || !strings.Contains(err.Error(), "state mismatch") {
+		t.Errorf("Run() error = %v, want a state mismatch", err)
+	}
+}
+
+func TestInstalledAppFlowDenied(t *testing.T) {
+	server := newFakeAuthServer(t)
+	defer server.Close()
+
+	flow := server.flow(nil, func(authURL *url.URL) error {
+		return redirect(authURL, url.Values{"error": {"access_denied"}, "state": {authURL.Query().Get("state")}})
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := flow.Run(ctx); err == nil || !strings.Contains(err.Error(), "access_denied") {
+		t.Errorf("Run() error = %v, want access_denied", err)
+	}
+}
+
+func TestInstalledAppFlowBadCode(t *testing.T) {
+	server := newFakeAuthServer(t)
+	defer server.Close()
+
+	flow := server.flow(nil, func(authURL *url.URL) error {
+		return redirect(authURL, url.Values{"code": {"stolen"}, "state": {authURL.Query().Get("state")}})
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := flow.Run(ctx); err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Errorf("Run() error = %v, want invalid_grant", err)
+	}
+}
+
+func TestInstalledAppFlowTimeout(t *testing.T) {
+	server := newFakeAuthServer(t)
+	defer server.Close()
+
+	flow := server.flow(nil, func(authURL *url.URL) error {
+		return redirect(authURL, url.Values{})
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if _, err := flow.Run(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Run() error = %v, want the context deadline", err)
+	}
+}
@@ -0,0 +1,135 @@
+package oauth
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var ErrTokenNotFound = errors.New("token not found")
+
+// TokenStore persists tokens by key so rotated refresh tokens survive restarts
+type TokenStore interface {
+	Load(key string) (Token, error)
+	Save(key string, token Token) error
+}
+
+type MemoryStore struct {
+	mu     sync.Mutex
+	tokens map[string]Token
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{tokens: make(map[string]Token)}
+}
+
+func (s *MemoryStore) Load(key string) (Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, found := s.tokens[key]
+	if !found {
+		return Token{}, ErrTokenNotFound
+	}
+	return token, nil
+}
+
+func (s *MemoryStore) Save(key string, token Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.tokens == nil {
+		s.tokens = make(map[string]Token)
+	}
+	s.tokens[key] = token
+	return nil
+}
+
+// FileStore keeps every token in a single JSON file, readable only by the owner
+type FileStore struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+func NewFileStore(path string) *FileStore {
+	return &FileStore{Path: path}
+}
+
+func (s *FileStore) Load(key string) (Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tokens, err := s.read()
+	if err != nil {
+		return Token{}, err
+	}
+
+	token, found := tokens[key]
+	if !found {
+		return Token{}, ErrTokenNotFound
+	}
+	return token, nil
+}
+
+func (s *FileStore) Save(key string, token Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tokens, err := s.read()
+	if err != nil {
+		return err
+	}
+	tokens[key] = token
+
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a crash can't truncate the store
+	tmp, err := ioutil.TempFile(filepath.Dir(s.Path), filepath.Base(s.Path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.Path)
+}
+
+func (s *FileStore) read() (map[string]Token, error) {
+	tokens := make(map[string]Token)
+
+	data, err := ioutil.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return tokens, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if len(data) == 0 {
+		return tokens, nil
+	}
+
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
@@ -0,0 +1,91 @@
+package oauth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	store := NewFileStore(path)
+
+	if _, err := store.Load("admob"); err != ErrTokenNotFound {
+		t.Errorf("Load() from a missing file = %v, want ErrTokenNotFound", err)
+	}
+
+	expiry := time.Date(2018, time.October, 1, 13, 0, 0, 0, time.UTC)
+	tokens := map[string]Token{
+		"admob":      {AccessToken: "a", RefreshToken: "r", Expiry: expiry},
+		"ironsource": {AccessToken: "b"},
+	}
+	for key, token := range tokens {
+		if err := store.Save(key, token); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	// A new store reads back what the other wrote
+	reopened := NewFileStore(path)
+	for key, want := range tokens {
+		got, err := reopened.Load(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.AccessToken != want.AccessToken || got.RefreshToken != want.RefreshToken || !got.Expiry.Equal(want.Expiry) {
+			t.Errorf("Load(%v) = %+v, want %+v", key, got, want)
+		}
+	}
+
+	// Saving replaces one key and leaves no temporary files behind
+	if err := reopened.Save("admob", Token{AccessToken: "c"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := store.Load("admob"); got.AccessToken != "c" {
+		t.Errorf("Load() = %+v after Save", got)
+	}
+	if got, _ := store.Load("ironsource"); got.AccessToken != "b" {
+		t.Errorf("Load() = %+v, want the other key kept", got)
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory holds %v files, want only the store", len(entries))
+	}
+}
+
+func TestFileStoreCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewFileStore(path).Load("admob"); err == nil || err == ErrTokenNotFound {
+		t.Errorf("Load() = %v, want a parse error", err)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	var store MemoryStore
+	if err := store.Save("key", Token{AccessToken: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if token, err := store.Load("key"); err != nil || token.AccessToken != "a" {
+		t.Errorf("Load() = %+v, %v", token, err)
+	}
+	if _, err := store.Load("other"); err != ErrTokenNotFound {
+		t.Errorf("Load() = %v, want ErrTokenNotFound", err)
+	}
+}
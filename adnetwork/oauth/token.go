@@ -0,0 +1,215 @@
+package oauth
+
+import (
+	"errors"
+	"github.com/econnelly/myrevenue"
+	"sync"
+	"time"
+)
+
+// DefaultRefreshMargin is how long before expiry an access token is replaced
+const DefaultRefreshMargin = 5 * time.Minute
+
+type Token struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	Expiry       time.Time `json:"expiry"`
+
+	// Configured is the refresh token from the configuration this token was
+	// obtained with, so a stored token can tell a rotated refresh token from
+	// one the user has since replaced
+	Configured string `json:"configured,omitempty"`
+}
+
+// Response is the subset of an OAuth token endpoint response the Manager needs.
+// ExpiresIn is in seconds; zero means the token is not cached.
+type Response struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    int
+}
+
+// RefreshFunc exchanges a refresh token for a new access token. The refresh
+// token is empty when none is known yet, e.g. before a password grant.
+type RefreshFunc func(refreshToken string) (Response, error)
+
+// Manager hands out access tokens, only calling Refresh when the cached token
+// is missing or about to expire. It is safe for concurrent use.
+type Manager struct {
+	Key     string
+	Refresh RefreshFunc
+	Store   TokenStore // Optional, persists tokens across runs
+	Clock   myrevenue.Clock
+	Margin  time.Duration
+
+	mu         sync.Mutex
+	token      Token
+	configured string
+	loaded     bool
+}
+
+func NewManager(key string, refreshToken string, store TokenStore, refresh RefreshFunc) *Manager {
+	return &Manager{
+		Key:        key,
+		Refresh:    refresh,
+		Store:      store,
+		Clock:      myrevenue.SystemClock,
+		Margin:     DefaultRefreshMargin,
+		token:      Token{RefreshToken: refreshToken},
+		configured: refreshToken,
+	}
+}
+
+var (
+	sharedMu sync.Mutex
+	shared   = make(map[string]*Manager)
+)
+
+// Shared returns the process-wide Manager for key, creating it on first use,
+// so every requester for the same account shares one cached token
+func Shared(key string, refreshToken string, store TokenStore, refresh RefreshFunc) *Manager {
+	sharedMu.Lock()
+	defer sharedMu.Unlock()
+
+	m, found := shared[key]
+	if !found {
+		m = NewManager(key, refreshToken, store, refresh)
+		shared[key] = m
+		return m
+	}
+
+	m.mu.Lock()
+	// The requester may have been handed credentials for a different grant
+	m.Refresh = refresh
+	if m.Store == nil {
+		m.Store = store
+	}
+
+	// A new refresh token in the configuration replaces the cached one
+	if refreshToken != "" && refreshToken != m.configured {
+		m.token = Token{RefreshToken: refreshToken}
+		m.configured = refreshToken
+		m.loaded = false
+	}
+	m.mu.Unlock()
+
+	return m
+}
+
+// AccessToken returns a valid access token, refreshing it if necessary
+func (m *Manager) AccessToken() (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.load(); err != nil {
+		return "", err
+	}
+
+	if m.valid() {
+		return m.token.AccessToken, nil
+	}
+
+	if err := m.refresh(); err != nil {
+		return "", err
+	}
+
+	return m.token.AccessToken, nil
+}
+
+// RefreshToken returns the latest known refresh token
+func (m *Manager) RefreshToken() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.token.RefreshToken
+}
+
+// Invalidate drops the cached access token, e.g. after the API rejected it
+func (m *Manager) Invalidate() {
+	m.mu.Lock()
+	m.token.AccessToken = ""
+	m.token.Expiry = time.Time{}
+	m.mu.Unlock()
+}
+
+func (m *Manager) load() error {
+	if m.loaded || m.Store == nil {
+		return nil
+	}
+
+	stored, err := m.Store.Load(m.Key)
+	if err == ErrTokenNotFound {
+		m.loaded = true
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	m.loaded = true
+
+	// A stored refresh token that differs from the configured one is either
+	// a rotation of it, which must be kept, or left over from before the
+	// user replaced it, e.g. after it was revoked
+	if m.configured != "" && stored.RefreshToken != m.configured && stored.Configured != m.configured {
+		return nil
+	}
+
+	if stored.RefreshToken == "" {
+		stored.RefreshToken = m.token.RefreshToken
+	}
+	m.token = stored
+
+	return nil
+}
+
+func (m *Manager) valid() bool {
+	if m.token.AccessToken == "" || m.token.Expiry.IsZero() {
+		return false
+	}
+
+	return m.now().Add(m.Margin).Before(m.token.Expiry)
+}
+
+func (m *Manager) refresh() error {
+	if m.Refresh == nil {
+		return errors.New("no refresh function")
+	}
+
+	resp, err := m.Refresh(m.token.RefreshToken)
+	if err != nil {
+		return err
+	}
+
+	if resp.AccessToken == "" {
+		return errors.New("empty access token")
+	}
+
+	token := Token{
+		AccessToken:  resp.AccessToken,
+		RefreshToken: m.token.RefreshToken,
+		Configured:   m.configured,
+	}
+
+	// Providers that rotate refresh tokens invalidate the old one, so the new
+	// one has to be kept or the next run can't authenticate
+	if resp.RefreshToken != "" {
+		token.RefreshToken = resp.RefreshToken
+	}
+
+	if resp.ExpiresIn > 0 {
+		token.Expiry = m.now().Add(time.Duration(resp.ExpiresIn) * time.Second)
+	}
+
+	m.token = token
+	if m.Store != nil {
+		return m.Store.Save(m.Key, token)
+	}
+
+	return nil
+}
+
+func (m *Manager) now() time.Time {
+	if m.Clock == nil {
+		return time.Now()
+	}
+	return m.Clock.Now()
+}
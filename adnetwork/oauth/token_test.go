@@ -0,0 +1,201 @@
+package oauth
+
+import (
+	"errors"
+	"fmt"
+	"github.com/econnelly/myrevenue"
+	"testing"
+	"time"
+)
+
+// fakeProvider issues numbered access tokens, optionally rotating the
+// refresh token each time, and rejects refresh tokens it has rotated away
+type fakeProvider struct {
+	rotate  bool
+	calls   int
+	current string
+	used    []string
+}
+
+func (p *fakeProvider) refresh(refreshToken string) (Response, error) {
+	p.used = append(p.used, refreshToken)
+	if p.current != "" && refreshToken != p.current {
+		return Response{}, errors.New("invalid_grant")
+	}
+
+	p.calls++
+	resp := Response{AccessToken: fmt.Sprintf("access-%v", p.calls), ExpiresIn: 3600}
+	if p.rotate {
+		resp.RefreshToken = fmt.Sprintf("refresh-%v", p.calls)
+		p.current = resp.RefreshToken
+	}
+	return resp, nil
+}
+
+func newTestManager(refreshToken string, store TokenStore, provider *fakeProvider) (*Manager, *myrevenue.FakeClock) {
+	clock := myrevenue.NewFakeClock(time.Date(2018, time.October, 1, 12, 0, 0, 0, time.UTC))
+	m := NewManager("test", refreshToken, store, provider.refresh)
+	m.Clock = clock
+	return m, clock
+}
+
+func accessToken(t *testing.T, m *Manager) string {
+	token, err := m.AccessToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestManagerCachesUntilExpiry(t *testing.T) {
+	provider := &fakeProvider{}
+	m, clock := newTestManager("refresh-0", nil, provider)
+
+	if token := accessToken(t, m); token != "access-1" {
+		t.Errorf("AccessToken() = %v", token)
+	}
+
+	clock.Advance(54 * time.Minute)
+	if token := accessToken(t, m); token != "access-1" || provider.calls != 1 {
+		t.Errorf("AccessToken() = %v after %v refreshes, want the cached token", token, provider.calls)
+	}
+
+	// Within the margin of expiry a new one is fetched
+	clock.Advance(2 * time.Minute)
+	if token := accessToken(t, m); token != "access-2" {
+		t.Errorf("AccessToken() = %v, want a refreshed token", token)
+	}
+
+	m.Invalidate()
+	if token := accessToken(t, m); token != "access-3" {
+		t.Errorf("AccessToken() = %v after Invalidate", token)
+	}
+}
+
+func TestManagerNoExpiry(t *testing.T) {
+	calls := 0
+	m := NewManager("test", "refresh", nil, func(string) (Response, error) {
+		calls++
+		return Response{AccessToken: "access"}, nil
+	})
+
+	accessToken(t, m)
+	accessToken(t, m)
+
+	// Without an expiry the token can't be trusted for long
+	if calls != 2 {
+		t.Errorf("refreshed %v times, want 2", calls)
+	}
+}
+
+func TestManagerRotation(t *testing.T) {
+	provider := &fakeProvider{rotate: true}
+	store := NewMemoryStore()
+	m, clock := newTestManager("refresh-0", store, provider)
+
+	accessToken(t, m)
+	if m.RefreshToken() != "refresh-1" {
+		t.Errorf("RefreshToken() = %v, want the rotated token", m.RefreshToken())
+	}
+
+	clock.Advance(time.Hour)
+	accessToken(t, m)
+	if provider.used[1] != "refresh-1" {
+		t.Errorf("refreshed with %v, want the rotated token", provider.used[1])
+	}
+
+	stored, err := store.Load("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.RefreshToken != "refresh-2" || stored.AccessToken != "access-2" || stored.Configured != "refresh-0" {
+		t.Errorf("stored = %+v", stored)
+	}
+
+	// The next run starts from the original configuration and has to pick
+	// up the rotated token, as the configured one is no longer valid
+	next, _ := newTestManager("refresh-0", store, provider)
+	next.Clock = clock
+	if token := accessToken(t, next); token != "access-2" {
+		t.Errorf("AccessToken() = %v, want the stored token", token)
+	}
+	clock.Advance(time.Hour)
+	if token := accessToken(t, next); token != "access-3" {
+		t.Errorf("AccessToken() = %v, want a token from the rotated refresh token", token)
+	}
+}
+
+func TestManagerPrefersReplacedRefreshToken(t *testing.T) {
+	store := NewMemoryStore()
+	store.Save("test", Token{
+		AccessToken:  "stale",
+		RefreshToken: "revoked",
+		Expiry:       time.Date(2018, time.October, 1, 13, 0, 0, 0, time.UTC),
+		Configured:   "revoked",
+	})
+
+	provider := &fakeProvider{}
+	m, _ := newTestManager("replacement", store, provider)
+
+	if token := accessToken(t, m); token != "access-1" {
+		t.Errorf("AccessToken() = %v, want a new token", token)
+	}
+	if len(provider.used) != 1 || provider.used[0] != "replacement" {
+		t.Errorf("refreshed with %v, want the configured token", provider.used)
+	}
+
+	// Tokens from the consent flow are used when nothing is configured
+	m, _ = newTestManager("", store, &fakeProvider{})
+	if token := accessToken(t, m); token != "access-1" || m.RefreshToken() != "replacement" {
+		t.Errorf("AccessToken(), RefreshToken() = %v, %v", token, m.RefreshToken())
+	}
+}
+
+func TestManagerRefreshError(t *testing.T) {
+	m := NewManager("test", "refresh", nil, func(string) (Response, error) {
+		return Response{}, errors.New("invalid_grant")
+	})
+
+	if _, err := m.AccessToken(); err == nil || err.Error() != "invalid_grant" {
+		t.Errorf("AccessToken() error = %v", err)
+	}
+
+	m.Refresh = func(string) (Response, error) { return Response{}, nil }
+	if _, err := m.AccessToken(); err == nil {
+		t.Error("expected an error for an empty access token")
+	}
+}
+
+func TestShared(t *testing.T) {
+	provider := &fakeProvider{}
+	a := Shared("shared-test-a", "refresh", nil, provider.refresh)
+	b := Shared("shared-test-a", "refresh", nil, provider.refresh)
+	c := Shared("shared-test-b", "refresh", nil, provider.refresh)
+
+	if a != b {
+		t.Error("Shared() returned different managers for the same key")
+	}
+	if a == c {
+		t.Error("Shared() returned the same manager for different keys")
+	}
+
+	accessToken(t, a)
+	accessToken(t, b)
+	if provider.calls != 1 {
+		t.Errorf("refreshed %v times, want the token shared", provider.calls)
+	}
+
+	// A store handed over later is picked up
+	store := NewMemoryStore()
+	Shared("shared-test-a", "", store, provider.refresh)
+	if a.Store != store {
+		t.Error("Shared() didn't take the store")
+	}
+
+	// A different configured refresh token starts over
+	Shared("shared-test-a", "replacement", nil, provider.refresh)
+	accessToken(t, a)
+	if provider.used[len(provider.used)-1] != "replacement" {
+		t.Errorf("refreshed with %v, want the replacement", provider.used)
+	}
+}
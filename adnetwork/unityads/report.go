@@ -0,0 +1,272 @@
+package unityads
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/econnelly/myrevenue"
+	"github.com/econnelly/myrevenue/adnetwork"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const DEFAULT_BASE_URL = "https://monetization.api.unity.com"
+
+type ReportRequester struct {
+	OrganizationID string   `json:"organization_id"`
+	APIKey         string   `json:"api_key"`
+	SplitBy        []string `json:"split_by"` // Any of COUNTRY, SOURCE, PLACEMENT, PLATFORM. Defaults to COUNTRY and SOURCE.
+	Scale          string   `json:"scale"`    // DAY or HOUR, defaults to DAY
+	BaseURL        string   `json:"base_url"` // Defaults to DEFAULT_BASE_URL
+	StartDate      time.Time
+	EndDate        time.Time
+	adnetwork.Request
+
+	reportURL string
+	rawData   ReportResponse
+}
+
+type ReportResponse struct {
+	Data [][]string
+}
+
+// Split by
+const (
+	COUNTRY   = "country"
+	SOURCE    = "game"
+	PLACEMENT = "placement"
+	PLATFORM  = "platform"
+)
+
+// Scales
+const (
+	DAY  = "day"
+	HOUR = "hour"
+)
+
+// Fields
+const (
+	AD_REQUESTS = "adrequest_count"
+	AVAILABLE   = "available_sum"
+	STARTS      = "start_count"
+	VIEWS       = "view_count"
+	REVENUE     = "revenue_sum"
+)
+
+// columnNames lists the headers each value has been reported under, newest
+// API first, so exports from the older monetization API parse too
+var columnNames = map[string][]string{
+	"timestamp": {"timestamp", "Date"},
+	COUNTRY:     {"country", "Country code"},
+	SOURCE:      {"source_name", "game", "Source game name", "source_game_id", "Source game id"},
+	PLACEMENT:   {"placement", "zone", "Zone"},
+	PLATFORM:    {"platform", "Platform"},
+	AD_REQUESTS: {"adrequest_count", "adrequests"},
+	AVAILABLE:   {"available_sum", "available"},
+	STARTS:      {"start_count", "started"},
+	VIEWS:       {"view_count", "views"},
+	REVENUE:     {"revenue_sum", "revenue"},
+}
+
+var timestampFormats = []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02"}
+
+func (rr *ReportRequester) Initialize() error {
+	if rr.OrganizationID == "" || rr.APIKey == "" {
+		return errors.New("Unity Ads: organization ID and API key are required")
+	}
+
+	if rr.EndDate.Before(rr.StartDate) {
+		return fmt.Errorf("start date (%v) is after end date (%v)", rr.StartDate, rr.EndDate)
+	}
+
+	if rr.BaseURL == "" {
+		rr.BaseURL = DEFAULT_BASE_URL
+	}
+
+	if rr.Scale == "" {
+		rr.Scale = DAY
+	}
+
+	splitBy := rr.SplitBy
+	if len(splitBy) == 0 {
+		splitBy = []string{COUNTRY, SOURCE}
+	}
+
+	query := url.Values{}
+	query.Set("apikey", rr.APIKey)
+	query.Add("groupBy", strings.Join(splitBy, ","))
+	query.Add("fields", strings.Join([]string{AD_REQUESTS, AVAILABLE, STARTS, VIEWS, REVENUE}, ","))
+	query.Add("scale", rr.Scale)
+	// The end of the range is exclusive, so ask for up to the following midnight
+	end := time.Date(rr.EndDate.Year(), rr.EndDate.Month(), rr.EndDate.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, 1)
+	query.Add("start", rr.StartDate.Format("2006-01-02")+"T00:00:00Z")
+	query.Add("end", end.Format(time.RFC3339))
+
+	rr.reportURL = fmt.Sprintf("%v/stats/v1/operate/organizations/%v?%v", rr.BaseURL, url.PathEscape(rr.OrganizationID), query.Encode())
+
+	return nil
+}
+
+func (rr *ReportRequester) Fetch() ([]myrevenue.Model, error) {
+	headers := map[string]string{
+		"Accept": "text/csv",
+	}
+
+	resp, err := myrevenue.GetRequest(rr.reportURL, headers, false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, errors.Errorf("%v: request failed (%v): %v", rr.GetName(), resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	return rr.parse(resp.Body)
+}
+
+func (rr *ReportRequester) parse(reader io.Reader) ([]myrevenue.Model, error) {
+	records, err := csv.NewReader(reader).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	rr.rawData = ReportResponse{
+		Data: records,
+	}
+	return rr.convertCSVToModel(records)
+}
+
+func (rr ReportRequester) convertCSVToModel(records [][]string) ([]myrevenue.Model, error) {
+	if len(records) == 0 {
+		return nil, errors.New("0-length csv")
+	}
+
+	headerMap := make(map[string]int)
+	for i, h := range records[0] {
+		headerMap[strings.TrimSpace(h)] = i
+	}
+
+	columns := make(map[string]int)
+	for key, names := range columnNames {
+		for _, name := range names {
+			if index, found := headerMap[name]; found {
+				columns[key] = index
+				break
+			}
+		}
+	}
+
+	if _, found := columns["timestamp"]; !found {
+		return nil, errors.Errorf("%v: no timestamp column in %v", rr.GetName(), records[0])
+	}
+
+	reportModels := make([]myrevenue.Model, len(records)-1)
+	for i, record := range records[1:] {
+		row := i + 2
+		field := func(key string) string {
+			index, found := columns[key]
+			if !found || index >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[index])
+		}
+
+		parseError := func(key string, err error) error {
+			return &myrevenue.ParseError{Network: rr.GetName(), Row: row, Column: key, Err: err}
+		}
+
+		model := &reportModels[i]
+		model.NetworkName = rr.GetName()
+
+		day, err := parseTimestamp(field("timestamp"))
+		if err != nil {
+			return nil, parseError("timestamp", err)
+		}
+		model.DateTime = day
+
+		model.Country = strings.ToUpper(field(COUNTRY))
+		model.App = field(SOURCE)
+		model.AdUnit = field(PLACEMENT)
+		model.Platform = field(PLATFORM)
+
+		requests, err := parseNumber(field(AD_REQUESTS))
+		if err != nil {
+			return nil, parseError(AD_REQUESTS, err)
+		}
+
+		starts, err := parseNumber(field(STARTS))
+		if err != nil {
+			return nil, parseError(STARTS, err)
+		}
+
+		views, err := parseNumber(field(VIEWS))
+		if err != nil {
+			return nil, parseError(VIEWS, err)
+		}
+
+		available, err := parseNumber(field(AVAILABLE))
+		if err != nil {
+			return nil, parseError(AVAILABLE, err)
+		}
+
+		revenue, err := parseNumber(field(REVENUE))
+		if err != nil {
+			return nil, parseError(REVENUE, err)
+		}
+
+		// An ad start is the closest Unity has to an impression
+		model.Requests = uint64(requests)
+		model.Impressions = uint64(starts)
+		model.Revenue = revenue
+		if starts > 0 {
+			model.ECPM = revenue / starts * 1000
+		}
+
+		model.SetExtendedMetric(VIEWS, views)
+		model.SetExtendedMetric(AVAILABLE, available)
+	}
+
+	return reportModels, nil
+}
+
+func parseTimestamp(value string) (time.Time, error) {
+	var err error
+	for _, format := range timestampFormats {
+		var t time.Time
+		if t, err = time.ParseInLocation(format, value, time.UTC); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+func parseNumber(value string) (float64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(value, 64)
+}
+
+func (ReportRequester) GetName() string {
+	return "Unity Ads"
+}
+
+func (rr ReportRequester) GetReport() interface{} {
+	return rr.rawData
+}
+
+func (rr ReportRequester) GetStartDate() time.Time {
+	return rr.StartDate
+}
+
+func (rr ReportRequester) GetEndDate() time.Time {
+	return rr.EndDate
+}
@@ -0,0 +1,134 @@
+package unityads
+
+import (
+	"errors"
+	"fmt"
+	"github.com/econnelly/myrevenue"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newFakeServer(t *testing.T, status int, body string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if r.URL.Path != "/stats/v1/operate/organizations/org-1" || query.Get("apikey") != "key" || r.Header.Get("Accept") != "text/csv" {
+			t.Errorf("unexpected request %v", r.URL)
+		}
+		if query.Get("start") != "2018-10-01T00:00:00Z" || query.Get("end") != "2018-10-02T00:00:00Z" || query.Get("groupBy") != "country,game" {
+			t.Errorf("unexpected query %v", query)
+		}
+
+		w.WriteHeader(status)
+		fmt.Fprint(w, body)
+	}))
+}
+
+func fetch(t *testing.T, server *httptest.Server) ([]myrevenue.Model, error) {
+	day := time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC)
+	rr := ReportRequester{OrganizationID: "org-1", APIKey: "key", BaseURL: server.URL, StartDate: day, EndDate: day}
+	if err := rr.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	return rr.Fetch()
+}
+
+func TestFetch(t *testing.T) {
+	report, err := os.ReadFile("testdata/report.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := newFakeServer(t, http.StatusOK, string(report))
+	defer server.Close()
+
+	models, err := fetch(t, server)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(models) != 2 {
+		t.Fatalf("got %v models, want 2", len(models))
+	}
+
+	m := models[0]
+	if m.NetworkName != "Unity Ads" || m.Country != "US" || m.App != "Example Game" || m.AdUnit != "rewardedVideo" || m.Platform != "ios" {
+		t.Errorf("dimensions = %+v", m)
+	}
+	if m.Requests != 2000 || m.Impressions != 1500 || m.Revenue != 7.5 || m.ECPM != 5 {
+		t.Errorf("metrics = %+v", m)
+	}
+	if m.ExtendedMetrics[VIEWS] != 1400 || m.ExtendedMetrics[AVAILABLE] != 1800 {
+		t.Errorf("extended metrics = %v", m.ExtendedMetrics)
+	}
+	if !m.DateTime.Equal(time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("DateTime = %v", m.DateTime)
+	}
+
+	if models[1].ECPM != 0 {
+		t.Errorf("ECPM without starts = %v, want 0", models[1].ECPM)
+	}
+}
+
+func TestParseLegacyColumns(t *testing.T) {
+	f, err := os.Open("testdata/legacy_report.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	rr := ReportRequester{}
+	models, err := rr.parse(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(models) != 1 {
+		t.Fatalf("got %v models, want 1", len(models))
+	}
+	m := models[0]
+	if m.Country != "DE" || m.App != "Example Game" || m.AdUnit != "rewardedVideo" || m.Requests != 100 || m.Impressions != 80 || m.Revenue != 0.4 {
+		t.Errorf("model = %+v", m)
+	}
+	if m.ExtendedMetrics[VIEWS] != 75 || m.ExtendedMetrics[AVAILABLE] != 90 {
+		t.Errorf("extended metrics = %v", m.ExtendedMetrics)
+	}
+}
+
+func TestFetchErrorBody(t *testing.T) {
+	server := newFakeServer(t, http.StatusUnauthorized, `{"errors": [{"message": "Invalid API key"}]}`+"\n")
+	defer server.Close()
+
+	_, err := fetch(t, server)
+	if err == nil || !strings.Contains(err.Error(), "Unity Ads: request failed (401): ") || !strings.Contains(err.Error(), "Invalid API key") {
+		t.Errorf("Fetch() error = %v, want the status and body", err)
+	}
+}
+
+func TestParseBadRow(t *testing.T) {
+	tests := []struct {
+		report string
+		column string
+	}{
+		{"timestamp,revenue_sum\n2018-10-01,1\n2018-10-02,lots\n", REVENUE},
+		{"timestamp,start_count\n2018-10-01,1\nyesterday,2\n", "timestamp"},
+	}
+
+	for _, test := range tests {
+		rr := ReportRequester{}
+		_, err := rr.parse(strings.NewReader(test.report))
+
+		var parseErr *myrevenue.ParseError
+		if !errors.As(err, &parseErr) || parseErr.Row != 3 || parseErr.Column != test.column {
+			t.Errorf("parse(%q) error = %v, want row 3 column %v", test.report, err, test.column)
+		}
+	}
+
+	rr := ReportRequester{}
+	if _, err := rr.parse(strings.NewReader("day,revenue\n2018-10-01,1\n")); err == nil {
+		t.Error("expected an error without a timestamp column")
+	}
+}
@@ -0,0 +1,151 @@
+package vungle
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/econnelly/myrevenue"
+	"github.com/econnelly/myrevenue/adnetwork"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const DEFAULT_BASE_URL = "https://report.api.vungle.com"
+
+type ReportRequester struct {
+	APIKey    string `json:"api_key"`
+	BaseURL   string `json:"base_url"` // Defaults to DEFAULT_BASE_URL
+	StartDate time.Time
+	EndDate   time.Time
+	adnetwork.Request
+
+	reportURL string
+	rawData   ReportResponse
+}
+
+type ReportResponse []struct {
+	Date            string  `json:"date"`
+	Country         string  `json:"country"`
+	ApplicationID   string  `json:"application id"`
+	ApplicationName string  `json:"application name"`
+	Platform        string  `json:"platform"`
+	Views           uint64  `json:"views"`
+	Completes       uint64  `json:"completes"`
+	Clicks          uint64  `json:"clicks"`
+	Revenue         float64 `json:"revenue"`
+	ECPM            float64 `json:"ecpm"`
+}
+
+// Extended metrics
+const COMPLETES = "completes"
+
+func (rr *ReportRequester) Initialize() error {
+	if rr.APIKey == "" {
+		return errors.New("Vungle: API key is required")
+	}
+
+	if rr.BaseURL == "" {
+		rr.BaseURL = DEFAULT_BASE_URL
+	}
+
+	query := url.Values{}
+	query.Set("start", rr.StartDate.Format("2006-01-02"))
+	query.Add("end", rr.EndDate.Format("2006-01-02"))
+	query.Add("dimensions", "date,country,application,platform")
+	query.Add("aggregates", "views,completes,clicks,revenue,ecpm")
+
+	rr.reportURL = fmt.Sprintf("%v/ext/pub/reports/performance?%v", rr.BaseURL, query.Encode())
+
+	return nil
+}
+
+func (rr *ReportRequester) Fetch() ([]myrevenue.Model, error) {
+	headers := map[string]string{
+		"Accept":         "application/json",
+		"Authorization":  fmt.Sprintf("Bearer %v", rr.APIKey),
+		"Vungle-Version": "1",
+	}
+
+	resp, err := myrevenue.GetRequest(rr.reportURL, headers, false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, errors.Errorf("%v: request failed (%v): %v", rr.GetName(), resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	return rr.parse(resp.Body)
+}
+
+func (rr *ReportRequester) parse(reader io.Reader) ([]myrevenue.Model, error) {
+	result := ReportResponse{}
+
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+
+	rr.rawData = result
+	return rr.convertToReportModel(result)
+}
+
+func (rr ReportRequester) convertToReportModel(response ReportResponse) ([]myrevenue.Model, error) {
+	loc, e := time.LoadLocation("Etc/UTC")
+	if e != nil {
+		return nil, e
+	}
+
+	reportModels := make([]myrevenue.Model, len(response))
+	for i, row := range response {
+		day, err := time.ParseInLocation("2006-01-02", row.Date, loc)
+		if err != nil {
+			return nil, &myrevenue.ParseError{Network: rr.GetName(), Row: i + 1, Column: "date", Err: err}
+		}
+
+		reportModels[i].NetworkName = rr.GetName()
+		reportModels[i].DateTime = day
+		reportModels[i].Country = row.Country
+		reportModels[i].App = row.ApplicationID
+		reportModels[i].Name = row.ApplicationName
+		reportModels[i].Platform = row.Platform
+		reportModels[i].Impressions = row.Views
+		reportModels[i].Clicks = row.Clicks
+		reportModels[i].Revenue = row.Revenue
+		reportModels[i].ECPM = row.ECPM
+		if row.Views > 0 {
+			reportModels[i].CTR = float64(row.Clicks) / float64(row.Views)
+		}
+
+		reportModels[i].SetExtendedMetric(COMPLETES, float64(row.Completes))
+	}
+
+	return reportModels, nil
+}
+
+func (ReportRequester) GetName() string {
+	return "Vungle"
+}
+
+func (rr ReportRequester) GetReport() interface{} {
+	return rr.rawData
+}
+
+func (rr ReportRequester) GetStartDate() time.Time {
+	return rr.StartDate
+}
+
+func (rr ReportRequester) GetEndDate() time.Time {
+	return rr.EndDate
+}
@@ -0,0 +1,72 @@
+package vungle
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFetch(t *testing.T) {
+	var request *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request = r
+		if r.Header.Get("Authorization") != "Bearer key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"message": "Unauthorized"}`))
+			return
+		}
+		http.ServeFile(w, r, "testdata/performance.json")
+	}))
+	defer server.Close()
+
+	rr := &ReportRequester{
+		APIKey:    "key",
+		BaseURL:   server.URL,
+		StartDate: time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2018, time.October, 2, 0, 0, 0, 0, time.UTC),
+	}
+	if err := rr.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	models, err := rr.Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if request.URL.Path != "/ext/pub/reports/performance" || request.Header.Get("Vungle-Version") != "1" {
+		t.Errorf("request = %v %v", request.URL, request.Header)
+	}
+	if query := request.URL.Query(); query.Get("start") != "2018-10-01" || query.Get("end") != "2018-10-02" {
+		t.Errorf("query = %v", query)
+	}
+
+	if len(models) != 2 {
+		t.Fatalf("got %v models, want 2", len(models))
+	}
+
+	m := models[0]
+	if m.App != "5a1b2c" || m.Name != "Example App" || m.Country != "US" || m.Impressions != 1000 || m.Clicks != 25 || m.Revenue != 12.5 {
+		t.Errorf("model = %+v", m)
+	}
+	if m.ExtendedMetrics[COMPLETES] != 900 || m.CTR != 0.025 {
+		t.Errorf("completes, CTR = %v, %v", m.ExtendedMetrics[COMPLETES], m.CTR)
+	}
+	if models[1].DateTime.Format("2006-01-02") != "2018-10-02" {
+		t.Errorf("DateTime = %v", models[1].DateTime)
+	}
+
+	rr.APIKey = "wrong"
+	if _, err := rr.Fetch(); err == nil || !strings.Contains(err.Error(), "request failed (401)") {
+		t.Errorf("Fetch() with a bad key error = %v", err)
+	}
+}
+
+func TestParseBadDate(t *testing.T) {
+	rr := &ReportRequester{}
+	if _, err := rr.parse(strings.NewReader(`[{"date": "10/01/2018"}]`)); err == nil || !strings.Contains(err.Error(), `row 1, column "date"`) {
+		t.Errorf("parse() error = %v", err)
+	}
+}
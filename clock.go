@@ -0,0 +1,66 @@
+package myrevenue
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the source of the current time for date range resolution, token
+// expiry and scheduling. Swap it out to replay a run as of a given date.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// SystemClock returns the wall clock
+var SystemClock Clock = systemClock{}
+
+// FakeClock is a Clock that only moves when told to
+type FakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) Set(now time.Time) {
+	c.mu.Lock()
+	c.now = now
+	c.mu.Unlock()
+}
+
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+// AsOf returns a clock frozen at the start of the given date (2006-01-02) in
+// the given timezone, so history keywords like "yesterday" resolve as if the
+// report had been run on that day.
+func AsOf(date string, tz string) (Clock, error) {
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, err
+	}
+
+	day, err := time.ParseInLocation("2006-01-02", date, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewFakeClock(day), nil
+}
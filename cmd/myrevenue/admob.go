@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/econnelly/myrevenue/adnetwork/admob"
+	"github.com/econnelly/myrevenue/adnetwork/oauth"
+	"os"
+	"time"
+)
+
+func admobAuth(args []string) error {
+	flags := flag.NewFlagSet("admob-auth", flag.ExitOnError)
+	clientID := flags.String("client-id", "", "OAuth client ID")
+	clientSecret := flags.String("client-secret", "", "OAuth client secret")
+	publisherID := flags.String("publisher-id", "", "AdMob publisher ID, e.g. pub-1234567890")
+	tokenFile := flags.String("token-file", "tokens.json", "file the tokens are saved to")
+	timeout := flags.Duration("timeout", 5*time.Minute, "how long to wait for consent")
+	flags.Parse(args)
+
+	if *clientID == "" || *clientSecret == "" || *publisherID == "" {
+		flags.Usage()
+		return errors.New("client-id, client-secret and publisher-id are required")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	rr := admob.ReportRequester{
+		ClientID:     *clientID,
+		ClientSecret: *clientSecret,
+		PublisherID:  *publisherID,
+	}
+
+	openURL := func(authURL string) error {
+		fmt.Fprintf(os.Stderr, "Open this URL in your browser to grant access:\n\n%v\n\n", authURL)
+		return nil
+	}
+
+	if _, err := admob.Authorize(ctx, rr, oauth.NewFileStore(*tokenFile), openURL); err != nil {
+		return err
+	}
+
+	fmt.Printf("Saved tokens to %v, set \"token_file\" in the admob settings to fetch with them\n", *tokenFile)
+	return nil
+}
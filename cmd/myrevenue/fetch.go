@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/econnelly/myrevenue"
+	"github.com/econnelly/myrevenue/adnetwork"
+	"github.com/econnelly/myrevenue/adnetwork/adcolony"
+	"github.com/econnelly/myrevenue/adnetwork/admob"
+	"github.com/econnelly/myrevenue/adnetwork/amazon"
+	"github.com/econnelly/myrevenue/adnetwork/applovin"
+	"github.com/econnelly/myrevenue/adnetwork/chartboost"
+	"github.com/econnelly/myrevenue/adnetwork/flurry"
+	"github.com/econnelly/myrevenue/adnetwork/glispa"
+	"github.com/econnelly/myrevenue/adnetwork/inmobi"
+	"github.com/econnelly/myrevenue/adnetwork/ironsource"
+	"github.com/econnelly/myrevenue/adnetwork/meta"
+	"github.com/econnelly/myrevenue/adnetwork/mobfox"
+	"github.com/econnelly/myrevenue/adnetwork/mopub"
+	"github.com/econnelly/myrevenue/adnetwork/unityads"
+	"github.com/econnelly/myrevenue/adnetwork/vungle"
+	"github.com/econnelly/myrevenue/ingest"
+	"github.com/econnelly/myrevenue/store/appstore"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// requesters maps the network names used in fetch configs to adapters
+var requesters = map[string]func() adnetwork.Request{
+	"adcolony":   func() adnetwork.Request { return &adcolony.ReportRequester{} },
+	"admob":      func() adnetwork.Request { return &admob.ReportRequester{} },
+	"amazon":     func() adnetwork.Request { return &amazon.ReportRequester{} },
+	"applovin":   func() adnetwork.Request { return &applovin.ReportRequester{} },
+	"appstore":   func() adnetwork.Request { return &appstore.ReportRequester{} },
+	"chartboost": func() adnetwork.Request { return &chartboost.ReportRequester{} },
+	"flurry":     func() adnetwork.Request { return &flurry.ReportRequester{} },
+	"glispa":     func() adnetwork.Request { return &glispa.ReportRequester{} },
+	"inmobi":     func() adnetwork.Request { return &inmobi.ReportRequester{} },
+	"ironsource": func() adnetwork.Request { return &ironsource.ReportRequester{} },
+	"meta":       func() adnetwork.Request { return &meta.ReportRequester{} },
+	"mobfox":     func() adnetwork.Request { return &mobfox.ReportRequester{} },
+	"mopub":      func() adnetwork.Request { return &mopub.ReportRequester{} },
+	"unityads":   func() adnetwork.Request { return &unityads.ReportRequester{} },
+	"vungle":     func() adnetwork.Request { return &vungle.ReportRequester{} },
+}
+
+// fetchConfig is the JSON file read by the fetch command. Settings holds each
+// adapter's ReportRequester fields as JSON, and Account labels the models
+// when the same network is listed more than once.
+type fetchConfig struct {
+	History  string `json:"history"`
+	Timezone string `json:"timezone"`
+
+	// AsOf (2006-01-02) resolves History as if run on that day
+	AsOf string `json:"as_of,omitempty"`
+
+	Networks []struct {
+		Network  string          `json:"network"`
+		Account  string          `json:"account,omitempty"`
+		Settings json.RawMessage `json:"settings"`
+	} `json:"networks"`
+}
+
+func fetchRevenue(args []string) error {
+	flags := flag.NewFlagSet("fetch", flag.ExitOnError)
+	configFile := flags.String("config", "", "JSON file listing the networks to fetch")
+	history := flags.String("history", "", "yesterday, today, week, month-to-date, last-month, a date or a number of days ago (overrides the config)")
+	tz := flags.String("tz", "", "timezone the history is resolved in (overrides the config)")
+	asOf := flags.String("as-of", "", "resolve the history as if run on this date, 2006-01-02 (overrides the config)")
+	flags.Parse(args)
+
+	if *configFile == "" {
+		flags.Usage()
+		return errors.New("config is required")
+	}
+
+	content, err := ioutil.ReadFile(*configFile)
+	if err != nil {
+		return err
+	}
+
+	config := fetchConfig{}
+	if err := json.Unmarshal(content, &config); err != nil {
+		return fmt.Errorf("%v: %v", *configFile, err)
+	}
+
+	if *history != "" {
+		config.History = *history
+	}
+	if *tz != "" {
+		config.Timezone = *tz
+	}
+	if *asOf != "" {
+		config.AsOf = *asOf
+	}
+
+	startDate, endDate, err := config.dateRange()
+	if err != nil {
+		return err
+	}
+
+	sink := &ingest.JSONLinesSink{Writer: os.Stdout}
+	for _, n := range config.Networks {
+		rr, err := config.requester(n.Network, n.Settings, startDate, endDate)
+		if err != nil {
+			return err
+		}
+
+		if err := rr.Initialize(); err != nil {
+			return fmt.Errorf("%v: %v", n.Network, err)
+		}
+
+		models, err := rr.Fetch()
+		if err != nil {
+			return fmt.Errorf("%v: %v", n.Network, err)
+		}
+
+		for i := range models {
+			models[i].Account = n.Account
+		}
+
+		if err := sink.Write(*configFile, rr.GetName(), models); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// dateRange resolves the history keyword, against the as-of date when set
+func (c fetchConfig) dateRange() (time.Time, time.Time, error) {
+	if c.History == "" {
+		c.History = "yesterday"
+	}
+	if c.Timezone == "" {
+		c.Timezone = "UTC"
+	}
+
+	clock := myrevenue.SystemClock
+	if c.AsOf != "" {
+		var err error
+		if clock, err = myrevenue.AsOf(c.AsOf, c.Timezone); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("as-of: %v", err)
+		}
+	}
+
+	return myrevenue.DateRangeFromHistoryAt(c.History, c.Timezone, clock)
+}
+
+// requester builds the named adapter from its settings with the resolved
+// dates filled in
+func (c fetchConfig) requester(network string, settings json.RawMessage, startDate time.Time, endDate time.Time) (adnetwork.Request, error) {
+	newRequester, found := requesters[network]
+	if !found {
+		return nil, fmt.Errorf("unknown network %q", network)
+	}
+
+	rr := newRequester()
+	if len(settings) > 0 {
+		if err := json.Unmarshal(settings, rr); err != nil {
+			return nil, fmt.Errorf("%v: %v", network, err)
+		}
+	}
+
+	dates, err := json.Marshal(map[string]time.Time{"StartDate": startDate, "EndDate": endDate})
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(dates, rr); err != nil {
+		return nil, err
+	}
+
+	return rr, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/econnelly/myrevenue/adnetwork/admob"
+	"github.com/econnelly/myrevenue/adnetwork/mopub"
+	"github.com/econnelly/myrevenue/store/appstore"
+	"testing"
+	"time"
+)
+
+func TestFetchConfigAsOf(t *testing.T) {
+	config := fetchConfig{}
+	err := json.Unmarshal([]byte(`{"history": "month-to-date", "timezone": "UTC", "as_of": "2018-03-01"}`), &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start, end, err := config.dateRange()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if start.Format("2006-01-02") != "2018-02-01" || end.Format("2006-01-02") != "2018-02-28" {
+		t.Errorf("month-to-date as of 2018-03-01 = %v to %v", start, end)
+	}
+
+	config.AsOf = "not-a-date"
+	if _, _, err := config.dateRange(); err == nil {
+		t.Error("expected an error for an invalid as-of date")
+	}
+}
+
+func TestFetchConfigRequesterDates(t *testing.T) {
+	config := fetchConfig{History: "yesterday", Timezone: "UTC", AsOf: "2018-03-01"}
+	start, end, err := config.dateRange()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr, err := config.requester("mopub", json.RawMessage(`{"api_key": "key", "report_key": "report"}`), start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mopubRequester := rr.(*mopub.ReportRequester)
+	if mopubRequester.APIKey != "key" {
+		t.Errorf("APIKey = %q, want the configured key", mopubRequester.APIKey)
+	}
+	if !mopubRequester.StartDate.Equal(start) || !mopubRequester.EndDate.Equal(end) {
+		t.Errorf("dates = %v to %v, want %v to %v", mopubRequester.StartDate, mopubRequester.EndDate, start, end)
+	}
+
+	if _, err := config.requester("nope", nil, start, end); err == nil {
+		t.Error("expected an error for an unknown network")
+	}
+}
+
+func TestFetchConfigAdmobTokenFile(t *testing.T) {
+	config := fetchConfig{}
+	rr, err := config.requester("admob", json.RawMessage(`{"client_id": "id", "publisher_id": "pub-1", "token_file": "tokens.json"}`), time.Now(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tokenFile := rr.(*admob.ReportRequester).TokenFile; tokenFile != "tokens.json" {
+		t.Errorf("TokenFile = %q, want the file admob-auth wrote", tokenFile)
+	}
+}
+
+func TestFetchConfigAppStore(t *testing.T) {
+	config := fetchConfig{}
+	rr, err := config.requester("appstore", json.RawMessage(`{"issuer_id": "issuer", "key_id": "key", "vendor_number": "80012345", "report_type": "FINANCIAL"}`), time.Now(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if appstoreRequester := rr.(*appstore.ReportRequester); appstoreRequester.VendorNumber != "80012345" || appstoreRequester.ReportType != appstore.FINANCIAL {
+		t.Errorf("requester = %+v", appstoreRequester)
+	}
+}
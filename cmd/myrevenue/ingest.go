@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"github.com/econnelly/myrevenue/ingest"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+)
+
+func ingestFolder(args []string) error {
+	flags := flag.NewFlagSet("ingest", flag.ExitOnError)
+	dir := flags.String("dir", "", "directory to watch for report files")
+	out := flags.String("out", "", "file to append JSON lines to, defaults to stdout")
+	interval := flags.Duration("interval", ingest.DEFAULT_INTERVAL, "how often to scan the directory")
+	once := flags.Bool("once", false, "scan once and exit")
+	flags.Parse(args)
+
+	if *dir == "" {
+		flags.Usage()
+		return errors.New("dir is required")
+	}
+
+	output := os.Stdout
+	if *out != "" {
+		f, err := os.OpenFile(*out, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		output = f
+	}
+
+	watcher := ingest.Watcher{
+		Dir:      *dir,
+		Sink:     &ingest.JSONLinesSink{Writer: output},
+		Interval: *interval,
+		Log:      log.Printf,
+	}
+
+	if *once {
+		watcher.SettleTime = time.Nanosecond
+		return watcher.ScanOnce()
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	return watcher.Run(ctx)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/econnelly/myrevenue"
+	"github.com/econnelly/myrevenue/reconcile"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+func reconcilePayouts(args []string) error {
+	flags := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	revenue := flags.String("revenue", "", "JSON lines of reported revenue, as written by ingest")
+	payoutFile := flags.String("payouts", "", "CSV of payouts with date, network, amount and currency columns")
+	threshold := flags.Float64("threshold", 1, "smallest variance worth reporting, in the payout currency")
+	thresholdPercent := flags.Float64("threshold-percent", 1, "smallest variance worth reporting, as a percentage of reported revenue")
+	terms := flags.String("terms", "", "payment terms per network, e.g. \"admob=30,unityads=60\"; names ignore case and spaces (default net-30)")
+	shareFile := flags.String("share", "", "JSON revenue-share rules, applied before reconciling so payouts are compared with net revenue")
+	flags.Parse(args)
+
+	if *revenue == "" || *payoutFile == "" {
+		flags.Usage()
+		return errors.New("revenue and payouts are required")
+	}
+
+	models, err := readModels(*revenue)
+	if err != nil {
+		return err
+	}
+
+	records := myrevenue.RecordsFromModels(models)
+	if *shareFile != "" {
+		share, err := myrevenue.LoadRevenueShare(*shareFile)
+		if err != nil {
+			return err
+		}
+
+		if records, err = share.Apply(records); err != nil {
+			return fmt.Errorf("%v: %v", *shareFile, err)
+		}
+	}
+
+	f, err := os.Open(*payoutFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	payouts, err := reconcile.ParsePayouts(f)
+	if err != nil {
+		return err
+	}
+
+	reconciler := reconcile.Reconciler{Threshold: *threshold, ThresholdPercent: *thresholdPercent}
+	if *terms != "" {
+		for _, term := range strings.Split(*terms, ",") {
+			parts := strings.SplitN(term, "=", 2)
+			if len(parts) != 2 {
+				return fmt.Errorf("invalid terms %q", term)
+			}
+
+			days, err := strconv.Atoi(strings.TrimPrefix(strings.ToLower(strings.TrimSpace(parts[1])), "net-"))
+			if err != nil {
+				return fmt.Errorf("invalid terms %q", term)
+			}
+			reconciler.Terms = append(reconciler.Terms, reconcile.Terms{Network: strings.TrimSpace(parts[0]), Net: days})
+		}
+	}
+
+	report := reconciler.Reconcile(records, payouts)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NETWORK\tACCOUNT\tMONTH\tREPORTED\tPAID\tVARIANCE\tDUE\tSTATUS")
+	for _, m := range report.Months {
+		status := m.Status
+		for _, v := range report.Variances {
+			if v.Network == m.Network && v.Account == m.Account && v.Currency == m.Currency && v.Month.Equal(m.Month) {
+				status += " (variance)"
+			}
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%.2f %v\t%.2f\t%.2f\t%v\t%v\n", m.Network, m.Account, m.Month.Format("2006-01"),
+			m.Reported, m.Currency, m.Paid, m.Variance(), m.Due.Format("2006-01-02"), status)
+	}
+	w.Flush()
+
+	for _, b := range report.Balances() {
+		fmt.Printf("outstanding: %v %.2f %v (%v)\n", strings.TrimSpace(b.Network+" "+b.Account), b.Reported, b.Currency, b.Status)
+	}
+
+	for _, p := range report.Unmatched {
+		fmt.Printf("unmatched payout: %v %v %.2f %v\n", p.Date.Format("2006-01-02"), p.Network, p.Amount, p.Currency)
+	}
+
+	return nil
+}
+
+func readModels(path string) ([]myrevenue.Model, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	models := make([]myrevenue.Model, 0)
+	decoder := json.NewDecoder(f)
+	for {
+		m := myrevenue.Model{}
+		if err := decoder.Decode(&m); err == io.EOF {
+			return models, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("%v: %v", path, err)
+		}
+		models = append(models, m)
+	}
+}
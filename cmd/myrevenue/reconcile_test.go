@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReconcileShareFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	revenue := write("revenue.jsonl", `{"network_id": "Chartboost", "date_time": "2018-09-01T00:00:00Z", "revenue": 100}`+"\n")
+	payouts := write("payouts.csv", "date,network,amount,currency\n2018-10-30,Chartboost,90,USD\n")
+	share := write("share.json", `{"rules": [{"source": "Chartboost", "reports": "gross", "percentage": 10}]}`)
+	args := []string{"-revenue", revenue, "-payouts", payouts, "-share", share}
+
+	if err := reconcilePayouts(args); err != nil {
+		t.Fatal(err)
+	}
+
+	// Rules here can't rely on records saying what they report
+	write("share.json", `{"rules": [{"source": "Chartboost", "percentage": 10}]}`)
+	if err := reconcilePayouts(args); err == nil || !strings.Contains(err.Error(), "reports is needed") {
+		t.Errorf("reconcilePayouts() error = %v", err)
+	}
+
+	write("share.json", `{"rules": [{"reports": "after"}]}`)
+	if err := reconcilePayouts(args); err == nil {
+		t.Error("expected an error for an invalid share file")
+	}
+}
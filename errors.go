@@ -0,0 +1,23 @@
+package myrevenue
+
+import "fmt"
+
+// ParseError reports a report row that could not be converted to a Model.
+// Row is 1-based and counts from the first line of the report.
+type ParseError struct {
+	Network string
+	Row     int
+	Column  string
+	Err     error
+}
+
+func (e *ParseError) Error() string {
+	if e.Column == "" {
+		return fmt.Sprintf("%v: row %v: %v", e.Network, e.Row, e.Err)
+	}
+	return fmt.Sprintf("%v: row %v, column %q: %v", e.Network, e.Row, e.Column, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,28 @@
+package ingest
+
+import (
+	"encoding/json"
+	"github.com/econnelly/myrevenue"
+	"io"
+	"sync"
+)
+
+// JSONLinesSink writes each model as a line of JSON
+type JSONLinesSink struct {
+	Writer io.Writer
+
+	mu sync.Mutex
+}
+
+func (s *JSONLinesSink) Write(source string, network string, models []myrevenue.Model) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	encoder := json.NewEncoder(s.Writer)
+	for _, m := range models {
+		if err := encoder.Encode(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/econnelly/myrevenue"
+	"github.com/econnelly/myrevenue/adnetwork/detect"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	PROCESSED_DIR = "processed"
+	FAILED_DIR    = "failed"
+
+	DEFAULT_INTERVAL    = 10 * time.Second
+	DEFAULT_SETTLE_TIME = 5 * time.Second
+)
+
+// Sink receives the models parsed from each report file
+type Sink interface {
+	Write(source string, network string, models []myrevenue.Model) error
+}
+
+type SinkFunc func(source string, network string, models []myrevenue.Model) error
+
+func (f SinkFunc) Write(source string, network string, models []myrevenue.Model) error {
+	return f(source, network, models)
+}
+
+// Watcher polls a directory for dropped report files, parses each one with
+// the detected network's parser and hands the result to Sink. Files are then
+// moved to processed/, or to failed/ next to a .error.txt describing why.
+type Watcher struct {
+	Dir        string
+	Sink       Sink
+	Interval   time.Duration   // How often to scan, defaults to DEFAULT_INTERVAL
+	SettleTime time.Duration   // Files modified more recently than this are assumed to still be copying
+	Clock      myrevenue.Clock // Defaults to myrevenue.SystemClock
+	Log        func(format string, args ...interface{})
+}
+
+var extensions = map[string]bool{
+	".csv":  true,
+	".gz":   true,
+	".json": true,
+	".txt":  true,
+	".xlsx": true,
+	".zip":  true,
+}
+
+// Run scans until the context is cancelled
+func (w *Watcher) Run(ctx context.Context) error {
+	interval := w.Interval
+	if interval == 0 {
+		interval = DEFAULT_INTERVAL
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.ScanOnce(); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// ScanOnce ingests every settled report file currently in the directory
+func (w *Watcher) ScanOnce() error {
+	if w.Sink == nil {
+		return fmt.Errorf("ingest: no sink configured")
+	}
+
+	for _, dir := range []string{PROCESSED_DIR, FAILED_DIR} {
+		if err := os.MkdirAll(filepath.Join(w.Dir, dir), 0755); err != nil {
+			return err
+		}
+	}
+
+	entries, err := ioutil.ReadDir(w.Dir)
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ModTime().Before(entries[j].ModTime())
+	})
+
+	settle := w.SettleTime
+	if settle == 0 {
+		settle = DEFAULT_SETTLE_TIME
+	}
+
+	now := w.now()
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || !extensions[strings.ToLower(filepath.Ext(name))] {
+			continue
+		}
+
+		if now.Sub(entry.ModTime()) < settle {
+			continue
+		}
+
+		if err := w.ingest(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ingest only returns errors that stop the watcher, e.g. a file that can't be
+// moved out of the way. Bad reports are moved to failed/.
+func (w *Watcher) ingest(name string) error {
+	path := filepath.Join(w.Dir, name)
+
+	network, err := w.parse(path)
+	if err != nil {
+		w.logf("%v: %v", name, err)
+
+		target, moveErr := w.move(path, FAILED_DIR)
+		if moveErr != nil {
+			return moveErr
+		}
+
+		message := fmt.Sprintf("%v\n%v\n", w.now().Format(time.RFC3339), err)
+		return ioutil.WriteFile(target+".error.txt", []byte(message), 0644)
+	}
+
+	w.logf("%v: ingested %v report", name, network)
+	_, err = w.move(path, PROCESSED_DIR)
+	return err
+}
+
+func (w *Watcher) parse(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	if strings.EqualFold(filepath.Ext(path), ".xlsx") {
+		content, err := XLSXToCSV(file)
+		if err != nil {
+			return "", err
+		}
+		reader = bytes.NewReader(content)
+	}
+
+	models, match, err := detect.ParseAny(reader)
+	if err != nil {
+		return match.Network, err
+	}
+
+	if err := w.Sink.Write(path, match.Network, models); err != nil {
+		return match.Network, fmt.Errorf("sink: %v", err)
+	}
+
+	return match.Network, nil
+}
+
+// move renames the file into dir, adding a timestamp if the name is taken and
+// a counter if that is taken too, e.g. when a report is dropped twice a second
+func (w *Watcher) move(path string, dir string) (string, error) {
+	name := filepath.Base(path)
+	target := filepath.Join(w.Dir, dir, name)
+
+	ext := filepath.Ext(name)
+	stamp := w.now().Format("20060102T150405")
+	for n := 1; exists(target); n++ {
+		suffix := stamp
+		if n > 1 {
+			suffix = fmt.Sprintf("%v-%v", stamp, n)
+		}
+		target = filepath.Join(w.Dir, dir, fmt.Sprintf("%v.%v%v", strings.TrimSuffix(name, ext), suffix, ext))
+	}
+
+	return target, os.Rename(path, target)
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func (w *Watcher) now() time.Time {
+	if w.Clock == nil {
+		return myrevenue.SystemClock.Now()
+	}
+	return w.Clock.Now()
+}
+
+func (w *Watcher) logf(format string, args ...interface{}) {
+	if w.Log != nil {
+		w.Log(format, args...)
+	}
+}
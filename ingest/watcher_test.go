@@ -0,0 +1,176 @@
+package ingest
+
+import (
+	"errors"
+	"github.com/econnelly/myrevenue"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testReport = "Day,Country,Attempts,Impressions,Clicks,CTR,Revenue\n" +
+	"2018-10-01,US,1000,800,8,0.01,1.50\n"
+
+var testNow = time.Date(2018, time.October, 1, 12, 0, 0, 0, time.UTC)
+
+// testWatcher watches a temporary directory with a clock at testNow, where
+// files written by drop settled a minute ago
+type testWatcher struct {
+	Watcher
+	t       *testing.T
+	ingests []string
+}
+
+func newTestWatcher(t *testing.T, sinkErr error) *testWatcher {
+	w := &testWatcher{t: t}
+	w.Watcher = Watcher{
+		Dir: t.TempDir(),
+		Sink: SinkFunc(func(source string, network string, models []myrevenue.Model) error {
+			w.ingests = append(w.ingests, filepath.Base(source)+":"+network)
+			return sinkErr
+		}),
+		SettleTime: 10 * time.Second,
+		Clock:      myrevenue.NewFakeClock(testNow),
+	}
+	return w
+}
+
+func (w *testWatcher) drop(name string, content string, modified time.Time) {
+	path := filepath.Join(w.Dir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		w.t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modified, modified); err != nil {
+		w.t.Fatal(err)
+	}
+}
+
+func (w *testWatcher) files(dir string) []string {
+	entries, err := ioutil.ReadDir(filepath.Join(w.Dir, dir))
+	if err != nil {
+		w.t.Fatal(err)
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if !e.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+	return names
+}
+
+func TestScanOnceMovesProcessedReports(t *testing.T) {
+	w := newTestWatcher(t, nil)
+	w.drop("mopub.csv", testReport, testNow.Add(-time.Minute))
+	w.drop("notes.md", "not a report", testNow.Add(-time.Minute))
+	w.drop(".hidden.csv", testReport, testNow.Add(-time.Minute))
+
+	if err := w.ScanOnce(); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(w.ingests, ",") != "mopub.csv:MoPub" {
+		t.Errorf("ingested %v", w.ingests)
+	}
+	if got := strings.Join(w.files(PROCESSED_DIR), ","); got != "mopub.csv" {
+		t.Errorf("processed/ = %v", got)
+	}
+	if got := strings.Join(w.files(""), ","); got != ".hidden.csv,notes.md" {
+		t.Errorf("left behind %v, want only the files that aren't reports", got)
+	}
+}
+
+func TestScanOnceWaitsForFilesToSettle(t *testing.T) {
+	w := newTestWatcher(t, nil)
+
+	// Still being copied in
+	w.drop("mopub.csv", testReport, testNow.Add(-time.Second))
+
+	if err := w.ScanOnce(); err != nil {
+		t.Fatal(err)
+	}
+	if len(w.ingests) != 0 || len(w.files(PROCESSED_DIR)) != 0 {
+		t.Fatalf("ingested %v before the file settled", w.ingests)
+	}
+
+	w.Clock.(*myrevenue.FakeClock).Advance(10 * time.Second)
+	if err := w.ScanOnce(); err != nil {
+		t.Fatal(err)
+	}
+	if len(w.ingests) != 1 || len(w.files(PROCESSED_DIR)) != 1 {
+		t.Errorf("ingested %v once the file settled", w.ingests)
+	}
+}
+
+func TestScanOnceMovesFailuresWithErrorLog(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		sinkErr error
+		message string
+	}{
+		{"unknown.csv", "foo,bar\n1,2\n", nil, "unrecognised report format"},
+		{"bad_row.csv", testReport + "2018-10-02,US,lots,1,0,0,0\n", nil, "lots"},
+		{"mopub.csv", testReport, errors.New("disk full"), "sink: disk full"},
+	}
+
+	for _, test := range tests {
+		w := newTestWatcher(t, test.sinkErr)
+		w.drop(test.name, test.content, testNow.Add(-time.Minute))
+
+		if err := w.ScanOnce(); err != nil {
+			t.Fatalf("%v: a bad report shouldn't stop the watcher: %v", test.name, err)
+		}
+
+		if got := strings.Join(w.files(FAILED_DIR), ","); got != test.name+","+test.name+".error.txt" {
+			t.Errorf("%v: failed/ = %v", test.name, got)
+			continue
+		}
+		if len(w.files(PROCESSED_DIR)) != 0 || len(w.files("")) != 0 {
+			t.Errorf("%v: should only be in failed/", test.name)
+		}
+
+		errorLog, err := os.ReadFile(filepath.Join(w.Dir, FAILED_DIR, test.name+".error.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(string(errorLog), "\n")
+		if lines[0] != testNow.Format(time.RFC3339) || !strings.Contains(string(errorLog), test.message) {
+			t.Errorf("%v: error log = %q, want the time and %q", test.name, errorLog, test.message)
+		}
+	}
+}
+
+func TestScanOnceRenamesOnCollision(t *testing.T) {
+	w := newTestWatcher(t, nil)
+
+	// The same export dropped three times within a second
+	for i := 0; i < 3; i++ {
+		w.drop("mopub.csv", testReport, testNow.Add(-time.Minute))
+		if err := w.ScanOnce(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := "mopub.20181001T120000-2.csv,mopub.20181001T120000.csv,mopub.csv"
+	if got := strings.Join(w.files(PROCESSED_DIR), ","); got != want {
+		t.Errorf("processed/ = %v, want %v", got, want)
+	}
+
+	// Failures collide the same way, each with its own error log
+	for i := 0; i < 2; i++ {
+		w.drop("broken.csv", "foo,bar\n", testNow.Add(-time.Minute))
+		if err := w.ScanOnce(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want = "broken.20181001T120000.csv,broken.20181001T120000.csv.error.txt,broken.csv,broken.csv.error.txt"
+	if got := strings.Join(w.files(FAILED_DIR), ","); got != want {
+		t.Errorf("failed/ = %v, want %v", got, want)
+	}
+}
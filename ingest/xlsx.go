@@ -0,0 +1,319 @@
+package ingest
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type sharedStrings struct {
+	Items []struct {
+		Text string `xml:"t"`
+		Runs []struct {
+			Text string `xml:"t"`
+		} `xml:"r"`
+	} `xml:"si"`
+}
+
+type workbook struct {
+	Properties struct {
+		Date1904 string `xml:"date1904,attr"`
+	} `xml:"workbookPr"`
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		ID   string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type relationships struct {
+	Items []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type styleSheet struct {
+	NumberFormats []struct {
+		ID   int    `xml:"numFmtId,attr"`
+		Code string `xml:"formatCode,attr"`
+	} `xml:"numFmts>numFmt"`
+	CellFormats []struct {
+		NumberFormatID int `xml:"numFmtId,attr"`
+	} `xml:"cellXfs>xf"`
+}
+
+type worksheet struct {
+	Rows []struct {
+		Cells []struct {
+			Ref    string `xml:"r,attr"`
+			Type   string `xml:"t,attr"`
+			Style  int    `xml:"s,attr"`
+			Value  string `xml:"v"`
+			Inline string `xml:"is>t"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// XLSXToCSV converts the first worksheet of a workbook to CSV so it can go
+// through the same detection and parsing as exported CSV files. Only cell
+// values are read. Dates, which are stored as serial day numbers, are written
+// as 2006-01-02 when the cell has a date format or sits in a Date column.
+func XLSXToCSV(reader io.Reader) ([]byte, error) {
+	content, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]*zip.File, len(archive.File))
+	for _, f := range archive.File {
+		files[f.Name] = f
+	}
+
+	var book workbook
+	if f, found := files["xl/workbook.xml"]; found {
+		if err := decodeXML(f, &book); err != nil {
+			return nil, err
+		}
+	}
+
+	sheetPath, err := firstSheet(files, book)
+	if err != nil {
+		return nil, err
+	}
+
+	var sheet worksheet
+	if err := decodeXML(files[sheetPath], &sheet); err != nil {
+		return nil, err
+	}
+
+	var strs sharedStrings
+	if f, found := files["xl/sharedStrings.xml"]; found {
+		if err := decodeXML(f, &strs); err != nil {
+			return nil, err
+		}
+	}
+
+	var styles styleSheet
+	if f, found := files["xl/styles.xml"]; found {
+		if err := decodeXML(f, &styles); err != nil {
+			return nil, err
+		}
+	}
+
+	shared := make([]string, len(strs.Items))
+	for i, item := range strs.Items {
+		text := item.Text
+		for _, r := range item.Runs {
+			text += r.Text
+		}
+		shared[i] = text
+	}
+
+	dateStyles := styles.dateStyles()
+	epoch := time.Date(1899, time.December, 30, 0, 0, 0, 0, time.UTC)
+	if book.Properties.Date1904 == "1" || book.Properties.Date1904 == "true" {
+		epoch = time.Date(1904, time.January, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	// Columns headed "Date" or "Day" hold dates even without a date format
+	dateColumns := make(map[int]bool)
+	headerFound := false
+
+	var out bytes.Buffer
+	writer := csv.NewWriter(&out)
+	for _, row := range sheet.Rows {
+		record := make([]string, 0, len(row.Cells))
+		hasText := false
+		for _, cell := range row.Cells {
+			// Empty cells are omitted from the XML, so place by reference
+			col := columnIndex(cell.Ref)
+			if col >= len(record) {
+				record = append(record, make([]string, col-len(record))...)
+			} else {
+				col = len(record)
+			}
+
+			value := cell.Value
+			switch cell.Type {
+			case "s":
+				index, err := strconv.Atoi(value)
+				if err != nil || index >= len(shared) {
+					return nil, errors.New("xlsx: bad shared string reference")
+				}
+				value = shared[index]
+				hasText = true
+			case "inlineStr":
+				value = cell.Inline
+				hasText = true
+			case "str":
+				hasText = true
+			case "", "n":
+				if dateStyles[cell.Style] || dateColumns[col] {
+					if date, ok := serialDate(value, epoch); ok {
+						value = date
+					}
+				}
+			}
+			record = append(record, value)
+		}
+
+		// Exports may put a title above the header, so the header is the
+		// first text row naming a date column
+		if !headerFound && hasText {
+			for i, value := range record {
+				name := strings.ToLower(strings.TrimSpace(value))
+				if name == "date" || name == "day" {
+					dateColumns[i] = true
+					headerFound = true
+				}
+			}
+		}
+
+		if err := writer.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	writer.Flush()
+
+	return out.Bytes(), writer.Error()
+}
+
+// firstSheet finds the worksheet listed first in the workbook through the
+// workbook's relationships, falling back to the conventional name
+func firstSheet(files map[string]*zip.File, book workbook) (string, error) {
+	if len(book.Sheets) > 0 {
+		if f, found := files["xl/_rels/workbook.xml.rels"]; found {
+			var rels relationships
+			if err := decodeXML(f, &rels); err != nil {
+				return "", err
+			}
+
+			for _, rel := range rels.Items {
+				if rel.ID != book.Sheets[0].ID {
+					continue
+				}
+
+				target := path.Join("xl", rel.Target)
+				if strings.HasPrefix(rel.Target, "/") {
+					target = strings.TrimPrefix(rel.Target, "/")
+				}
+				if _, found := files[target]; found {
+					return target, nil
+				}
+				return "", errors.New("xlsx: missing worksheet " + target)
+			}
+		}
+	}
+
+	if _, found := files["xl/worksheets/sheet1.xml"]; found {
+		return "xl/worksheets/sheet1.xml", nil
+	}
+
+	return "", errors.New("xlsx: no worksheet found")
+}
+
+// dateStyles lists the cell format indexes that display a date
+func (s styleSheet) dateStyles() map[int]bool {
+	custom := make(map[int]string, len(s.NumberFormats))
+	for _, f := range s.NumberFormats {
+		custom[f.ID] = f.Code
+	}
+
+	styles := make(map[int]bool)
+	for i, xf := range s.CellFormats {
+		if code, found := custom[xf.NumberFormatID]; found {
+			styles[i] = isDateFormat(code)
+		} else {
+			styles[i] = isBuiltInDateFormat(xf.NumberFormatID)
+		}
+	}
+	return styles
+}
+
+// isBuiltInDateFormat covers the date formats predefined by ECMA-376,
+// including the locale specific ones
+func isBuiltInDateFormat(id int) bool {
+	return (id >= 14 && id <= 17) || id == 22 || (id >= 27 && id <= 36) || (id >= 50 && id <= 58)
+}
+
+// isDateFormat looks for day, month or year codes outside of quoted text and
+// bracketed colors or locales
+func isDateFormat(code string) bool {
+	quoted := false
+	bracketed := false
+	for i := 0; i < len(code); i++ {
+		c := code[i]
+		switch {
+		case c == '\\':
+			i++
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '[':
+			bracketed = true
+		case c == ']':
+			bracketed = false
+		case bracketed:
+		case c == 'd' || c == 'D' || c == 'y' || c == 'Y':
+			return true
+		case c == 'm' || c == 'M':
+			// Without a day or year, m is minutes in a time format
+			return strings.ContainsAny(strings.ToLower(code), "dy")
+		}
+	}
+	return false
+}
+
+// serialDate converts a spreadsheet day number to a date, keeping the time
+// when there is one
+func serialDate(value string, epoch time.Time) (string, bool) {
+	serial, err := strconv.ParseFloat(value, 64)
+	if err != nil || serial < 1 || serial > 2958465 {
+		return "", false
+	}
+
+	days := math.Floor(serial)
+	seconds := math.Round((serial - days) * 86400)
+	t := epoch.AddDate(0, 0, int(days)).Add(time.Duration(seconds) * time.Second)
+
+	if seconds == 0 {
+		return t.Format("2006-01-02"), true
+	}
+	return t.Format("2006-01-02 15:04:05"), true
+}
+
+func decodeXML(f *zip.File, v interface{}) error {
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	return xml.NewDecoder(r).Decode(v)
+}
+
+// columnIndex converts a cell reference like "AB12" to a 0-based column
+func columnIndex(ref string) int {
+	index := 0
+	for _, c := range strings.ToUpper(ref) {
+		if c < 'A' || c > 'Z' {
+			break
+		}
+		index = index*26 + int(c-'A'+1)
+	}
+	return index - 1
+}
@@ -0,0 +1,107 @@
+package ingest
+
+import (
+	"github.com/econnelly/myrevenue"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testdata/amazon_report.xlsx follows Excel's layout: the report is the first
+// tab but stored as sheet2.xml, dates use the built-in short date format, a
+// custom yyyy-mm-dd format, and no format at all under the Date header
+func TestXLSXToCSV(t *testing.T) {
+	f, err := os.Open("testdata/amazon_report.xlsx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	content, err := XLSXToCSV(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := strings.Join([]string{
+		"Amazon Publisher Report",
+		"Date,App,Requests,Impressions,Clicks,Ad Earnings (USD),eCPM (USD)",
+		"2018-10-01,Example App,2000,1500,15,3,2",
+		"2018-10-02,Example App,1000,500,,1.25,2.5",
+		"2018-10-03,Example App,100,50,1,0.1,2",
+		"Total,,3100,2050,16,4.35,2.12",
+	}, "\n") + "\n"
+
+	if string(content) != want {
+		t.Errorf("XLSXToCSV() =\n%v\nwant\n%v", string(content), want)
+	}
+}
+
+func TestIsDateFormat(t *testing.T) {
+	tests := map[string]bool{
+		"yyyy\\-mm\\-dd;@":    true,
+		"[$-409]d-mmm-yy;@":   true,
+		"m/d/yyyy h:mm":       true,
+		"h:mm:ss":             false,
+		"[mm]:ss":             false,
+		"\"$\"#,##0.00":       false,
+		"#,##0\" days\"":      false,
+		"[Red]#,##0.00;(0.0)": false,
+	}
+
+	for code, want := range tests {
+		if got := isDateFormat(code); got != want {
+			t.Errorf("isDateFormat(%q) = %v, want %v", code, got, want)
+		}
+	}
+}
+
+func TestScanOnceIngestsXLSX(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ingest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	content, err := ioutil.ReadFile("testdata/amazon_report.xlsx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "october.xlsx"), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var network string
+	var models []myrevenue.Model
+	w := Watcher{
+		Dir: dir,
+		Sink: SinkFunc(func(source string, n string, m []myrevenue.Model) error {
+			network = n
+			models = append(models, m...)
+			return nil
+		}),
+		SettleTime: time.Nanosecond,
+		Clock:      myrevenue.NewFakeClock(time.Now().Add(time.Hour)),
+	}
+
+	if err := w.ScanOnce(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, PROCESSED_DIR, "october.xlsx")); err != nil {
+		errorLog, _ := ioutil.ReadFile(filepath.Join(dir, FAILED_DIR, "october.xlsx.error.txt"))
+		t.Fatalf("workbook wasn't processed: %v", string(errorLog))
+	}
+
+	if network != "Amazon" || len(models) != 3 {
+		t.Fatalf("got %v models from %q, want 3 from Amazon", len(models), network)
+	}
+
+	for i, day := range []string{"2018-10-01", "2018-10-02", "2018-10-03"} {
+		if got := models[i].DateTime.Format("2006-01-02"); got != day {
+			t.Errorf("model %v date = %v, want %v", i, got, day)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package reconcile
+
+import (
+	"encoding/csv"
+	"github.com/econnelly/myrevenue"
+	"github.com/pkg/errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Payout is a payment received from a network
+type Payout struct {
+	Date     time.Time `json:"date"`
+	Network  string    `json:"network"`
+	Account  string    `json:"account,omitempty"`
+	Amount   float64   `json:"amount"`
+	Currency string    `json:"currency"`
+
+	// Period is the first day of the month the payment covers. When the
+	// payout file doesn't say, the payment settles the oldest open month.
+	Period time.Time `json:"period,omitempty"`
+}
+
+// ParsePayouts reads a CSV with a header row of date, network, amount and
+// currency. Optional account and period (2006-01) columns tie a payment to an
+// account or month. Column names are case insensitive.
+func ParsePayouts(reader io.Reader) ([]Payout, error) {
+	r := csv.NewReader(reader)
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(records) == 0 {
+		return nil, errors.New("payouts: empty file")
+	}
+
+	h := make(map[string]int)
+	for i, column := range records[0] {
+		h[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\xef\xbb\xbf")))] = i
+	}
+
+	for _, column := range []string{"date", "network", "amount", "currency"} {
+		if _, found := h[column]; !found {
+			return nil, errors.Errorf("payouts: missing %v column", column)
+		}
+	}
+
+	payouts := make([]Payout, 0, len(records)-1)
+	for i, record := range records[1:] {
+		row := i + 2
+		field := func(column string) string {
+			index, found := h[column]
+			if !found || index >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[index])
+		}
+		parseError := func(column string, err error) error {
+			return &myrevenue.ParseError{Network: "payouts", Row: row, Column: column, Err: err}
+		}
+
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+
+		date, err := time.ParseInLocation("2006-01-02", field("date"), time.UTC)
+		if err != nil {
+			return nil, parseError("date", err)
+		}
+
+		amount, err := strconv.ParseFloat(strings.Replace(field("amount"), ",", "", -1), 64)
+		if err != nil {
+			return nil, parseError("amount", err)
+		}
+
+		payout := Payout{
+			Date:     date,
+			Network:  field("network"),
+			Account:  field("account"),
+			Amount:   amount,
+			Currency: strings.ToUpper(field("currency")),
+		}
+
+		if period := field("period"); period != "" {
+			if payout.Period, err = time.ParseInLocation("2006-01", period, time.UTC); err != nil {
+				return nil, parseError("period", err)
+			}
+		}
+
+		payouts = append(payouts, payout)
+	}
+
+	return payouts, nil
+}
@@ -0,0 +1,286 @@
+// Package reconcile checks the revenue networks reported against what they
+// actually paid, month by month.
+package reconcile
+
+import (
+	"github.com/econnelly/myrevenue"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// DEFAULT_TERMS is the payment term, in days after the end of the month,
+// for networks without configured terms
+const DEFAULT_TERMS = 30
+
+// Month states
+const (
+	PAID      = "paid"
+	UNPAID    = "unpaid"    // Not yet due
+	UNDERPAID = "underpaid" // Paid short by more than the threshold, not yet due
+	OVERDUE   = "overdue"   // Due date passed without a payment, or with a short one
+)
+
+// Terms sets when a network pays, Net days after the end of each month.
+// Account may be left empty to cover every account. Network names here and
+// in payouts are matched ignoring case, spaces and punctuation, so "AdMob",
+// "Admob" and "admob" are the same network.
+type Terms struct {
+	Network string `json:"network"`
+	Account string `json:"account,omitempty"`
+	Net     int    `json:"net"`
+}
+
+// Reconciler matches payouts against reported revenue. A paid month is a
+// variance when the difference exceeds both Threshold and ThresholdPercent
+// of the reported revenue.
+type Reconciler struct {
+	Terms            []Terms         `json:"terms"`
+	Threshold        float64         `json:"threshold"`
+	ThresholdPercent float64         `json:"threshold_percent"`
+	Clock            myrevenue.Clock `json:"-"`
+}
+
+// Month is one network account's revenue for a calendar month in one
+// currency, with the payment made for it
+type Month struct {
+	Network  string    `json:"network"`
+	Account  string    `json:"account,omitempty"`
+	Currency string    `json:"currency"`
+	Month    time.Time `json:"month"`
+	Reported float64   `json:"reported"`
+	Paid     float64   `json:"paid"`
+	Payouts  []Payout  `json:"payouts,omitempty"`
+	Due      time.Time `json:"due"`
+	Status   string    `json:"status"`
+}
+
+// Variance is what was paid over (positive) or under (negative) what was
+// reported
+func (m Month) Variance() float64 {
+	return m.Paid - m.Reported
+}
+
+// Balance is what is still owed for the month
+func (m Month) Balance() float64 {
+	if m.Status == PAID {
+		return 0
+	}
+	return m.Reported - m.Paid
+}
+
+type Report struct {
+	Months    []Month  `json:"months"`
+	Variances []Month  `json:"variances"` // Paid months off by more than the threshold
+	Unpaid    []Month  `json:"unpaid"`    // Unpaid, underpaid and overdue months
+	Unmatched []Payout `json:"unmatched"` // Payouts with no reported month to settle, or no account for a network with several
+}
+
+// Balances sums what is owed for the unpaid months per network, account and
+// currency, in Reported
+func (r Report) Balances() []Month {
+	type key struct {
+		network  string
+		account  string
+		currency string
+	}
+
+	index := make(map[key]int)
+	balances := make([]Month, 0)
+	for _, m := range r.Unpaid {
+		k := key{m.Network, m.Account, m.Currency}
+		i, found := index[k]
+		if !found {
+			balances = append(balances, Month{Network: m.Network, Account: m.Account, Currency: m.Currency, Status: m.Status})
+			i = len(balances) - 1
+			index[k] = i
+		}
+
+		balances[i].Reported += m.Balance()
+		if m.Status == OVERDUE {
+			balances[i].Status = OVERDUE
+		}
+	}
+	return balances
+}
+
+// ReconcileModels reconciles the revenue reported by Fetch
+func (r Reconciler) ReconcileModels(models []myrevenue.Model, payouts []Payout) Report {
+	return r.Reconcile(myrevenue.RecordsFromModels(models), payouts)
+}
+
+// Reconcile sums net revenue per network, account, currency and month, then
+// settles each month with its payouts. Payouts naming a period settle that
+// month. The rest settle, in date order, the oldest open month that ended
+// before the payment. Payouts without an account are only matched for
+// networks with a single account, since they could pay for any of them.
+func (r Reconciler) Reconcile(records []myrevenue.Record, payouts []Payout) Report {
+	clock := r.Clock
+	if clock == nil {
+		clock = myrevenue.SystemClock
+	}
+	now := clock.Now()
+
+	type key struct {
+		network  string
+		account  string
+		currency string
+		month    time.Time
+	}
+
+	index := make(map[key]int)
+	months := make([]Month, 0)
+	for _, record := range records {
+		currency := record.Currency
+		if currency == "" {
+			currency = "USD"
+		}
+
+		month := time.Date(record.Date.Year(), record.Date.Month(), 1, 0, 0, 0, 0, time.UTC)
+		k := key{record.Source, record.Account, currency, month}
+		i, found := index[k]
+		if !found {
+			months = append(months, Month{
+				Network:  record.Source,
+				Account:  record.Account,
+				Currency: currency,
+				Month:    month,
+				Due:      month.AddDate(0, 1, r.terms(record.Source, record.Account)),
+			})
+			i = len(months) - 1
+			index[k] = i
+		}
+		months[i].Reported += record.NetRevenue
+	}
+
+	sort.SliceStable(months, func(i, j int) bool {
+		return months[i].Month.Before(months[j].Month)
+	})
+
+	sorted := make([]Payout, len(payouts))
+	copy(sorted, payouts)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Date.Before(sorted[j].Date)
+	})
+
+	report := Report{Unmatched: make([]Payout, 0)}
+	for _, payout := range sorted {
+		i := r.settles(months, payout)
+		if i < 0 {
+			report.Unmatched = append(report.Unmatched, payout)
+			continue
+		}
+		months[i].Paid += payout.Amount
+		months[i].Payouts = append(months[i].Payouts, payout)
+		months[i].Status = PAID
+	}
+
+	report.Variances = make([]Month, 0)
+	report.Unpaid = make([]Month, 0)
+	for i := range months {
+		m := &months[i]
+		if m.Status == PAID {
+			if !r.exceedsThreshold(*m) {
+				continue
+			}
+			report.Variances = append(report.Variances, *m)
+
+			// Overpaid months are settled, short ones are still owed the rest
+			if m.Variance() > 0 {
+				continue
+			}
+			m.Status = UNDERPAID
+		} else {
+			m.Status = UNPAID
+		}
+
+		if now.After(m.Due) {
+			m.Status = OVERDUE
+		}
+		report.Unpaid = append(report.Unpaid, *m)
+	}
+
+	report.Months = months
+	return report
+}
+
+// settles picks the month a payout pays for
+func (r Reconciler) settles(months []Month, payout Payout) int {
+	if payout.Account == "" && accounts(months, payout.Network) > 1 {
+		return -1
+	}
+
+	for i, m := range months {
+		if !sameNetwork(m.Network, payout.Network) || m.Currency != payout.Currency {
+			continue
+		}
+		if payout.Account != "" && m.Account != payout.Account {
+			continue
+		}
+
+		if !payout.Period.IsZero() {
+			if m.Month.Equal(payout.Period) {
+				return i
+			}
+			continue
+		}
+
+		// Months are sorted, so the first open one is the oldest
+		if m.Status != PAID && !m.Month.AddDate(0, 1, 0).After(payout.Date) {
+			return i
+		}
+	}
+	return -1
+}
+
+// accounts counts the accounts months are reported under for a network
+func accounts(months []Month, network string) int {
+	seen := make(map[string]bool)
+	for _, m := range months {
+		if sameNetwork(m.Network, network) {
+			seen[m.Account] = true
+		}
+	}
+	return len(seen)
+}
+
+func (r Reconciler) terms(network string, account string) int {
+	days := DEFAULT_TERMS
+	for _, t := range r.Terms {
+		if !sameNetwork(t.Network, network) {
+			continue
+		}
+		if t.Account == account {
+			return t.Net
+		}
+		if t.Account == "" {
+			days = t.Net
+		}
+	}
+	return days
+}
+
+// sameNetwork compares network names the way people write them, since
+// payout files and terms are typed by hand while models use adapter names
+func sameNetwork(a string, b string) bool {
+	return normalize(a) == normalize(b)
+}
+
+func normalize(network string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, network)
+}
+
+func (r Reconciler) exceedsThreshold(m Month) bool {
+	variance := math.Abs(m.Variance())
+	if variance <= r.Threshold {
+		return false
+	}
+	return variance > math.Abs(m.Reported)*r.ThresholdPercent/100
+}
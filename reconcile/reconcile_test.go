@@ -0,0 +1,280 @@
+package reconcile
+
+import (
+	"github.com/econnelly/myrevenue"
+	"strings"
+	"testing"
+	"time"
+)
+
+func month(year int, m time.Month) time.Time {
+	return time.Date(year, m, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func record(network string, account string, day time.Time, net float64) myrevenue.Record {
+	return myrevenue.Record{Source: network, Account: account, Date: day, GrossRevenue: net, NetRevenue: net, Currency: "USD"}
+}
+
+func payout(network string, day time.Time, amount float64) Payout {
+	return Payout{Date: day, Network: network, Amount: amount, Currency: "USD"}
+}
+
+func newReconciler(now time.Time) Reconciler {
+	return Reconciler{Threshold: 1, ThresholdPercent: 1, Clock: myrevenue.NewFakeClock(now)}
+}
+
+func TestReconcileOldestOpenMonth(t *testing.T) {
+	records := []myrevenue.Record{
+		record("Admob", "", time.Date(2018, time.August, 3, 0, 0, 0, 0, time.UTC), 40),
+		record("Admob", "", time.Date(2018, time.July, 10, 0, 0, 0, 0, time.UTC), 60),
+		record("Admob", "", time.Date(2018, time.July, 20, 0, 0, 0, 0, time.UTC), 40),
+		record("Admob", "", time.Date(2018, time.September, 1, 0, 0, 0, 0, time.UTC), 10),
+	}
+
+	// Listed out of order; the later payment settles August, and nothing has
+	// ended for a payment made during July
+	payouts := []Payout{
+		payout("admob", time.Date(2018, time.September, 21, 0, 0, 0, 0, time.UTC), 40),
+		payout("ADMOB", time.Date(2018, time.August, 21, 0, 0, 0, 0, time.UTC), 100),
+		payout("Admob", time.Date(2018, time.July, 15, 0, 0, 0, 0, time.UTC), 5),
+	}
+
+	report := newReconciler(time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC)).Reconcile(records, payouts)
+
+	if len(report.Months) != 3 {
+		t.Fatalf("got %v months, want 3", len(report.Months))
+	}
+
+	july, august, september := report.Months[0], report.Months[1], report.Months[2]
+	if !july.Month.Equal(month(2018, time.July)) || july.Reported != 100 || july.Paid != 100 || july.Status != PAID {
+		t.Errorf("July = %+v", july)
+	}
+	if august.Paid != 40 || august.Status != PAID {
+		t.Errorf("August = %+v", august)
+	}
+	if september.Status != UNPAID || september.Balance() != 10 {
+		t.Errorf("September = %+v", september)
+	}
+
+	if len(report.Unmatched) != 1 || report.Unmatched[0].Amount != 5 {
+		t.Errorf("Unmatched = %+v", report.Unmatched)
+	}
+	if len(report.Variances) != 0 {
+		t.Errorf("Variances = %+v", report.Variances)
+	}
+}
+
+func TestReconcilePeriod(t *testing.T) {
+	records := []myrevenue.Record{
+		record("Unity Ads", "", time.Date(2018, time.July, 10, 0, 0, 0, 0, time.UTC), 50),
+		record("Unity Ads", "", time.Date(2018, time.August, 10, 0, 0, 0, 0, time.UTC), 80),
+	}
+
+	// A late payment for August, with July still open
+	late := payout("unityads", time.Date(2018, time.October, 2, 0, 0, 0, 0, time.UTC), 80)
+	late.Period = month(2018, time.August)
+
+	report := newReconciler(time.Date(2018, time.October, 3, 0, 0, 0, 0, time.UTC)).Reconcile(records, []Payout{late})
+
+	july, august := report.Months[0], report.Months[1]
+	if august.Status != PAID || august.Paid != 80 {
+		t.Errorf("August = %+v", august)
+	}
+	if july.Status != OVERDUE || july.Paid != 0 {
+		t.Errorf("July = %+v", july)
+	}
+
+	// A period with no reported revenue can't be settled
+	late.Period = month(2018, time.June)
+	if report := newReconciler(time.Now()).Reconcile(records, []Payout{late}); len(report.Unmatched) != 1 {
+		t.Errorf("Unmatched = %+v", report.Unmatched)
+	}
+}
+
+func TestReconcileOverdue(t *testing.T) {
+	records := []myrevenue.Record{
+		record("Admob", "", time.Date(2018, time.July, 10, 0, 0, 0, 0, time.UTC), 50),
+		record("Unity Ads", "", time.Date(2018, time.July, 10, 0, 0, 0, 0, time.UTC), 70),
+	}
+
+	reconciler := newReconciler(time.Date(2018, time.September, 15, 0, 0, 0, 0, time.UTC))
+	reconciler.Terms = []Terms{{Network: "unity ads", Net: 60}}
+
+	report := reconciler.Reconcile(records, nil)
+
+	// Net-30 from the end of July is August 31, net-60 is September 30
+	tests := []struct {
+		network string
+		due     string
+		status  string
+	}{
+		{"Admob", "2018-08-31", OVERDUE},
+		{"Unity Ads", "2018-09-30", UNPAID},
+	}
+
+	for i, test := range tests {
+		m := report.Months[i]
+		if m.Network != test.network || m.Due.Format("2006-01-02") != test.due || m.Status != test.status {
+			t.Errorf("month %v = %v due %v %v, want %v due %v %v", i, m.Network, m.Due.Format("2006-01-02"), m.Status, test.network, test.due, test.status)
+		}
+	}
+
+	balances := report.Balances()
+	if len(balances) != 2 || balances[0].Status != OVERDUE || balances[1].Reported != 70 {
+		t.Errorf("Balances() = %+v", balances)
+	}
+}
+
+func TestReconcileThreshold(t *testing.T) {
+	tests := []struct {
+		paid     float64
+		variance bool
+	}{
+		{1000, false},
+		{999.5, false}, // Under both thresholds
+		{995, false},   // Over the amount, under the percentage
+		{985, true},    // Over both
+		{1015, true},   // Overpaid
+	}
+
+	for _, test := range tests {
+		records := []myrevenue.Record{record("Admob", "", time.Date(2018, time.July, 10, 0, 0, 0, 0, time.UTC), 1000)}
+		payouts := []Payout{payout("Admob", time.Date(2018, time.August, 21, 0, 0, 0, 0, time.UTC), test.paid)}
+
+		report := newReconciler(time.Date(2018, time.September, 1, 0, 0, 0, 0, time.UTC)).Reconcile(records, payouts)
+		if variance := len(report.Variances) == 1; variance != test.variance {
+			t.Errorf("paid %v: variance = %v, want %v", test.paid, variance, test.variance)
+		}
+	}
+}
+
+func TestReconcileAccounts(t *testing.T) {
+	models := []myrevenue.Model{
+		{NetworkName: "Admob", Account: "studio", DateTime: time.Date(2018, time.July, 10, 0, 0, 0, 0, time.UTC), Revenue: 30},
+		{NetworkName: "Admob", Account: "publishing", DateTime: time.Date(2018, time.July, 10, 0, 0, 0, 0, time.UTC), Revenue: 20},
+	}
+
+	paid := payout("Admob", time.Date(2018, time.August, 21, 0, 0, 0, 0, time.UTC), 20)
+	paid.Account = "publishing"
+
+	reconciler := newReconciler(time.Date(2018, time.September, 15, 0, 0, 0, 0, time.UTC))
+	reconciler.Terms = []Terms{{Network: "admob", Account: "studio", Net: 60}}
+
+	report := reconciler.ReconcileModels(models, []Payout{paid})
+
+	for _, m := range report.Months {
+		switch m.Account {
+		case "studio":
+			if m.Status != UNPAID || m.Due.Format("2006-01-02") != "2018-09-30" {
+				t.Errorf("studio = %+v", m)
+			}
+		case "publishing":
+			if m.Status != PAID || m.Paid != 20 {
+				t.Errorf("publishing = %+v", m)
+			}
+		default:
+			t.Errorf("unexpected month %+v", m)
+		}
+	}
+}
+
+func TestParsePayouts(t *testing.T) {
+	payouts, err := ParsePayouts(strings.NewReader("\xef\xbb\xbfDate,Network,Account,Amount,Currency,Period\n2018-08-21,Admob,studio,\"1,234.50\",usd,2018-07\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(payouts) != 1 {
+		t.Fatalf("got %v payouts, want 1", len(payouts))
+	}
+
+	p := payouts[0]
+	if p.Network != "Admob" || p.Account != "studio" || p.Amount != 1234.5 || p.Currency != "USD" || !p.Period.Equal(month(2018, time.July)) {
+		t.Errorf("payout = %+v", p)
+	}
+}
+
+func TestReconcileUnderpaid(t *testing.T) {
+	records := []myrevenue.Record{
+		record("Admob", "", time.Date(2018, time.July, 10, 0, 0, 0, 0, time.UTC), 100),
+		record("Admob", "", time.Date(2018, time.August, 10, 0, 0, 0, 0, time.UTC), 50),
+	}
+
+	// July is paid short, August in full
+	payouts := []Payout{
+		payout("Admob", time.Date(2018, time.August, 21, 0, 0, 0, 0, time.UTC), 60),
+		payout("Admob", time.Date(2018, time.September, 21, 0, 0, 0, 0, time.UTC), 50),
+	}
+
+	tests := []struct {
+		now    time.Time
+		status string
+	}{
+		{time.Date(2018, time.August, 25, 0, 0, 0, 0, time.UTC), UNDERPAID},
+		{time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC), OVERDUE},
+	}
+
+	for _, test := range tests {
+		report := newReconciler(test.now).Reconcile(records, payouts)
+
+		july := report.Months[0]
+		if july.Status != test.status || july.Paid != 60 || july.Balance() != 40 {
+			t.Errorf("%v: July = %+v, balance %v", test.now.Format("2006-01-02"), july, july.Balance())
+		}
+		if len(report.Variances) != 1 || len(report.Unpaid) != 1 || report.Unpaid[0].Status != test.status {
+			t.Errorf("%v: Variances, Unpaid = %+v, %+v", test.now.Format("2006-01-02"), report.Variances, report.Unpaid)
+		}
+
+		balances := report.Balances()
+		if len(balances) != 1 || balances[0].Reported != 40 || balances[0].Status != test.status {
+			t.Errorf("%v: Balances() = %+v", test.now.Format("2006-01-02"), balances)
+		}
+	}
+
+	// Within the threshold the month counts as paid
+	payouts[0].Amount = 99.5
+	report := newReconciler(time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC)).Reconcile(records, payouts)
+	if report.Months[0].Status != PAID || report.Months[0].Balance() != 0 || len(report.Unpaid) != 0 {
+		t.Errorf("July = %+v", report.Months[0])
+	}
+
+	// Overpaying is a variance, but nothing is owed
+	payouts[0].Amount = 120
+	report = newReconciler(time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC)).Reconcile(records, payouts)
+	if report.Months[0].Status != PAID || len(report.Variances) != 1 || len(report.Unpaid) != 0 {
+		t.Errorf("July = %+v", report.Months[0])
+	}
+}
+
+func TestReconcileAmbiguousAccount(t *testing.T) {
+	records := []myrevenue.Record{
+		record("Admob", "studio", time.Date(2018, time.July, 10, 0, 0, 0, 0, time.UTC), 30),
+		record("Admob", "publishing", time.Date(2018, time.June, 10, 0, 0, 0, 0, time.UTC), 20),
+		record("Unity Ads", "games", time.Date(2018, time.July, 10, 0, 0, 0, 0, time.UTC), 70),
+	}
+
+	// Without an account the Admob payout could be for either
+	withPeriod := payout("Admob", time.Date(2018, time.August, 21, 0, 0, 0, 0, time.UTC), 30)
+	withPeriod.Period = month(2018, time.July)
+	payouts := []Payout{
+		payout("Admob", time.Date(2018, time.August, 21, 0, 0, 0, 0, time.UTC), 20),
+		withPeriod,
+		payout("Unity Ads", time.Date(2018, time.August, 21, 0, 0, 0, 0, time.UTC), 70),
+	}
+
+	report := newReconciler(time.Date(2018, time.August, 25, 0, 0, 0, 0, time.UTC)).Reconcile(records, payouts)
+
+	if len(report.Unmatched) != 2 || report.Unmatched[0].Network != "Admob" || report.Unmatched[1].Network != "Admob" {
+		t.Errorf("Unmatched = %+v", report.Unmatched)
+	}
+
+	for _, m := range report.Months {
+		if m.Network == "Admob" && m.Paid != 0 {
+			t.Errorf("%v settled by an ambiguous payout: %+v", m.Account, m)
+		}
+		// A network's only account takes payouts without one
+		if m.Network == "Unity Ads" && m.Status != PAID {
+			t.Errorf("Unity Ads = %+v", m)
+		}
+	}
+}
@@ -22,6 +22,29 @@ type Model struct {
 	CTR         float64   `json:"ctr"`
 	Revenue     float64   `json:"revenue"`
 	ECPM        float64   `json:"ecpm"`
+	Currency    string    `json:"currency,omitempty"` // ISO 4217, empty when the network only reports USD
+	AdUnit      string    `json:"ad_unit,omitempty"`
+	Format      string    `json:"format,omitempty"`
+	Platform    string    `json:"platform,omitempty"`
+
+	// Account tells apart several accounts with the same network. Adapters
+	// leave it empty; callers set it when they fetch more than one.
+	Account string `json:"account,omitempty"`
+
+	// AdSource and AdSourceInstance identify the network that filled a
+	// mediated impression, when the report comes from a mediation platform
+	AdSource         string `json:"ad_source,omitempty"`
+	AdSourceInstance string `json:"ad_source_instance,omitempty"`
+
+	// ExtendedMetrics holds network-specific metrics that have no common field
+	ExtendedMetrics map[string]float64 `json:"extended_metrics,omitempty"`
+}
+
+func (m *Model) SetExtendedMetric(name string, value float64) {
+	if m.ExtendedMetrics == nil {
+		m.ExtendedMetrics = make(map[string]float64)
+	}
+	m.ExtendedMetrics[name] = value
 }
 
 func GetRequest(reportURL string, headers map[string]string, debug bool) (*http.Response, error) {
@@ -81,6 +104,12 @@ func newClient() *http.Client {
 }
 
 func DateRangeFromHistory(history string, tz string) (time.Time, time.Time, error) {
+	return DateRangeFromHistoryAt(history, tz, SystemClock)
+}
+
+// DateRangeFromHistoryAt resolves a history keyword against the given clock
+// instead of the wall clock
+func DateRangeFromHistoryAt(history string, tz string, clock Clock) (time.Time, time.Time, error) {
 	var startDate time.Time
 	var endDate time.Time
 
@@ -89,30 +118,32 @@ func DateRangeFromHistory(history string, tz string) (time.Time, time.Time, erro
 		log.Fatalln(e)
 	}
 
+	now := clock.Now().In(loc)
+
 	switch history {
 	case "yesterday":
-		tempDate := time.Now().In(loc).AddDate(0, 0, -1)
+		tempDate := now.AddDate(0, 0, -1)
 		startDate = time.Date(tempDate.Year(), tempDate.Month(), tempDate.Day(), 0, 0, 0, 0, loc)
 		endDate = time.Date(tempDate.Year(), tempDate.Month(), tempDate.Day(), 23, 59, 59, 999999999, loc)
 	case "today":
-		tempDate := time.Now().In(loc)
+		tempDate := now
 		startDate = time.Date(tempDate.Year(), tempDate.Month(), tempDate.Day(), 0, 0, 0, 0, loc)
 		endDate = time.Date(tempDate.Year(), tempDate.Month(), tempDate.Day(), 23, 59, 59, 999999999, loc)
 	case "week":
-		tempDate := time.Now().In(loc).AddDate(0, 0, -7)
+		tempDate := now.AddDate(0, 0, -7)
 		startDate = time.Date(tempDate.Year(), tempDate.Month(), tempDate.Day(), 0, 0, 0, 0, loc)
 
-		tempDate = time.Now().In(loc).AddDate(0, 0, -1)
+		tempDate = now.AddDate(0, 0, -1)
 		endDate = time.Date(tempDate.Year(), tempDate.Month(), tempDate.Day(), 23, 59, 59, 999999999, loc)
 	case "month-to-date":
-		tempDate := time.Now().In(loc).AddDate(0, 0, -1)
+		tempDate := now.AddDate(0, 0, -1)
 		startDate = time.Date(tempDate.Year(), tempDate.Month(), 1, 0, 0, 0, 0, loc)
 		endDate = time.Date(tempDate.Year(), tempDate.Month(), tempDate.Day(), 23, 59, 59, 999999999, loc)
 	case "last-month":
-		tempDate := time.Date(time.Now().In(loc).Year(), time.Now().In(loc).Month(), 1, 0, 0, 0, 0, loc)
+		tempDate := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc)
 		startDate = tempDate.AddDate(0, -1, 0)
 
-		tempDate = time.Date(time.Now().In(loc).Year(), time.Now().In(loc).Month(), 1, 23, 59, 59, 999999999, loc)
+		tempDate = time.Date(now.Year(), now.Month(), 1, 23, 59, 59, 999999999, loc)
 		endDate = tempDate.AddDate(0, 0, -1)
 	default:
 		tempDate, err := time.ParseInLocation("2006-01-02", history, loc)
@@ -122,10 +153,10 @@ func DateRangeFromHistory(history string, tz string) (time.Time, time.Time, erro
 		} else {
 			days, err := strconv.ParseInt(history, 10, 32)
 			if err != nil {
-				return time.Now().UTC(), time.Now().UTC(), err
+				return now.UTC(), now.UTC(), err
 			}
 
-			tempDate := time.Now().In(loc).AddDate(0, 0, int(days*-1))
+			tempDate := now.AddDate(0, 0, int(days*-1))
 			startDate = time.Date(tempDate.Year(), tempDate.Month(), tempDate.Day(), 0, 0, 0, 0, loc)
 			endDate = time.Date(tempDate.Year(), tempDate.Month(), tempDate.Day(), 23, 59, 59, 9999, loc)
 		}
@@ -0,0 +1,89 @@
+package myrevenue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDateRangeFromHistoryAtMonthBoundaries(t *testing.T) {
+	utc := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 12, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name    string
+		history string
+		now     time.Time
+		start   string
+		end     string
+	}{
+		{"yesterday on the first", "yesterday", utc(2018, time.March, 1), "2018-02-28", "2018-02-28"},
+		{"yesterday on the first of a leap march", "yesterday", utc(2020, time.March, 1), "2020-02-29", "2020-02-29"},
+		{"yesterday on new year's day", "yesterday", utc(2019, time.January, 1), "2018-12-31", "2018-12-31"},
+		{"week spanning two months", "week", utc(2018, time.March, 3), "2018-02-24", "2018-03-02"},
+		{"month-to-date on the first is last month", "month-to-date", utc(2018, time.March, 1), "2018-02-01", "2018-02-28"},
+		{"month-to-date mid month", "month-to-date", utc(2018, time.March, 15), "2018-03-01", "2018-03-14"},
+		{"last-month in january", "last-month", utc(2018, time.January, 15), "2017-12-01", "2017-12-31"},
+		{"last-month after a 31 day month", "last-month", utc(2018, time.May, 31), "2018-04-01", "2018-04-30"},
+		{"days ago across a month", "3", utc(2018, time.March, 2), "2018-02-27", "2018-02-27"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			start, end, err := DateRangeFromHistoryAt(test.history, "UTC", NewFakeClock(test.now))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := start.Format("2006-01-02"); got != test.start {
+				t.Errorf("start = %v, want %v", got, test.start)
+			}
+			if got := end.Format("2006-01-02"); got != test.end {
+				t.Errorf("end = %v, want %v", got, test.end)
+			}
+		})
+	}
+}
+
+func TestDateRangeFromHistoryAtUsesTimezone(t *testing.T) {
+	// Early on the 1st in UTC is still the last day of February in Los Angeles
+	clock := NewFakeClock(time.Date(2018, time.March, 1, 5, 0, 0, 0, time.UTC))
+
+	start, _, err := DateRangeFromHistoryAt("yesterday", "America/Los_Angeles", clock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := start.Format("2006-01-02"); got != "2018-02-27" {
+		t.Errorf("start = %v, want 2018-02-27", got)
+	}
+}
+
+func TestAsOf(t *testing.T) {
+	clock, err := AsOf("2018-03-01", "America/Los_Angeles")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start, end, err := DateRangeFromHistoryAt("last-month", "America/Los_Angeles", clock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if start.Format("2006-01-02") != "2018-02-01" || end.Format("2006-01-02") != "2018-02-28" {
+		t.Errorf("last-month as of 2018-03-01 = %v to %v", start, end)
+	}
+
+	if _, err := AsOf("2018-02-30", "UTC"); err == nil {
+		t.Error("expected an error for an invalid date")
+	}
+}
+
+func TestFakeClockAdvance(t *testing.T) {
+	clock := NewFakeClock(time.Date(2018, time.January, 31, 23, 0, 0, 0, time.UTC))
+	clock.Advance(2 * time.Hour)
+
+	if got := clock.Now(); got.Month() != time.February || got.Day() != 1 {
+		t.Errorf("Now() = %v, want February 1st", got)
+	}
+}
@@ -0,0 +1,131 @@
+package myrevenue
+
+import (
+	"sort"
+	"time"
+)
+
+// Stream is the kind of revenue a Record comes from
+type Stream string
+
+const (
+	ADS          Stream = "ads"
+	PURCHASE     Stream = "purchase" // Paid apps and one-time in-app purchases
+	SUBSCRIPTION Stream = "subscription"
+	REFUND       Stream = "refund"
+)
+
+// Record is the common shape of revenue from every stream, so ad networks and
+// app stores can be totalled together. Gross is what the source reports
+// before its own share and tax, net is what is paid out.
+type Record struct {
+	Source  string    `json:"source"`
+	Stream  Stream    `json:"stream"`
+	App     string    `json:"app"`
+	Country string    `json:"country"` // 2-letter country code
+	Date    time.Time `json:"date"`
+	Account string    `json:"account,omitempty"`
+
+	GrossRevenue float64 `json:"gross_revenue"`
+	NetRevenue   float64 `json:"net_revenue"`
+	Currency     string  `json:"currency"` // ISO 4217
+
+	// Reported is GROSS, NET or BOTH when the source says which figures are
+	// real. Empty leaves it to the matching ShareRule.
+	Reported string `json:"reported,omitempty"`
+}
+
+// Record is the model as ad revenue. Both gross and net start out as the
+// reported revenue and Reported is left empty, since only a RevenueShare rule
+// knows which of the two the network reports.
+func (m Model) Record() Record {
+	currency := m.Currency
+	if currency == "" {
+		currency = "USD"
+	}
+
+	return Record{
+		Source:       m.NetworkName,
+		Stream:       ADS,
+		App:          m.App,
+		Country:      m.Country,
+		Date:         time.Date(m.DateTime.Year(), m.DateTime.Month(), m.DateTime.Day(), 0, 0, 0, 0, m.DateTime.Location()),
+		Account:      m.Account,
+		GrossRevenue: m.Revenue,
+		NetRevenue:   m.Revenue,
+		Currency:     currency,
+	}
+}
+
+func RecordsFromModels(models []Model) []Record {
+	records := make([]Record, len(models))
+	for i, m := range models {
+		records[i] = m.Record()
+	}
+	return records
+}
+
+// Dimensions records can be aggregated by
+const (
+	BY_SOURCE  = "source"
+	BY_ACCOUNT = "account"
+	BY_STREAM  = "stream"
+	BY_APP     = "app"
+	BY_COUNTRY = "country"
+	BY_DATE    = "date"
+	BY_MONTH   = "month"
+)
+
+// Aggregate sums gross and net revenue over records that share the given dimensions.
+// Dimensions not asked for are left empty in the result, except currency,
+// which is always kept apart since amounts in different currencies can't be
+// added. With no dimensions it gives total revenue per currency.
+func Aggregate(records []Record, by ...string) []Record {
+	group := make(map[string]bool, len(by))
+	for _, dimension := range by {
+		group[dimension] = true
+	}
+
+	index := make(map[Record]int)
+	totals := make([]Record, 0)
+
+	for _, r := range records {
+		key := Record{Currency: r.Currency}
+		if group[BY_SOURCE] {
+			key.Source = r.Source
+		}
+		if group[BY_ACCOUNT] {
+			key.Account = r.Account
+		}
+		if group[BY_STREAM] {
+			key.Stream = r.Stream
+		}
+		if group[BY_APP] {
+			key.App = r.App
+		}
+		if group[BY_COUNTRY] {
+			key.Country = r.Country
+		}
+		if group[BY_DATE] {
+			key.Date = time.Date(r.Date.Year(), r.Date.Month(), r.Date.Day(), 0, 0, 0, 0, time.UTC)
+		} else if group[BY_MONTH] {
+			key.Date = time.Date(r.Date.Year(), r.Date.Month(), 1, 0, 0, 0, 0, time.UTC)
+		}
+
+		i, found := index[key]
+		if !found {
+			totals = append(totals, key)
+			i = len(totals) - 1
+			index[key] = i
+		}
+
+		totals[i].GrossRevenue += r.GrossRevenue
+		totals[i].NetRevenue += r.NetRevenue
+	}
+
+	sort.SliceStable(totals, func(i, j int) bool {
+		return totals[i].Date.Before(totals[j].Date)
+	})
+
+	return totals
+}
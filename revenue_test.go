@@ -0,0 +1,102 @@
+package myrevenue
+
+import (
+	"testing"
+	"time"
+)
+
+func aggregateRecords() []Record {
+	return []Record{
+		{Source: "Admob", Stream: ADS, App: "game", Date: day(2018, time.July, 10), GrossRevenue: 10, NetRevenue: 10, Currency: "USD"},
+		{Source: "Admob", Stream: ADS, App: "puzzle", Date: day(2018, time.July, 31), GrossRevenue: 5, NetRevenue: 5, Currency: "USD"},
+		{Source: "Google Play", Stream: PURCHASE, App: "game", Date: day(2018, time.August, 1), GrossRevenue: 20, NetRevenue: 17, Currency: "USD"},
+		{Source: "Google Play", Stream: REFUND, App: "game", Date: day(2018, time.August, 2), GrossRevenue: -4, NetRevenue: -3.4, Currency: "USD"},
+		{Source: "App Store", Stream: PURCHASE, App: "game", Date: day(2018, time.July, 15), GrossRevenue: 10, NetRevenue: 7, Currency: "EUR"},
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	type total struct {
+		source   string
+		app      string
+		month    string
+		currency string
+		gross    float64
+		net      float64
+	}
+
+	tests := []struct {
+		name string
+		by   []string
+		want []total
+	}{
+		// Amounts in different currencies are never added together
+		{"no dimensions", nil, []total{
+			{"", "", "", "USD", 31, 28.6},
+			{"", "", "", "EUR", 10, 7},
+		}},
+		{"by app", []string{BY_APP}, []total{
+			{"", "game", "", "USD", 26, 23.6},
+			{"", "puzzle", "", "USD", 5, 5},
+			{"", "game", "", "EUR", 10, 7},
+		}},
+		{"by source", []string{BY_SOURCE}, []total{
+			{"Admob", "", "", "USD", 15, 15},
+			{"Google Play", "", "", "USD", 16, 13.6},
+			{"App Store", "", "", "EUR", 10, 7},
+		}},
+		// Months come out in order
+		{"by month", []string{BY_MONTH}, []total{
+			{"", "", "2018-07-01", "USD", 15, 15},
+			{"", "", "2018-07-01", "EUR", 10, 7},
+			{"", "", "2018-08-01", "USD", 16, 13.6},
+		}},
+		{"by app and month", []string{BY_APP, BY_MONTH}, []total{
+			{"", "game", "2018-07-01", "USD", 10, 10},
+			{"", "puzzle", "2018-07-01", "USD", 5, 5},
+			{"", "game", "2018-07-01", "EUR", 10, 7},
+			{"", "game", "2018-08-01", "USD", 16, 13.6},
+		}},
+	}
+
+	for _, test := range tests {
+		totals := Aggregate(aggregateRecords(), test.by...)
+		if len(totals) != len(test.want) {
+			t.Errorf("%v: got %v totals, want %v: %+v", test.name, len(totals), len(test.want), totals)
+			continue
+		}
+
+		for i, want := range test.want {
+			r := totals[i]
+			month := ""
+			if !r.Date.IsZero() {
+				month = r.Date.Format("2006-01-02")
+			}
+
+			if r.Source != want.source || r.App != want.app || month != want.month || r.Currency != want.currency {
+				t.Errorf("%v: total %v = %v/%v/%v/%v, want %v/%v/%v/%v", test.name, i, r.Source, r.App, month, r.Currency, want.source, want.app, want.month, want.currency)
+			}
+			if !closeTo(r.GrossRevenue, want.gross) || !closeTo(r.NetRevenue, want.net) {
+				t.Errorf("%v: total %v gross, net = %v, %v, want %v, %v", test.name, i, r.GrossRevenue, r.NetRevenue, want.gross, want.net)
+			}
+			if r.Stream != "" || r.Country != "" || r.Account != "" {
+				t.Errorf("%v: total %v has dimensions that weren't asked for: %+v", test.name, i, r)
+			}
+		}
+	}
+}
+
+func TestAggregateByDateWinsOverMonth(t *testing.T) {
+	totals := Aggregate(aggregateRecords(), BY_MONTH, BY_DATE, BY_STREAM)
+	if len(totals) != 5 {
+		t.Fatalf("got %v totals, want one per record", len(totals))
+	}
+	if totals[0].Date.Format("2006-01-02") != "2018-07-10" || totals[0].Stream != ADS {
+		t.Errorf("first total = %+v", totals[0])
+	}
+}
+
+func closeTo(a, b float64) bool {
+	d := a - b
+	return d < 1e-9 && d > -1e-9
+}
@@ -0,0 +1,287 @@
+package myrevenue
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"sort"
+	"time"
+)
+
+// What a source's reported revenue figure is. BOTH is for sources that
+// report their share alongside, so neither figure needs deriving.
+const (
+	GROSS = "gross"
+	NET   = "net"
+	BOTH  = "both"
+)
+
+// ShareRule describes the cut a source takes. Source, Account and Stream
+// narrow which records the rule applies to, empty matches anything. From and
+// Until (2006-01-02, Until exclusive) limit the dates it is in effect.
+type ShareRule struct {
+	Source  string `json:"source,omitempty"`
+	Account string `json:"account,omitempty"`
+	Stream  Stream `json:"stream,omitempty"`
+	From    string `json:"from,omitempty"`
+	Until   string `json:"until,omitempty"`
+
+	// Reports is GROSS when the source reports revenue before its share and
+	// NET when after. The other figure is derived from it. Records that say
+	// what they report themselves, like app store transactions, ignore it, so
+	// it may be left empty for rules that only match those.
+	Reports string `json:"reports,omitempty"`
+
+	// Percentage is the source's share, 30 for 30%. Tiers replace it when set.
+	Percentage float64     `json:"percentage,omitempty"`
+	Tiers      []ShareTier `json:"tiers,omitempty"`
+
+	// Tax is withheld from what is left after the share, as a percentage
+	Tax float64 `json:"tax,omitempty"`
+
+	from  time.Time
+	until time.Time
+}
+
+// ShareTier applies Percentage to gross revenue earned in a calendar year up
+// to UpTo. The last tier should leave UpTo at 0 to cover everything above.
+type ShareTier struct {
+	UpTo       float64 `json:"up_to,omitempty"`
+	Percentage float64 `json:"percentage"`
+}
+
+// RevenueShare is an ordered list of rules. The first rule matching a record
+// is used, so list specific rules before general ones.
+type RevenueShare struct {
+	Rules []ShareRule `json:"rules"`
+}
+
+// LoadRevenueShare reads rules from a JSON file of the form
+// {"rules": [{"source": "App Store", "reports": "net", "percentage": 30}]}
+func LoadRevenueShare(path string) (RevenueShare, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return RevenueShare{}, err
+	}
+
+	share := RevenueShare{}
+	if err := json.Unmarshal(content, &share); err != nil {
+		return RevenueShare{}, errors.Wrap(err, path)
+	}
+
+	if err := share.Validate(); err != nil {
+		return RevenueShare{}, errors.Wrap(err, path)
+	}
+
+	return share, nil
+}
+
+// Validate checks every rule and parses its dates. Apply calls it, but
+// calling it up front reports configuration errors before any fetching.
+func (s *RevenueShare) Validate() error {
+	for i := range s.Rules {
+		rule := &s.Rules[i]
+
+		if rule.Reports != "" && rule.Reports != GROSS && rule.Reports != NET {
+			return errors.Errorf("rule %v: reports must be %q or %q", i+1, GROSS, NET)
+		}
+
+		var err error
+		if rule.from, err = parseRuleDate(rule.From); err != nil {
+			return errors.Wrapf(err, "rule %v: from", i+1)
+		}
+		if rule.until, err = parseRuleDate(rule.Until); err != nil {
+			return errors.Wrapf(err, "rule %v: until", i+1)
+		}
+
+		for j, tier := range rule.Tiers {
+			if tier.UpTo == 0 && j != len(rule.Tiers)-1 {
+				return errors.Errorf("rule %v: only the last tier may be unbounded", i+1)
+			}
+			if j > 0 && tier.UpTo != 0 && tier.UpTo <= rule.Tiers[j-1].UpTo {
+				return errors.Errorf("rule %v: tiers must be in increasing order", i+1)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Apply fills in the figure a source doesn't report from the first matching
+// rule. A record's Reported says which figure is real, falling back to the
+// rule's Reports; records reporting BOTH, or with no rule, are returned
+// unchanged. Tiers are filled in date order, per rule, source, account and
+// currency, and start over each calendar year.
+func (s *RevenueShare) Apply(records []Record) ([]Record, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+
+	type key struct {
+		rule     int
+		source   string
+		account  string
+		currency string
+		year     int
+	}
+
+	order := make([]int, len(records))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return records[order[i]].Date.Before(records[order[j]].Date)
+	})
+
+	earned := make(map[key]float64)
+	result := make([]Record, len(records))
+	copy(result, records)
+
+	for _, i := range order {
+		r := &result[i]
+
+		ruleIndex := s.match(*r)
+		if ruleIndex < 0 {
+			continue
+		}
+		rule := s.Rules[ruleIndex]
+
+		reports := r.Reported
+		if reports == "" {
+			reports = rule.Reports
+		}
+
+		k := key{ruleIndex, r.Source, r.Account, r.Currency, r.Date.Year()}
+		switch reports {
+		case GROSS:
+			r.NetRevenue = rule.net(earned[k], r.GrossRevenue)
+		case NET:
+			r.GrossRevenue = rule.gross(earned[k], r.NetRevenue)
+		case BOTH:
+		default:
+			return nil, errors.Errorf("rule %v: reports is needed for %v records, which don't say what they report", ruleIndex+1, r.Source)
+		}
+		earned[k] += r.GrossRevenue
+	}
+
+	return result, nil
+}
+
+// Aggregate applies the rules and then aggregates, so totals always use the
+// same gross and net figures
+func (s *RevenueShare) Aggregate(records []Record, by ...string) ([]Record, error) {
+	applied, err := s.Apply(records)
+	if err != nil {
+		return nil, err
+	}
+	return Aggregate(applied, by...), nil
+}
+
+func (s RevenueShare) match(r Record) int {
+	for i, rule := range s.Rules {
+		if rule.Source != "" && rule.Source != r.Source {
+			continue
+		}
+		if rule.Account != "" && rule.Account != r.Account {
+			continue
+		}
+		if rule.Stream != "" && rule.Stream != r.Stream {
+			continue
+		}
+		if !rule.from.IsZero() && r.Date.Before(rule.from) {
+			continue
+		}
+		if !rule.until.IsZero() && !r.Date.Before(rule.until) {
+			continue
+		}
+		return i
+	}
+	return -1
+}
+
+// bands are the share percentages and how much gross revenue each covers,
+// given what has been earned so far this year. The last band is unbounded.
+func (rule ShareRule) bands(earned float64) []ShareTier {
+	if len(rule.Tiers) == 0 {
+		return []ShareTier{{Percentage: rule.Percentage}}
+	}
+
+	bands := make([]ShareTier, 0, len(rule.Tiers))
+	for _, tier := range rule.Tiers {
+		if tier.UpTo == 0 {
+			bands = append(bands, ShareTier{Percentage: tier.Percentage})
+			return bands
+		}
+		if tier.UpTo > earned {
+			bands = append(bands, ShareTier{UpTo: tier.UpTo - earned, Percentage: tier.Percentage})
+			earned = tier.UpTo
+		}
+	}
+
+	// Past the last bounded tier, its rate carries on
+	last := rule.Tiers[len(rule.Tiers)-1]
+	return append(bands, ShareTier{Percentage: last.Percentage})
+}
+
+// keep is the fraction of gross revenue left at a share percentage
+func (rule ShareRule) keep(percentage float64) float64 {
+	return (1 - percentage/100) * (1 - rule.Tax/100)
+}
+
+func (rule ShareRule) net(earned float64, gross float64) float64 {
+	// Refunds give back at the rate of the band they came out of
+	if gross < 0 {
+		bands := rule.bands(earned + gross)
+		return gross * rule.keep(bands[0].Percentage)
+	}
+
+	net := 0.0
+	for _, band := range rule.bands(earned) {
+		amount := gross
+		if band.UpTo != 0 && amount > band.UpTo {
+			amount = band.UpTo
+		}
+		net += amount * rule.keep(band.Percentage)
+		gross -= amount
+		if gross <= 0 {
+			break
+		}
+	}
+	return net
+}
+
+func (rule ShareRule) gross(earned float64, net float64) float64 {
+	if net < 0 {
+		bands := rule.bands(earned)
+		if keep := rule.keep(bands[0].Percentage); keep > 0 {
+			return net / keep
+		}
+		return net
+	}
+
+	gross := 0.0
+	for _, band := range rule.bands(earned) {
+		keep := rule.keep(band.Percentage)
+		if keep <= 0 {
+			continue
+		}
+
+		amount := net / keep
+		if band.UpTo != 0 && amount > band.UpTo {
+			amount = band.UpTo
+		}
+		gross += amount
+		net -= amount * keep
+		if net <= 0 {
+			break
+		}
+	}
+	return gross
+}
+
+func parseRuleDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.ParseInLocation("2006-01-02", value, time.UTC)
+}
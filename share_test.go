@@ -0,0 +1,183 @@
+package myrevenue
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func day(year int, month time.Month, d int) time.Time {
+	return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+}
+
+func applyShare(t *testing.T, share RevenueShare, records []Record) []Record {
+	applied, err := share.Apply(records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return applied
+}
+
+func TestApplyTiers(t *testing.T) {
+	share := RevenueShare{Rules: []ShareRule{{
+		Reports: GROSS,
+		Tiers:   []ShareTier{{UpTo: 100, Percentage: 15}, {Percentage: 30}},
+	}}}
+
+	// Out of order on purpose, tiers are filled by date
+	records := []Record{
+		{Source: "Network", Date: day(2018, time.March, 1), GrossRevenue: 80, NetRevenue: 80, Currency: "USD"},
+		{Source: "Network", Date: day(2018, time.January, 1), GrossRevenue: 50, NetRevenue: 50, Currency: "USD"},
+		{Source: "Network", Date: day(2018, time.April, 1), GrossRevenue: -20, NetRevenue: -20, Currency: "USD"},
+		{Source: "Network", Date: day(2018, time.May, 1), GrossRevenue: -40, NetRevenue: -40, Currency: "USD"},
+		{Source: "Network", Date: day(2019, time.January, 1), GrossRevenue: 50, NetRevenue: 50, Currency: "USD"},
+		{Source: "Network", Date: day(2018, time.June, 1), GrossRevenue: 50, NetRevenue: 50, Currency: "EUR"},
+	}
+
+	// 50 at 15%; then 50 at 15% and 30 at 30%; the first refund comes out
+	// of the 30% band and the second out of the 15% band; a new year and
+	// another currency start over
+	want := []float64{63.5, 42.5, -14, -34, 42.5, 42.5}
+
+	for i, r := range applyShare(t, share, records) {
+		if math.Abs(r.NetRevenue-want[i]) > 1e-9 {
+			t.Errorf("record %v: net = %v, want %v", i, r.NetRevenue, want[i])
+		}
+		if r.GrossRevenue != records[i].GrossRevenue {
+			t.Errorf("record %v: gross = %v, want it unchanged", i, r.GrossRevenue)
+		}
+	}
+}
+
+func TestApplyNetToGross(t *testing.T) {
+	share := RevenueShare{Rules: []ShareRule{
+		{Source: "Google Play", Reports: NET, Percentage: 30, Until: "2021-07-01"},
+		{Source: "Google Play", Reports: NET, Percentage: 15},
+		{Source: "Ads", Reports: GROSS, Percentage: 30, Tax: 10},
+	}}
+
+	records := []Record{
+		{Source: "Google Play", Date: day(2021, time.June, 30), GrossRevenue: 70, NetRevenue: 70},
+		{Source: "Google Play", Date: day(2021, time.July, 1), GrossRevenue: 85, NetRevenue: 85},
+		{Source: "Ads", Date: day(2021, time.July, 1), GrossRevenue: 100, NetRevenue: 100},
+		{Source: "Other", Date: day(2021, time.July, 1), GrossRevenue: 5, NetRevenue: 5},
+	}
+
+	want := []struct {
+		gross float64
+		net   float64
+	}{
+		{100, 70}, // Before the rate change
+		{100, 85}, // After it
+		{100, 63}, // 30% share, then 10% tax on what's left
+		{5, 5},    // No rule
+	}
+
+	for i, r := range applyShare(t, share, records) {
+		if math.Abs(r.GrossRevenue-want[i].gross) > 1e-9 || math.Abs(r.NetRevenue-want[i].net) > 1e-9 {
+			t.Errorf("record %v: gross, net = %v, %v, want %v, %v", i, r.GrossRevenue, r.NetRevenue, want[i].gross, want[i].net)
+		}
+	}
+}
+
+func TestApplyKeepsKnownFigures(t *testing.T) {
+	share := RevenueShare{Rules: []ShareRule{{
+		Reports: GROSS,
+		Tiers:   []ShareTier{{UpTo: 100, Percentage: 15}, {Percentage: 30}},
+	}}}
+
+	// The first record has real fees, but still counts towards the tier
+	records := []Record{
+		{Source: "Google Play", Date: day(2018, time.January, 1), GrossRevenue: 100, NetRevenue: 70, Reported: BOTH},
+		{Source: "Google Play", Date: day(2018, time.January, 2), GrossRevenue: 10, NetRevenue: 10},
+	}
+
+	applied := applyShare(t, share, records)
+	if applied[0] != records[0] {
+		t.Errorf("record with both figures = %+v, want it unchanged", applied[0])
+	}
+	if applied[1].NetRevenue != 7 {
+		t.Errorf("net = %v, want 7 at the second tier", applied[1].NetRevenue)
+	}
+}
+
+func TestApplyAccounts(t *testing.T) {
+	share := RevenueShare{Rules: []ShareRule{
+		{Source: "Network", Account: "studio", Reports: GROSS, Percentage: 20},
+		{Source: "Network", Reports: GROSS, Percentage: 30},
+	}}
+
+	models := []Model{
+		{NetworkName: "Network", Account: "studio", DateTime: day(2018, time.January, 1), Revenue: 100},
+		{NetworkName: "Network", Account: "publishing", DateTime: day(2018, time.January, 1), Revenue: 100},
+	}
+
+	records := RecordsFromModels(models)
+	if records[0].Account != "studio" {
+		t.Fatalf("Account = %q, want it copied from the model", records[0].Account)
+	}
+
+	totals, err := share.Aggregate(records, BY_ACCOUNT)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(totals) != 2 || totals[0].NetRevenue != 80 || totals[1].NetRevenue != 70 {
+		t.Errorf("totals = %+v", totals)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []ShareRule{
+		{Reports: "after"},
+		{Reports: NET, From: "01/01/2018"},
+		{Reports: NET, Tiers: []ShareTier{{Percentage: 15}, {UpTo: 100, Percentage: 30}}},
+		{Reports: NET, Tiers: []ShareTier{{UpTo: 100, Percentage: 15}, {UpTo: 50, Percentage: 30}}},
+	}
+
+	for i, rule := range tests {
+		share := RevenueShare{Rules: []ShareRule{rule}}
+		if err := share.Validate(); err == nil {
+			t.Errorf("rule %v: expected an error", i)
+		}
+	}
+}
+
+func TestApplyRecordReported(t *testing.T) {
+	// Store rules leave reports to the records
+	share := RevenueShare{Rules: []ShareRule{{Source: "Store", Percentage: 15}}}
+
+	records := []Record{
+		{Source: "Store", Date: day(2021, time.July, 1), GrossRevenue: 10, NetRevenue: 10, Reported: GROSS},
+		{Source: "Store", Date: day(2021, time.July, 1), GrossRevenue: 8.5, NetRevenue: 8.5, Reported: NET},
+		// Gross and net happen to be equal, but both are real
+		{Source: "Store", Date: day(2021, time.July, 1), GrossRevenue: 0, NetRevenue: 0, Reported: BOTH},
+	}
+
+	applied := applyShare(t, share, records)
+	want := []struct{ gross, net float64 }{{10, 8.5}, {10, 8.5}, {0, 0}}
+	for i, r := range applied {
+		if math.Abs(r.GrossRevenue-want[i].gross) > 1e-9 || math.Abs(r.NetRevenue-want[i].net) > 1e-9 {
+			t.Errorf("record %v: gross, net = %v, %v, want %v, %v", i, r.GrossRevenue, r.NetRevenue, want[i].gross, want[i].net)
+		}
+	}
+
+	// A record's own Reported wins over the rule's
+	share.Rules[0].Reports = NET
+	if applied := applyShare(t, share, records[:1]); math.Abs(applied[0].NetRevenue-8.5) > 1e-9 {
+		t.Errorf("net = %v, want the record's gross figure used", applied[0].NetRevenue)
+	}
+}
+
+func TestApplyNeedsReports(t *testing.T) {
+	share := RevenueShare{Rules: []ShareRule{{Percentage: 15}}}
+	if err := share.Validate(); err != nil {
+		t.Fatalf("reports may be left to the records: %v", err)
+	}
+
+	// Ad revenue doesn't say what it is
+	records := RecordsFromModels([]Model{{NetworkName: "Network", DateTime: day(2018, time.January, 1), Revenue: 100}})
+	if _, err := share.Apply(records); err == nil {
+		t.Error("expected an error for a record the rule can't tell gross or net")
+	}
+}
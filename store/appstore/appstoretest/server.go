@@ -0,0 +1,211 @@
+// Package appstoretest provides a local stand-in for the App Store Connect
+// reports API, so the appstore requester can be exercised without network
+// access or a real API key.
+package appstoretest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	KEY_ID    = "TESTKEY123"
+	ISSUER_ID = "57246542-96fe-1a63-e053-0824d011072a"
+	VENDOR    = "80012345"
+)
+
+// Server serves the salesReports and financeReports endpoints. Reports are
+// keyed by report date (2006-01-02 for sales, 2006-01 for financial) and
+// served gzipped. Dates without a report get a 404, as the real API does.
+type Server struct {
+	*httptest.Server
+
+	Sales     map[string]string
+	Financial map[string]string
+
+	// PrivateKey is the PEM encoded .p8 key the server accepts tokens from
+	PrivateKey string
+
+	key *ecdsa.PrivateKey
+
+	mu        sync.Mutex
+	calls     int
+	tokens    map[string]bool
+	lastQuery map[string][]string
+}
+
+func NewServer(sales map[string]string, financial map[string]string) *Server {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		panic(err)
+	}
+
+	s := &Server{
+		Sales:      sales,
+		Financial:  financial,
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		key:        key,
+		tokens:     make(map[string]bool),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/salesReports", func(w http.ResponseWriter, r *http.Request) {
+		s.report(w, r, s.Sales)
+	})
+	mux.HandleFunc("/v1/financeReports", func(w http.ResponseWriter, r *http.Request) {
+		s.report(w, r, s.Financial)
+	})
+	s.Server = httptest.NewServer(mux)
+
+	return s
+}
+
+func (s *Server) report(w http.ResponseWriter, r *http.Request, reports map[string]string) {
+	s.mu.Lock()
+	s.calls++
+	s.lastQuery = r.URL.Query()
+	s.mu.Unlock()
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if err := s.verify(token); err != nil {
+		writeError(w, http.StatusUnauthorized, "NOT_AUTHORIZED", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	s.tokens[token] = true
+	s.mu.Unlock()
+
+	if r.URL.Query().Get("filter[vendorNumber]") != VENDOR {
+		writeError(w, http.StatusForbidden, "FORBIDDEN_ERROR", "unknown vendor number")
+		return
+	}
+
+	report, found := reports[r.URL.Query().Get("filter[reportDate]")]
+	if !found {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "There were no sales for the date specified.")
+		return
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(report))
+	gz.Close()
+
+	w.Header().Set("Content-Type", "application/a-gzip")
+	w.Write(buf.Bytes())
+}
+
+// verify checks the ES256 signature and the claims App Store Connect requires
+func (s *Server) verify(token string) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("malformed token")
+	}
+
+	header := struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}{}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return err
+	}
+
+	if header.Alg != "ES256" || header.Kid != KEY_ID {
+		return fmt.Errorf("unexpected token header %+v", header)
+	}
+
+	claims := struct {
+		Iss string `json:"iss"`
+		Iat int64  `json:"iat"`
+		Exp int64  `json:"exp"`
+		Aud string `json:"aud"`
+	}{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return err
+	}
+
+	if claims.Iss != ISSUER_ID || claims.Aud != "appstoreconnect-v1" {
+		return fmt.Errorf("unexpected token claims %+v", claims)
+	}
+
+	if claims.Exp <= claims.Iat || time.Duration(claims.Exp-claims.Iat)*time.Second > 20*time.Minute {
+		return fmt.Errorf("token lifetime must be at most 20 minutes")
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || len(signature) != 64 {
+		return fmt.Errorf("malformed signature")
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	r := new(big.Int).SetBytes(signature[:32])
+	sig := new(big.Int).SetBytes(signature[32:])
+	if !ecdsa.Verify(&s.key.PublicKey, digest[:], r, sig) {
+		return fmt.Errorf("invalid signature")
+	}
+
+	return nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func writeError(w http.ResponseWriter, status int, code string, detail string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"errors": []map[string]string{{
+			"status": fmt.Sprint(status),
+			"code":   code,
+			"title":  http.StatusText(status),
+			"detail": detail,
+		}},
+	})
+}
+
+// Calls is how many report requests were made
+func (s *Server) Calls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+// Tokens is how many distinct valid tokens were presented
+func (s *Server) Tokens() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.tokens)
+}
+
+// LastQuery is the query string of the most recent report request
+func (s *Server) LastQuery() map[string][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastQuery
+}
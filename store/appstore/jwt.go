@@ -0,0 +1,85 @@
+package appstore
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"github.com/pkg/errors"
+	"time"
+)
+
+const AUDIENCE = "appstoreconnect-v1"
+
+// TOKEN_LIFETIME is the longest App Store Connect accepts
+const TOKEN_LIFETIME = 20 * time.Minute
+
+// ParsePrivateKey reads the .p8 key downloaded from App Store Connect
+func ParsePrivateKey(p8 []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(p8)
+	if block == nil {
+		return nil, errors.New("App Store: private key is not PEM encoded")
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "App Store: invalid private key")
+	}
+
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("App Store: private key is not an ECDSA key")
+	}
+
+	// ES256 signatures only fit P-256 keys
+	if ecKey.Curve != elliptic.P256() {
+		return nil, errors.Errorf("App Store: private key uses %v, not P-256", ecKey.Curve.Params().Name)
+	}
+
+	return ecKey, nil
+}
+
+// SignToken creates an ES256 JWT for the App Store Connect API
+func SignToken(key *ecdsa.PrivateKey, keyID string, issuerID string, issuedAt time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{
+		"alg": "ES256",
+		"kid": keyID,
+		"typ": "JWT",
+	})
+	if err != nil {
+		return "", err
+	}
+
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss": issuerID,
+		"iat": issuedAt.Unix(),
+		"exp": issuedAt.Add(TOKEN_LIFETIME).Unix(),
+		"aud": AUDIENCE,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := encodeSegment(header) + "." + encodeSegment(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	// JWS wants the raw 64 byte r || s rather than ASN.1
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+
+	return unsigned + "." + encodeSegment(signature), nil
+}
+
+func encodeSegment(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,47 @@
+package appstore
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+)
+
+func encodeKey(t *testing.T, curve elliptic.Curve) []byte {
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func TestParsePrivateKey(t *testing.T) {
+	key, err := ParsePrivateKey(encodeKey(t, elliptic.P256()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := SignToken(key, "KEY", "ISSUER", time.Now()); err != nil {
+		t.Error(err)
+	}
+
+	// These would overflow the 64 byte ES256 signature
+	for _, curve := range []elliptic.Curve{elliptic.P384(), elliptic.P521()} {
+		if _, err := ParsePrivateKey(encodeKey(t, curve)); err == nil {
+			t.Errorf("ParsePrivateKey() accepted a %v key", curve.Params().Name)
+		}
+	}
+
+	if _, err := ParsePrivateKey([]byte("not a key")); err == nil {
+		t.Error("ParsePrivateKey() accepted a key that isn't PEM encoded")
+	}
+}
@@ -0,0 +1,266 @@
+package appstore
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"github.com/econnelly/myrevenue"
+	"github.com/econnelly/myrevenue/adnetwork"
+	"github.com/econnelly/myrevenue/store"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const NAME = "App Store"
+
+// ReportParser reads Sales and Trends summary reports or Financial Reports,
+// gzipped or not, and rolls them up into daily models
+type ReportParser struct {
+	adnetwork.DirectlyParsable
+}
+
+func (r ReportParser) ParseRevenue(reader io.Reader) ([]myrevenue.Model, error) {
+	transactions, err := Parse(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return store.DailyModels(transactions), nil
+}
+
+// Parse detects whether the report is a sales summary or a financial report.
+// Reports are tab separated and usually gzipped as downloaded.
+func Parse(reader io.Reader) ([]store.Transaction, error) {
+	if reader == nil {
+		return nil, errors.New("reader is nil")
+	}
+
+	records, err := readTSV(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(records) == 0 {
+		return nil, errors.New("App Store: empty report")
+	}
+
+	h := headers(records[0])
+	if _, found := h["Developer Proceeds"]; found {
+		return sales(h, records[1:])
+	} else if _, found := h["Partner Share"]; found {
+		return financial(h, records[1:])
+	}
+
+	return nil, errors.Errorf("App Store: unrecognised report columns %v", records[0])
+}
+
+// sales reads the Sales and Trends summary report. Customer price and
+// developer proceeds are per unit, and refunds have negative units.
+func sales(h map[string]int, records [][]string) ([]store.Transaction, error) {
+	transactions := make([]store.Transaction, 0, len(records))
+
+	for i, record := range records {
+		row := i + 2
+		field := fieldReader(h, record)
+		parseError := func(column string, err error) error {
+			return &myrevenue.ParseError{Network: NAME, Row: row, Column: column, Err: err}
+		}
+
+		if isBlank(record) {
+			continue
+		}
+
+		day, err := parseDate(field("Begin Date"))
+		if err != nil {
+			return nil, parseError("Begin Date", err)
+		}
+
+		units, err := parseUnits(field("Units"))
+		if err != nil {
+			return nil, parseError("Units", err)
+		}
+
+		price, err := parseAmount(field("Customer Price"))
+		if err != nil {
+			return nil, parseError("Customer Price", err)
+		}
+
+		proceeds, err := parseAmount(field("Developer Proceeds"))
+		if err != nil {
+			return nil, parseError("Developer Proceeds", err)
+		}
+
+		sku := field("SKU")
+		transactions = append(transactions, store.Transaction{
+			Store:            NAME,
+			DateTime:         day,
+			App:              appSKU(field("Parent Identifier"), sku),
+			SKU:              sku,
+			ProductType:      field("Product Type Identifier"),
+			Country:          field("Country Code"),
+			Units:            units,
+			Refund:           units < 0,
+			BuyerCurrency:    field("Customer Currency"),
+			BuyerAmount:      price * float64(units),
+			MerchantCurrency: field("Currency of Proceeds"),
+			Proceeds:         proceeds * float64(units),
+			Reported:         myrevenue.NET,
+		})
+	}
+
+	return transactions, nil
+}
+
+// financial reads a Financial Report, which covers a fiscal month per
+// region. Extended Partner Share is already the total for the row.
+func financial(h map[string]int, records [][]string) ([]store.Transaction, error) {
+	transactions := make([]store.Transaction, 0, len(records))
+
+	for i, record := range records {
+		row := i + 2
+		field := fieldReader(h, record)
+		parseError := func(column string, err error) error {
+			return &myrevenue.ParseError{Network: NAME, Row: row, Column: column, Err: err}
+		}
+
+		if isBlank(record) {
+			continue
+		}
+
+		// Totals follow the rows, and some regions repeat the header
+		if strings.HasPrefix(record[0], "Total_") || record[0] == "Start Date" {
+			continue
+		}
+
+		day, err := parseDate(field("Start Date"))
+		if err != nil {
+			return nil, parseError("Start Date", err)
+		}
+
+		units, err := parseUnits(field("Quantity"))
+		if err != nil {
+			return nil, parseError("Quantity", err)
+		}
+
+		price, err := parseAmount(field("Customer Price"))
+		if err != nil {
+			return nil, parseError("Customer Price", err)
+		}
+
+		proceeds, err := parseAmount(field("Extended Partner Share"))
+		if err != nil {
+			return nil, parseError("Extended Partner Share", err)
+		}
+
+		sku := field("Vendor Identifier")
+		transactions = append(transactions, store.Transaction{
+			Store:            NAME,
+			DateTime:         day,
+			App:              sku,
+			SKU:              sku,
+			ProductType:      field("Product Type Identifier"),
+			Country:          field("Country Of Sale"),
+			Units:            units,
+			Refund:           field("Sales or Return") == "R" || units < 0,
+			BuyerCurrency:    field("Customer Currency"),
+			BuyerAmount:      price * float64(units),
+			MerchantCurrency: field("Partner Share Currency"),
+			Proceeds:         proceeds,
+			Reported:         myrevenue.NET,
+		})
+	}
+
+	return transactions, nil
+}
+
+// appSKU is the SKU of the app a product belongs to. In-app purchases carry
+// the app's SKU as their parent.
+func appSKU(parent string, sku string) string {
+	if parent != "" {
+		return parent
+	}
+	return sku
+}
+
+var dateFormats = []string{"01/02/2006", "2006-01-02"}
+
+func parseDate(value string) (time.Time, error) {
+	var err error
+	for _, format := range dateFormats {
+		var day time.Time
+		if day, err = time.ParseInLocation(format, value, time.UTC); err == nil {
+			return day, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+func parseUnits(value string) (int64, error) {
+	units, err := parseAmount(value)
+	return int64(units), err
+}
+
+func parseAmount(value string) (float64, error) {
+	value = strings.Replace(value, ",", "", -1)
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(value, 64)
+}
+
+func readTSV(reader io.Reader) ([][]string, error) {
+	content, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.HasPrefix(content, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(bytes.NewReader(content))
+		if err != nil {
+			return nil, err
+		}
+
+		content, err = ioutil.ReadAll(gz)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	content = bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))
+	r := csv.NewReader(bytes.NewReader(content))
+	r.Comma = '\t'
+	r.LazyQuotes = true
+	r.FieldsPerRecord = -1
+	return r.ReadAll()
+}
+
+func headers(record []string) map[string]int {
+	h := make(map[string]int, len(record))
+	for i, column := range record {
+		h[strings.TrimSpace(column)] = i
+	}
+	return h
+}
+
+func fieldReader(h map[string]int, record []string) func(string) string {
+	return func(column string) string {
+		index, found := h[column]
+		if !found || index >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[index])
+	}
+}
+
+func isBlank(record []string) bool {
+	for _, field := range record {
+		if strings.TrimSpace(field) != "" {
+			return false
+		}
+	}
+	return true
+}
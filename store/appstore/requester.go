@@ -0,0 +1,226 @@
+package appstore
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"github.com/econnelly/myrevenue"
+	"github.com/econnelly/myrevenue/adnetwork"
+	"github.com/econnelly/myrevenue/store"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const DEFAULT_BASE_URL = "https://api.appstoreconnect.apple.com"
+
+// Report types
+const (
+	SALES     = "SALES"
+	FINANCIAL = "FINANCIAL"
+)
+
+// ReportRequester downloads reports from the App Store Connect API. Sales
+// reports are fetched per day, financial reports per fiscal month.
+type ReportRequester struct {
+	IssuerID     string `json:"issuer_id"`
+	KeyID        string `json:"key_id"`
+	PrivateKey   string `json:"private_key"` // Contents of the .p8 file
+	VendorNumber string `json:"vendor_number"`
+	ReportType   string `json:"report_type"` // SALES or FINANCIAL, defaults to SALES
+	RegionCode   string `json:"region_code"` // Financial reports only, defaults to ZZ (all regions)
+	BaseURL      string `json:"base_url"`    // Defaults to DEFAULT_BASE_URL
+	StartDate    time.Time
+	EndDate      time.Time
+	Clock        myrevenue.Clock `json:"-"`
+	adnetwork.Request
+
+	key          *ecdsa.PrivateKey
+	token        string
+	tokenExpiry  time.Time
+	transactions []store.Transaction
+}
+
+type ErrorResponse struct {
+	Errors []struct {
+		Status string `json:"status"`
+		Code   string `json:"code"`
+		Title  string `json:"title"`
+		Detail string `json:"detail"`
+	} `json:"errors"`
+}
+
+func (rr *ReportRequester) Initialize() error {
+	if rr.IssuerID == "" || rr.KeyID == "" || rr.VendorNumber == "" {
+		return errors.New("App Store: issuer ID, key ID and vendor number are required")
+	}
+
+	key, err := ParsePrivateKey([]byte(rr.PrivateKey))
+	if err != nil {
+		return err
+	}
+	rr.key = key
+
+	if rr.ReportType == "" {
+		rr.ReportType = SALES
+	}
+
+	if rr.ReportType != SALES && rr.ReportType != FINANCIAL {
+		return errors.Errorf("App Store: unsupported report type %v", rr.ReportType)
+	}
+
+	if rr.RegionCode == "" {
+		rr.RegionCode = "ZZ"
+	}
+
+	if rr.BaseURL == "" {
+		rr.BaseURL = DEFAULT_BASE_URL
+	}
+
+	if rr.Clock == nil {
+		rr.Clock = myrevenue.SystemClock
+	}
+
+	return nil
+}
+
+func (rr *ReportRequester) Fetch() ([]myrevenue.Model, error) {
+	rr.transactions = make([]store.Transaction, 0)
+
+	for _, reportURL := range rr.reportURLs() {
+		transactions, err := rr.download(reportURL)
+		if err != nil {
+			return nil, err
+		}
+
+		// Vendor numbers tell apart several developer accounts
+		for i := range transactions {
+			transactions[i].Account = rr.VendorNumber
+		}
+		rr.transactions = append(rr.transactions, transactions...)
+	}
+
+	return store.DailyModels(rr.transactions), nil
+}
+
+// Transactions are the rows behind the models from the last Fetch
+func (rr ReportRequester) Transactions() []store.Transaction {
+	return rr.transactions
+}
+
+func (rr ReportRequester) reportURLs() []string {
+	urls := make([]string, 0)
+
+	if rr.ReportType == FINANCIAL {
+		month := time.Date(rr.StartDate.Year(), rr.StartDate.Month(), 1, 0, 0, 0, 0, time.UTC)
+		for !month.After(rr.EndDate) {
+			query := url.Values{}
+			query.Set("filter[regionCode]", rr.RegionCode)
+			query.Set("filter[reportDate]", month.Format("2006-01"))
+			query.Set("filter[reportType]", FINANCIAL)
+			query.Set("filter[vendorNumber]", rr.VendorNumber)
+			urls = append(urls, fmt.Sprintf("%v/v1/financeReports?%v", rr.BaseURL, query.Encode()))
+
+			month = month.AddDate(0, 1, 0)
+		}
+		return urls
+	}
+
+	day := time.Date(rr.StartDate.Year(), rr.StartDate.Month(), rr.StartDate.Day(), 0, 0, 0, 0, time.UTC)
+	for !day.After(rr.EndDate) {
+		query := url.Values{}
+		query.Set("filter[frequency]", "DAILY")
+		query.Set("filter[reportDate]", day.Format("2006-01-02"))
+		query.Set("filter[reportSubType]", "SUMMARY")
+		query.Set("filter[reportType]", SALES)
+		query.Set("filter[vendorNumber]", rr.VendorNumber)
+		query.Set("filter[version]", "1_0")
+		urls = append(urls, fmt.Sprintf("%v/v1/salesReports?%v", rr.BaseURL, query.Encode()))
+
+		day = day.AddDate(0, 0, 1)
+	}
+	return urls
+}
+
+func (rr *ReportRequester) download(reportURL string) ([]store.Transaction, error) {
+	token, err := rr.accessToken()
+	if err != nil {
+		return nil, err
+	}
+
+	headers := map[string]string{
+		"Accept":        "application/a-gzip",
+		"Authorization": fmt.Sprintf("Bearer %v", token),
+	}
+
+	resp, err := myrevenue.GetRequest(reportURL, headers, false)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Days and months without sales have no report
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, rr.parseError(resp)
+	}
+
+	return Parse(resp.Body)
+}
+
+// accessToken reuses the signed token until shortly before it expires
+func (rr *ReportRequester) accessToken() (string, error) {
+	now := rr.Clock.Now()
+	if rr.token != "" && now.Before(rr.tokenExpiry.Add(-time.Minute)) {
+		return rr.token, nil
+	}
+
+	token, err := SignToken(rr.key, rr.KeyID, rr.IssuerID, now)
+	if err != nil {
+		return "", err
+	}
+
+	rr.token = token
+	rr.tokenExpiry = now.Add(TOKEN_LIFETIME)
+	return token, nil
+}
+
+func (rr ReportRequester) parseError(resp *http.Response) error {
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	result := ErrorResponse{}
+	if json.Unmarshal(body, &result) != nil || len(result.Errors) == 0 {
+		return errors.Errorf("%v: request failed (%v): %v", rr.GetName(), resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	detail := result.Errors[0].Detail
+	if detail == "" {
+		detail = result.Errors[0].Title
+	}
+	return errors.Errorf("%v: %v (%v)", rr.GetName(), detail, resp.StatusCode)
+}
+
+func (ReportRequester) GetName() string {
+	return NAME
+}
+
+func (rr ReportRequester) GetReport() interface{} {
+	return rr.transactions
+}
+
+func (rr ReportRequester) GetStartDate() time.Time {
+	return rr.StartDate
+}
+
+func (rr ReportRequester) GetEndDate() time.Time {
+	return rr.EndDate
+}
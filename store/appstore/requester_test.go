@@ -0,0 +1,197 @@
+package appstore
+
+import (
+	"github.com/econnelly/myrevenue"
+	"github.com/econnelly/myrevenue/store"
+	"github.com/econnelly/myrevenue/store/appstore/appstoretest"
+	"io/ioutil"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func fixture(t *testing.T, name string) string {
+	content, err := ioutil.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func newRequester(server *appstoretest.Server, reportType string, start time.Time, end time.Time) *ReportRequester {
+	return &ReportRequester{
+		IssuerID:     appstoretest.ISSUER_ID,
+		KeyID:        appstoretest.KEY_ID,
+		PrivateKey:   server.PrivateKey,
+		VendorNumber: appstoretest.VENDOR,
+		ReportType:   reportType,
+		BaseURL:      server.URL,
+		StartDate:    start,
+		EndDate:      end,
+		Clock:        myrevenue.NewFakeClock(time.Date(2018, time.October, 4, 9, 0, 0, 0, time.UTC)),
+	}
+}
+
+func TestFetchSales(t *testing.T) {
+	// Nothing was sold on the 2nd, so that day is a 404
+	server := appstoretest.NewServer(map[string]string{
+		"2018-10-01": fixture(t, "sales_2018-10-01.txt"),
+		"2018-10-03": fixture(t, "sales_2018-10-03.txt"),
+	}, nil)
+	defer server.Close()
+
+	rr := newRequester(server, "", time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC), time.Date(2018, time.October, 3, 23, 59, 59, 0, time.UTC))
+	if err := rr.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	models, err := rr.Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// One request per day, all signed with the same token
+	if server.Calls() != 3 {
+		t.Errorf("Calls() = %v, want 3", server.Calls())
+	}
+	if server.Tokens() != 1 {
+		t.Errorf("Tokens() = %v, want 1", server.Tokens())
+	}
+
+	query := server.LastQuery()
+	if query["filter[reportDate]"][0] != "2018-10-03" || query["filter[frequency]"][0] != "DAILY" || query["filter[reportType]"][0] != SALES {
+		t.Errorf("LastQuery() = %v", query)
+	}
+
+	transactions := rr.Transactions()
+	if len(transactions) != 4 {
+		t.Fatalf("got %v transactions, want 4", len(transactions))
+	}
+
+	tests := []struct {
+		app      string
+		sku      string
+		units    int64
+		proceeds float64
+		stream   myrevenue.Stream
+	}{
+		{"example_app", "example_app", 3, 2.1, myrevenue.PURCHASE},
+		{"example_app", "gems_100", 2, 13.98, myrevenue.PURCHASE},
+		{"example_app", "premium_monthly", 1, 3.5, myrevenue.SUBSCRIPTION},
+		{"example_app", "gems_100", -1, -6.99, myrevenue.REFUND},
+	}
+
+	// Only proceeds are reported, so there is no gross Amount
+	for i, test := range tests {
+		tr := transactions[i]
+		if tr.App != test.app || tr.SKU != test.sku || tr.Units != test.units || math.Abs(tr.Proceeds-test.proceeds) > 1e-9 || tr.Stream() != test.stream {
+			t.Errorf("transaction %v = %+v", i, tr)
+		}
+		if tr.Reported != myrevenue.NET || tr.Amount != 0 || tr.Net() != tr.Proceeds {
+			t.Errorf("transaction %v Reported, Amount, Net = %v, %v, %v", i, tr.Reported, tr.Amount, tr.Net())
+		}
+	}
+
+	// US and GB on the 1st, US on the 3rd
+	if len(models) != 3 {
+		t.Fatalf("got %v models, want 3", len(models))
+	}
+	if m := models[0]; m.NetworkName != NAME || m.Account != appstoretest.VENDOR || m.Country != "US" || math.Abs(m.Revenue-16.08) > 1e-9 || m.ExtendedMetrics[store.UNITS] != 5 {
+		t.Errorf("model = %+v", m)
+	}
+}
+
+func TestFetchNoSales(t *testing.T) {
+	server := appstoretest.NewServer(nil, nil)
+	defer server.Close()
+
+	day := time.Date(2018, time.October, 2, 0, 0, 0, 0, time.UTC)
+	rr := newRequester(server, SALES, day, day)
+	if err := rr.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	models, err := rr.Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(models) != 0 || len(rr.Transactions()) != 0 {
+		t.Errorf("got %v models and %v transactions, want none", len(models), len(rr.Transactions()))
+	}
+}
+
+func TestFetchFinancial(t *testing.T) {
+	server := appstoretest.NewServer(nil, map[string]string{
+		"2018-10": fixture(t, "financial_2018-10.txt"),
+	})
+	defer server.Close()
+
+	rr := newRequester(server, FINANCIAL, time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC), time.Date(2018, time.November, 30, 0, 0, 0, 0, time.UTC))
+	if err := rr.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := rr.Fetch(); err != nil {
+		t.Fatal(err)
+	}
+
+	// October and November, the latter not yet published
+	if server.Calls() != 2 {
+		t.Errorf("Calls() = %v, want 2", server.Calls())
+	}
+	if query := server.LastQuery(); query["filter[reportDate]"][0] != "2018-11" || query["filter[regionCode]"][0] != "ZZ" {
+		t.Errorf("LastQuery() = %v", query)
+	}
+
+	// The totals at the end are skipped
+	transactions := rr.Transactions()
+	if len(transactions) != 2 {
+		t.Fatalf("got %v transactions, want 2", len(transactions))
+	}
+	if tr := transactions[1]; !tr.Refund || tr.Units != -4 || tr.Proceeds != -27.96 || tr.MerchantCurrency != "USD" {
+		t.Errorf("refund = %+v", tr)
+	}
+}
+
+func TestFetchRenewsToken(t *testing.T) {
+	server := appstoretest.NewServer(nil, nil)
+	defer server.Close()
+
+	day := time.Date(2018, time.October, 2, 0, 0, 0, 0, time.UTC)
+	rr := newRequester(server, SALES, day, day)
+	if err := rr.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	rr.Fetch()
+	rr.Clock.(*myrevenue.FakeClock).Advance(10 * time.Minute)
+	rr.Fetch()
+	if server.Tokens() != 1 {
+		t.Errorf("Tokens() = %v, want the token reused", server.Tokens())
+	}
+
+	// Close to expiry a new one is signed
+	rr.Clock.(*myrevenue.FakeClock).Advance(10 * time.Minute)
+	rr.Fetch()
+	if server.Tokens() != 2 {
+		t.Errorf("Tokens() = %v, want 2", server.Tokens())
+	}
+}
+
+func TestFetchUnknownVendor(t *testing.T) {
+	server := appstoretest.NewServer(nil, nil)
+	defer server.Close()
+
+	day := time.Date(2018, time.October, 2, 0, 0, 0, 0, time.UTC)
+	rr := newRequester(server, SALES, day, day)
+	rr.VendorNumber = "1"
+	if err := rr.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := rr.Fetch(); err == nil || !strings.Contains(err.Error(), "unknown vendor number (403)") {
+		t.Errorf("Fetch() error = %v", err)
+	}
+}
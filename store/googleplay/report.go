@@ -0,0 +1,363 @@
+package googleplay
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"github.com/econnelly/myrevenue"
+	"github.com/econnelly/myrevenue/adnetwork"
+	"github.com/econnelly/myrevenue/store"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const NAME = "Google Play"
+
+// Earnings report transaction types
+const (
+	CHARGE            = "Charge"
+	CHARGE_REFUND     = "Charge refund"
+	GOOGLE_FEE        = "Google fee"
+	GOOGLE_FEE_REFUND = "Google fee refund"
+	TAX               = "Tax"
+	TAX_REFUND        = "Tax refund"
+)
+
+// ReportParser reads earnings or estimated sales CSVs, zipped or not, and
+// rolls them up into daily models
+type ReportParser struct {
+	adnetwork.DirectlyParsable
+}
+
+func (r ReportParser) ParseRevenue(reader io.Reader) ([]myrevenue.Model, error) {
+	transactions, err := Parse(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return store.DailyModels(transactions), nil
+}
+
+// ParseFile reads a report from the local copy of the Cloud Storage export
+// bucket. Zip archives may hold any number of reports.
+func ParseFile(path string) ([]store.Transaction, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	transactions, err := Parse(bytes.NewReader(content))
+	if err != nil {
+		return nil, errors.Wrap(err, filepath.Base(path))
+	}
+	return transactions, nil
+}
+
+// Parse detects whether the report is an earnings or estimated sales report,
+// or a zip archive of them
+func Parse(reader io.Reader) ([]store.Transaction, error) {
+	if reader == nil {
+		return nil, errors.New("reader is nil")
+	}
+
+	content, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.HasPrefix(content, []byte("PK\x03\x04")) {
+		return parseZip(content)
+	}
+
+	records, err := readCSV(content)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(records) == 0 {
+		return nil, errors.New("Google Play: empty report")
+	}
+
+	h := headers(records[0])
+	if _, found := h["Transaction Type"]; found {
+		return earnings(h, records[1:])
+	} else if _, found := h["Financial Status"]; found {
+		return sales(h, records[1:])
+	}
+
+	return nil, errors.Errorf("Google Play: unrecognised report columns %v", records[0])
+}
+
+func ParseEarnings(reader io.Reader) ([]store.Transaction, error) {
+	return parseAs(reader, earnings)
+}
+
+func ParseSales(reader io.Reader) ([]store.Transaction, error) {
+	return parseAs(reader, sales)
+}
+
+func parseAs(reader io.Reader, parse func(map[string]int, [][]string) ([]store.Transaction, error)) ([]store.Transaction, error) {
+	content, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := readCSV(content)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(records) == 0 {
+		return nil, errors.New("Google Play: empty report")
+	}
+
+	return parse(headers(records[0]), records[1:])
+}
+
+func parseZip(content []byte) ([]store.Transaction, error) {
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, err
+	}
+
+	transactions := make([]store.Transaction, 0)
+	for _, f := range archive.File {
+		if !strings.EqualFold(filepath.Ext(f.Name), ".csv") {
+			continue
+		}
+
+		r, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+
+		parsed, err := Parse(r)
+		r.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, f.Name)
+		}
+
+		transactions = append(transactions, parsed...)
+	}
+
+	return transactions, nil
+}
+
+// earnings merges the charge, fee and tax rows of each order into a single
+// transaction, with refunds kept separate
+func earnings(h map[string]int, records [][]string) ([]store.Transaction, error) {
+	type key struct {
+		order  string
+		sku    string
+		refund bool
+	}
+
+	index := make(map[key]int)
+	transactions := make([]store.Transaction, 0)
+
+	for i, record := range records {
+		row := i + 2
+		field := fieldReader(h, record)
+		parseError := func(column string, err error) error {
+			return &myrevenue.ParseError{Network: NAME, Row: row, Column: column, Err: err}
+		}
+
+		if isBlank(record) {
+			continue
+		}
+
+		day, err := parseDate(field("Transaction Date"))
+		if err != nil {
+			return nil, parseError("Transaction Date", err)
+		}
+
+		transactionType := field("Transaction Type")
+		refund := strings.HasSuffix(strings.ToLower(transactionType), "refund")
+
+		buyerAmount, err := parseAmount(field("Amount (Buyer Currency)"))
+		if err != nil {
+			return nil, parseError("Amount (Buyer Currency)", err)
+		}
+
+		amount, err := parseAmount(field("Amount (Merchant Currency)"))
+		if err != nil {
+			return nil, parseError("Amount (Merchant Currency)", err)
+		}
+
+		sku := field("Sku Id")
+		k := key{field("Description"), sku, refund}
+		position, found := index[k]
+		if !found {
+			transactions = append(transactions, store.Transaction{
+				Store:            NAME,
+				DateTime:         day,
+				OrderID:          k.order,
+				App:              field("Product id"),
+				SKU:              sku,
+				ProductType:      field("Product Type"),
+				Country:          field("Buyer Country"),
+				Refund:           refund,
+				BuyerCurrency:    field("Buyer Currency"),
+				MerchantCurrency: field("Merchant Currency"),
+				Reported:         myrevenue.BOTH,
+			})
+			position = len(transactions) - 1
+			index[k] = position
+		}
+
+		t := &transactions[position]
+		switch transactionType {
+		case CHARGE, CHARGE_REFUND:
+			t.Amount += amount
+			t.Proceeds += amount
+			t.BuyerAmount += buyerAmount
+			if refund {
+				t.Units--
+			} else {
+				t.Units++
+			}
+		case GOOGLE_FEE, GOOGLE_FEE_REFUND:
+			t.Fees += amount
+			t.Proceeds += amount
+		case TAX, TAX_REFUND:
+			t.Tax += amount
+		default:
+			// Adjustments and other one-offs have no fee or tax breakdown
+			t.Amount += amount
+			t.Proceeds += amount
+			t.BuyerAmount += buyerAmount
+		}
+	}
+
+	return transactions, nil
+}
+
+// sales reads the estimated sales report, which is in the buyer's currency
+// and has no fee breakdown
+func sales(h map[string]int, records [][]string) ([]store.Transaction, error) {
+	transactions := make([]store.Transaction, 0, len(records))
+
+	for i, record := range records {
+		row := i + 2
+		field := fieldReader(h, record)
+		parseError := func(column string, err error) error {
+			return &myrevenue.ParseError{Network: NAME, Row: row, Column: column, Err: err}
+		}
+
+		if isBlank(record) {
+			continue
+		}
+
+		day, err := parseDate(field("Order Charged Date"))
+		if err != nil {
+			return nil, parseError("Order Charged Date", err)
+		}
+
+		charged, err := parseAmount(field("Charged Amount"))
+		if err != nil {
+			return nil, parseError("Charged Amount", err)
+		}
+
+		tax, err := parseAmount(field("Taxes Collected"))
+		if err != nil {
+			return nil, parseError("Taxes Collected", err)
+		}
+
+		refund := strings.EqualFold(field("Financial Status"), "Refund")
+		units := int64(1)
+		if refund {
+			units = -1
+			charged = -abs(charged)
+			tax = -abs(tax)
+		}
+
+		currency := field("Currency of Sale")
+		transactions = append(transactions, store.Transaction{
+			Store:            NAME,
+			DateTime:         day,
+			OrderID:          field("Order Number"),
+			App:              field("Product ID"),
+			SKU:              field("SKU ID"),
+			ProductType:      field("Product Type"),
+			Country:          field("Country of Buyer"),
+			Units:            units,
+			Refund:           refund,
+			BuyerCurrency:    currency,
+			BuyerAmount:      charged,
+			MerchantCurrency: currency,
+			// Charged Amount includes tax
+			Amount:   charged - tax,
+			Tax:      tax,
+			Reported: myrevenue.GROSS,
+		})
+	}
+
+	return transactions, nil
+}
+
+var dateFormats = []string{"2006-01-02", "Jan 2, 2006", "January 2, 2006", "01/02/2006"}
+
+func parseDate(value string) (time.Time, error) {
+	var err error
+	for _, format := range dateFormats {
+		var day time.Time
+		if day, err = time.ParseInLocation(format, value, time.UTC); err == nil {
+			return day, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+func parseAmount(value string) (float64, error) {
+	value = strings.Replace(value, ",", "", -1)
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(value, 64)
+}
+
+func abs(v float64) float64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func readCSV(content []byte) ([][]string, error) {
+	content = bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))
+	reader := csv.NewReader(bytes.NewReader(content))
+	reader.FieldsPerRecord = -1
+	return reader.ReadAll()
+}
+
+func headers(record []string) map[string]int {
+	h := make(map[string]int, len(record))
+	for i, column := range record {
+		h[strings.TrimSpace(column)] = i
+	}
+	return h
+}
+
+func fieldReader(h map[string]int, record []string) func(string) string {
+	return func(column string) string {
+		index, found := h[column]
+		if !found || index >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[index])
+	}
+}
+
+func isBlank(record []string) bool {
+	for _, field := range record {
+		if strings.TrimSpace(field) != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,233 @@
+package googleplay
+
+import (
+	"archive/zip"
+	"bytes"
+	"github.com/econnelly/myrevenue"
+	"github.com/econnelly/myrevenue/store"
+	"io/ioutil"
+	"math"
+	"os"
+	"testing"
+)
+
+const ORDER = "GPA.3301-2233-4455-66778"
+
+func equal(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestParseEarnings(t *testing.T) {
+	transactions, err := ParseFile("testdata/earnings.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(transactions) != 3 {
+		t.Fatalf("got %v transactions, want 3: %+v", len(transactions), transactions)
+	}
+
+	// The charge, fee and tax rows of the order are merged, and the refund
+	// is kept apart
+	tests := []struct {
+		order  string
+		refund bool
+		day    string
+		units  int64
+		amount float64
+		tax    float64
+		fees   float64
+		net    float64
+		stream myrevenue.Stream
+	}{
+		{ORDER, false, "2018-10-01", 1, 10, 0.8, -3, 7, myrevenue.PURCHASE},
+		{ORDER, true, "2018-10-03", -1, -10, -0.8, 3, -7, myrevenue.REFUND},
+		{"GPA.3392-1188-0045-12345", false, "2018-10-02", 1, 5.79, 0, -0.87, 4.92, myrevenue.SUBSCRIPTION},
+	}
+
+	for i, test := range tests {
+		tr := transactions[i]
+		if tr.OrderID != test.order || tr.Refund != test.refund || tr.DateTime.Format("2006-01-02") != test.day || tr.Units != test.units {
+			t.Errorf("transaction %v = %+v", i, tr)
+		}
+		if !equal(tr.Amount, test.amount) || !equal(tr.Tax, test.tax) || !equal(tr.Fees, test.fees) || !equal(tr.Proceeds, test.net) {
+			t.Errorf("transaction %v amount, tax, fees, proceeds = %v, %v, %v, %v", i, tr.Amount, tr.Tax, tr.Fees, tr.Proceeds)
+		}
+		if r := tr.Record(); tr.Reported != myrevenue.BOTH || !equal(r.GrossRevenue, test.amount) || !equal(r.NetRevenue, test.net) {
+			t.Errorf("transaction %v Reported, gross, net = %v, %v, %v", i, tr.Reported, r.GrossRevenue, r.NetRevenue)
+		}
+		if tr.Stream() != test.stream {
+			t.Errorf("transaction %v stream = %v, want %v", i, tr.Stream(), test.stream)
+		}
+	}
+
+	if tr := transactions[2]; tr.BuyerCurrency != "EUR" || tr.BuyerAmount != 4.99 || tr.MerchantCurrency != "USD" || tr.Country != "DE" {
+		t.Errorf("currencies = %+v", tr)
+	}
+}
+
+func TestParseSales(t *testing.T) {
+	transactions, err := ParseFile("testdata/sales.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(transactions) != 2 {
+		t.Fatalf("got %v transactions, want 2", len(transactions))
+	}
+
+	// Charged Amount includes tax, Amount doesn't
+	sale, refund := transactions[0], transactions[1]
+	if !equal(sale.Amount, 10) || !equal(sale.Tax, 0.8) || sale.BuyerAmount != 10.8 || sale.Units != 1 {
+		t.Errorf("sale = %+v", sale)
+	}
+	if !refund.Refund || !equal(refund.Amount, -10) || !equal(refund.Tax, -0.8) || refund.Units != -1 {
+		t.Errorf("refund = %+v", refund)
+	}
+
+	// Amount means the same as in the earnings report, but there is no
+	// Proceeds figure to go with it
+	if sale.Reported != myrevenue.GROSS || sale.Proceeds != 0 || !equal(sale.Net(), 10) {
+		t.Errorf("sale Reported, Proceeds, Net = %v, %v, %v", sale.Reported, sale.Proceeds, sale.Net())
+	}
+}
+
+func TestEarningsAndSalesAgree(t *testing.T) {
+	earned, err := ParseFile("testdata/earnings.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sold, err := ParseFile("testdata/sales.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The sales report has no fee breakdown, but the same sale must have the
+	// same pre-tax amount and tax in both
+	for i := range sold {
+		e, s := earned[i].Record(), sold[i].Record()
+		if !equal(e.GrossRevenue, s.GrossRevenue) || !equal(earned[i].Tax, sold[i].Tax) {
+			t.Errorf("transaction %v: earnings %v/%v, sales %v/%v", i, e.GrossRevenue, earned[i].Tax, s.GrossRevenue, sold[i].Tax)
+		}
+	}
+}
+
+func TestParseZip(t *testing.T) {
+	earnings, err := ioutil.ReadFile("testdata/earnings.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sales, err := ioutil.ReadFile("testdata/sales.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Zipped the way the export bucket holds them, with a stray file
+	buffer := &bytes.Buffer{}
+	archive := zip.NewWriter(buffer)
+	for name, content := range map[string][]byte{
+		"PlayApps_201810.csv":       earnings,
+		"salesreport_201810.csv":    sales,
+		"__MACOSX/._PlayApps.plist": []byte("ignored"),
+	} {
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(content)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	path := t.TempDir() + "/earnings_201810_1234.zip"
+	if err := os.WriteFile(path, buffer.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	transactions, err := ParseFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(transactions) != 5 {
+		t.Errorf("got %v transactions, want 5", len(transactions))
+	}
+}
+
+func TestParseBadDate(t *testing.T) {
+	_, err := Parse(bytes.NewReader([]byte("Description,Transaction Date,Transaction Type\nGPA.1,yesterday,Charge\n")))
+	if e, ok := err.(*myrevenue.ParseError); !ok || e.Row != 2 || e.Column != "Transaction Date" {
+		t.Errorf("Parse() error = %v", err)
+	}
+}
+
+func TestReportParser(t *testing.T) {
+	f, err := os.Open("testdata/earnings.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	models, err := ReportParser{}.ParseRevenue(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(models) != 3 {
+		t.Fatalf("got %v models, want 3", len(models))
+	}
+
+	if m := models[0]; !equal(m.Revenue, 7) || !equal(m.ExtendedMetrics[store.GROSS], 10) || !equal(m.ExtendedMetrics[store.TAX], 0.8) || m.ExtendedMetrics[store.UNITS] != 1 {
+		t.Errorf("model = %+v", m)
+	}
+}
+
+func TestSalesModelsAreGross(t *testing.T) {
+	f, err := os.Open("testdata/sales.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	models, err := ReportParser{}.ParseRevenue(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without fees in the report, revenue is what the buyer paid before tax
+	if len(models) == 0 || !equal(models[0].Revenue, 10) || models[0].ExtendedMetrics[store.FEES] != 0 {
+		t.Errorf("models = %+v", models)
+	}
+}
+
+func TestRevenueShareOnSales(t *testing.T) {
+	sold, err := ParseFile("testdata/sales.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	earned, err := ParseFile("testdata/earnings.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The rule from the README
+	share := myrevenue.RevenueShare{Rules: []myrevenue.ShareRule{{Source: NAME, Percentage: 15}}}
+	applied, err := share.Apply(append(store.Records(sold[:1]), store.Records(earned[:1])...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The sale is gross, so the share comes off it
+	if sale := applied[0]; !equal(sale.GrossRevenue, 10) || !equal(sale.NetRevenue, 8.5) {
+		t.Errorf("sale gross, net = %v, %v, want 10, 8.5", sale.GrossRevenue, sale.NetRevenue)
+	}
+
+	// Earnings have the actual fee, so they are left alone
+	if e := applied[1]; !equal(e.GrossRevenue, 10) || !equal(e.NetRevenue, 7) {
+		t.Errorf("earnings gross, net = %v, %v, want 10, 7", e.GrossRevenue, e.NetRevenue)
+	}
+}
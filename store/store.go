@@ -0,0 +1,162 @@
+package store
+
+import (
+	"github.com/econnelly/myrevenue"
+	"sort"
+	"time"
+)
+
+// Transaction is one sale, refund or adjustment reported by an app store.
+// Amount, Proceeds, Tax and Fees are in MerchantCurrency and keep the store's
+// sign, so refunds and fees withheld by the store are negative. Amount is what
+// the buyer paid before the store's fees, excluding tax, and Proceeds is what
+// the store pays out after them. Tax is what was collected from the buyer on
+// top of Amount, with the same sign.
+//
+// Not every report has both figures. Reported is myrevenue.GROSS when only
+// Amount is known, myrevenue.NET when only Proceeds is, and myrevenue.BOTH when
+// the report breaks out the fees.
+type Transaction struct {
+	Store            string    `json:"store"`
+	Account          string    `json:"account,omitempty"`
+	DateTime         time.Time `json:"date_time"`
+	OrderID          string    `json:"order_id,omitempty"`
+	App              string    `json:"app"` // Package name or bundle ID
+	SKU              string    `json:"sku"`
+	ProductType      string    `json:"product_type,omitempty"`
+	Country          string    `json:"country"` // 2-letter country code
+	Units            int64     `json:"units"`
+	Refund           bool      `json:"refund"`
+	BuyerCurrency    string    `json:"buyer_currency"`
+	BuyerAmount      float64   `json:"buyer_amount"`
+	MerchantCurrency string    `json:"merchant_currency"`
+	Amount           float64   `json:"amount"`
+	Proceeds         float64   `json:"proceeds"`
+	Tax              float64   `json:"tax"`
+	Fees             float64   `json:"fees"`
+	Reported         string    `json:"reported"`
+}
+
+// Gross is Amount, or Proceeds when that is all the store reports
+func (t Transaction) Gross() float64 {
+	if t.Reported == myrevenue.NET {
+		return t.Proceeds
+	}
+	return t.Amount
+}
+
+// Net is what the developer keeps after store fees, or Amount when the store
+// doesn't report fees. Tax is passed on to the tax authorities, so it is never
+// part of it.
+func (t Transaction) Net() float64 {
+	if t.Reported == myrevenue.GROSS {
+		return t.Amount
+	}
+	return t.Proceeds
+}
+
+// subscriptionTypes are the product types each store uses for subscriptions
+var subscriptionTypes = map[string]bool{
+	"subscription": true, // Google Play
+	"IAY":          true, // App Store auto-renewable
+	"IAC":          true, // App Store non-renewing
+}
+
+// Stream classifies the transaction. Refunds are their own stream whatever
+// was refunded.
+func (t Transaction) Stream() myrevenue.Stream {
+	if t.Refund {
+		return myrevenue.REFUND
+	} else if subscriptionTypes[t.ProductType] {
+		return myrevenue.SUBSCRIPTION
+	}
+	return myrevenue.PURCHASE
+}
+
+// Record is the transaction in the common revenue shape, in the merchant
+// currency
+func (t Transaction) Record() myrevenue.Record {
+	return myrevenue.Record{
+		Source:       t.Store,
+		Stream:       t.Stream(),
+		App:          t.App,
+		Country:      t.Country,
+		Date:         time.Date(t.DateTime.Year(), t.DateTime.Month(), t.DateTime.Day(), 0, 0, 0, 0, t.DateTime.Location()),
+		Account:      t.Account,
+		GrossRevenue: t.Gross(),
+		NetRevenue:   t.Net(),
+		Currency:     t.MerchantCurrency,
+		Reported:     t.Reported,
+	}
+}
+
+func Records(transactions []Transaction) []myrevenue.Record {
+	records := make([]myrevenue.Record, len(transactions))
+	for i, t := range transactions {
+		records[i] = t.Record()
+	}
+	return records
+}
+
+// Extended metrics on rolled up models
+const (
+	UNITS = "units"
+	GROSS = "gross"
+	TAX   = "tax"
+	FEES  = "fees"
+)
+
+// DailyModels rolls transactions up into one Model per store, account, day,
+// app, country and currency, with net proceeds as Revenue. Google Play's
+// estimated sales report has no fees, so its Revenue is the gross amount.
+func DailyModels(transactions []Transaction) []myrevenue.Model {
+	type key struct {
+		store    string
+		account  string
+		day      time.Time
+		app      string
+		country  string
+		currency string
+	}
+
+	index := make(map[key]int)
+	models := make([]myrevenue.Model, 0)
+
+	for _, t := range transactions {
+		day := time.Date(t.DateTime.Year(), t.DateTime.Month(), t.DateTime.Day(), 0, 0, 0, 0, t.DateTime.Location())
+		k := key{t.Store, t.Account, day, t.App, t.Country, t.MerchantCurrency}
+
+		i, found := index[k]
+		if !found {
+			models = append(models, myrevenue.Model{
+				NetworkName: t.Store,
+				DateTime:    day,
+				App:         t.App,
+				Country:     t.Country,
+				Currency:    t.MerchantCurrency,
+				Account:     t.Account,
+			})
+			i = len(models) - 1
+			index[k] = i
+		}
+
+		m := &models[i]
+		m.Revenue += t.Net()
+		addExtendedMetric(m, UNITS, float64(t.Units))
+		if t.Reported != myrevenue.NET {
+			addExtendedMetric(m, GROSS, t.Amount)
+		}
+		addExtendedMetric(m, TAX, t.Tax)
+		addExtendedMetric(m, FEES, t.Fees)
+	}
+
+	sort.SliceStable(models, func(i, j int) bool {
+		return models[i].DateTime.Before(models[j].DateTime)
+	})
+
+	return models
+}
+
+func addExtendedMetric(m *myrevenue.Model, name string, value float64) {
+	m.SetExtendedMetric(name, m.ExtendedMetrics[name]+value)
+}